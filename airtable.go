@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -76,7 +78,7 @@ func (a *Airtable) syncData(force ...bool) error {
 	listsChan := make(chan []List, 1)
 	linkIDsChan := make(chan []string, 1)
 	listIDsChan := make(chan []string, 1)
-	schemaChan := make(chan []*string, 1)
+	choicesChan := make(chan map[string][]Choice, 1)
 
 	go func() {
 		defer wg.Done()
@@ -144,26 +146,16 @@ func (a *Airtable) syncData(force ...bool) error {
 
 	go func() {
 		defer wg.Done()
-		schema := []*string{nil, nil}
-
-		tags, categories, err := a.fetchSchema()
+		choices, err := a.fetchChoices()
 		if err != nil {
 			select {
 			case errorChan <- err:
 			default:
 			}
 			cancel()
-		} else {
-			if tags != nil {
-				schema[0] = stringPtr(strings.Join(*tags, ","))
-			}
-			if categories != nil {
-				schema[1] = stringPtr(strings.Join(*categories, ","))
-			}
 		}
-
 		select {
-		case schemaChan <- schema:
+		case choicesChan <- choices:
 		case <-ctx.Done():
 		}
 	}()
@@ -175,7 +167,7 @@ func (a *Airtable) syncData(force ...bool) error {
 		close(listsChan)
 		close(linkIDsChan)
 		close(listIDsChan)
-		close(schemaChan)
+		close(choicesChan)
 	}()
 
 	select {
@@ -185,7 +177,7 @@ func (a *Airtable) syncData(force ...bool) error {
 		lists := <-listsChan
 		linkIDs := <-linkIDsChan
 		listIDs := <-listIDsChan
-		schema := <-schemaChan
+		choices := <-choicesChan
 
 		now := time.Now()
 		if err := a.cache.clearDeletedRecords("Links", linkIDs); err != nil {
@@ -200,11 +192,10 @@ func (a *Airtable) syncData(force ...bool) error {
 		if err := a.cache.saveLists(lists); err != nil {
 			return err
 		}
-		if tags := schema[0]; tags != nil {
-			_ = a.cache.setData("Tags", *tags)
-		}
-		if categories := schema[1]; categories != nil {
-			_ = a.cache.setData("Categories", *categories)
+		for field, fieldChoices := range choices {
+			if err := a.cache.saveChoices(field, fieldChoices); err != nil {
+				return err
+			}
 		}
 		_ = a.cache.setData("LastSyncedAt", now.Format(time.RFC3339))
 		a.cache.lastSyncedAt = now
@@ -348,6 +339,204 @@ func (a *Airtable) deleteList(list *List, deleteLinks bool) error {
 	return nil
 }
 
+// Update some fields of many links at once and save them to the cache
+// Links for which fields returns nil are left untouched
+func (a *Airtable) updateLinks(links []Link, fields func(link Link) map[string]any) (int, error) {
+	records := []*Record{}
+	for _, link := range links {
+		if f := fields(link); f != nil {
+			records = append(records, &Record{ID: link.ID, Fields: &f})
+		}
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	if err := a.updateRecords("Links", &records); err != nil {
+		return 0, err
+	}
+	updated := make([]Link, len(records))
+	for i, record := range records {
+		updated[i] = *record.toLink()
+	}
+	if err := a.cache.saveLinks(updated); err != nil {
+		return len(records), err
+	}
+	logMessage("INFO", "Updated %d links", len(records))
+	return len(records), nil
+}
+
+var recordIDRe = regexp.MustCompile(`^rec[0-9A-Za-z]{14}$`)
+
+// Find the cached links referred to by record IDs, URLs or markdown links,
+// separated by commas, tabs or newlines
+func (a *Airtable) resolveLinks(targets ...string) ([]Link, error) {
+	ids := []string{}
+	for _, target := range targets {
+		for part := range strings.FieldsFuncSeq(target, func(r rune) bool { return r == ',' || r == '\t' || r == '\n' }) {
+			part = strings.TrimSpace(part)
+			if recordIDRe.MatchString(part) {
+				ids = append(ids, part)
+				continue
+			}
+			URLs := []string{}
+			for _, link := range extractMDLinks(part) {
+				URLs = append(URLs, link.URL)
+			}
+			if len(URLs) == 0 && testURL(part) {
+				URLs = append(URLs, part)
+			}
+			for _, URL := range URLs {
+				if link, _ := a.cache.getLinkByURL(URL); link != nil {
+					ids = append(ids, *link.ID)
+				}
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no links selected")
+	}
+	links, err := a.cache.getLinksByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("no links found")
+	}
+	return links, nil
+}
+
+// Apply an action to many links at once
+//   - done, undone
+//   - tag, untag: value is the tag
+//   - category: value is the category, or __NONE__ to remove it
+//   - list, unlist: value is the list ID
+//   - delete
+func (a *Airtable) bulkUpdate(links []Link, action string, value string) (int, error) {
+	var fields func(link Link) map[string]any
+	switch action {
+	case "done", "undone":
+		fields = func(link Link) map[string]any {
+			if link.Done == (action == "done") {
+				return nil
+			}
+			return map[string]any{"Done": action == "done"}
+		}
+	case "tag":
+		value = strings.TrimSpace(value)
+		if value == "" || strings.Contains(value, ",") {
+			return 0, fmt.Errorf("invalid tag: '%s'", value)
+		}
+		fields = func(link Link) map[string]any {
+			if slices.Contains(link.Tags, value) {
+				return nil
+			}
+			return map[string]any{"Tags": append(link.Tags, value)}
+		}
+	case "untag":
+		fields = func(link Link) map[string]any {
+			if !slices.Contains(link.Tags, value) {
+				return nil
+			}
+			return map[string]any{"Tags": slices.DeleteFunc(slices.Clone(link.Tags), func(t string) bool { return t == value })}
+		}
+	case "category":
+		var category *string
+		if value != "__NONE__" {
+			if !slices.Contains(a.cache.getChoiceNames("Category"), value) {
+				return 0, fmt.Errorf("unknown category: %s", value)
+			}
+			category = &value
+		}
+		fields = func(link Link) map[string]any {
+			if (link.Category == nil && category == nil) || (link.Category != nil && category != nil && *link.Category == *category) {
+				return nil
+			}
+			return map[string]any{"Category": category}
+		}
+	case "list", "unlist":
+		if value == "" {
+			return 0, fmt.Errorf("listID is required")
+		}
+		fields = func(link Link) map[string]any {
+			if slices.Contains(link.ListIDs, value) == (action == "list") {
+				return nil
+			}
+			if action == "list" {
+				return map[string]any{"Lists": append(link.ListIDs, value)}
+			}
+			return map[string]any{"Lists": slices.DeleteFunc(slices.Clone(link.ListIDs), func(id string) bool { return id == value })}
+		}
+	case "delete":
+		return a.deleteLinks(links)
+	default:
+		return 0, fmt.Errorf("unknown action: %s", action)
+	}
+
+	count, err := a.updateLinks(links, fields)
+	if err != nil {
+		return count, err
+	}
+	if action == "tag" && !slices.Contains(a.cache.getChoiceNames("Tags"), value) {
+		_ = a.cache.addChoice("Tags", Choice{Name: value})
+	}
+	return count, nil
+}
+
+// Delete many links at once, from Airtable and from the cache
+func (a *Airtable) deleteLinks(links []Link) (int, error) {
+	records := make([]*Record, len(links))
+	ids := make([]string, len(links))
+	for i, link := range links {
+		records[i] = &Record{ID: link.ID}
+		ids[i] = *link.ID
+	}
+	if err := a.deleteRecords("Links", &records); err != nil {
+		return 0, err
+	}
+	if err := a.cache.deleteRecords("Links", ids); err != nil {
+		return len(ids), err
+	}
+	logMessage("INFO", "Deleted %d links", len(ids))
+	return len(ids), nil
+}
+
+// Fetch the metadata of a page and keep it in the cache
+func (a *Airtable) fetchMetadata(URL string) {
+	if !testURL(URL) {
+		return
+	}
+	meta, err := fetchPageMeta(URL)
+	if err != nil {
+		logMessage("ERROR", "Failed to fetch metadata of %s: %s", URL, err)
+		now := time.Now()
+		meta = &PageMeta{URL: URL, FetchedAt: &now, Error: stringPtr(err.Error())}
+	}
+	_ = a.cache.savePageMeta(meta)
+}
+
+// Get the cached metadata of a page
+// If it is not cached yet, fetch it in the background and ask Alfred to rerun
+func (a *Airtable) pageMeta(URL string, wf *Workflow) *PageMeta {
+	if !testURL(URL) {
+		return nil
+	}
+	meta, startedAt, err := a.cache.getPageMeta(URL)
+	if err == nil && meta.FetchedAt != nil {
+		return meta
+	}
+	if err == nil && startedAt != nil && time.Since(*startedAt) < fetchTimeout+5*time.Second {
+		// still fetching
+		wf.rerun(0.5)
+		return nil
+	}
+	if err := a.cache.startPageFetch(URL); err != nil {
+		return nil
+	}
+	runInBackground("mode=fetch-metadata", "URL="+URL)
+	wf.rerun(0.5)
+	return nil
+}
+
 func (a *Airtable) listToLinkCopier(list *List) (*string, error) {
 	name := "Untitled List"
 	if list.Name != nil {
@@ -360,12 +549,12 @@ func (a *Airtable) listToLinkCopier(list *List) (*string, error) {
 	if len(links) == 0 {
 		return nil, fmt.Errorf("no links found in list")
 	}
-	lines := []string{}
-	for _, link := range links {
-		line := fmt.Sprintf("- [%s](%s)", *link.Name, *link.URL)
-		lines = append(lines, line)
+	order, err := a.cache.getLinkOrder(*list.ID)
+	if err != nil {
+		return nil, err
 	}
-	text := strings.Join(lines, "\n")
+	sortByOrder(links, order)
+	text := formatLinkCopier(*list.ID, links)
 
 	lcDir := "link_copiers"
 	if _, err := os.Stat(lcDir); os.IsNotExist(err) {
@@ -391,20 +580,13 @@ func (a *Airtable) linkCopierToList(file string) (*List, error) {
 	if err != nil {
 		return nil, err
 	}
-	lines := strings.Split(string(text), "\n")
 	links := []Link{}
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		title, url := parseMDLink(line)
-		if url != nil {
-			links = append(links, Link{
-				Name: title,
-				URL:  url,
-			})
-		}
+	for _, entry := range parseLinkCopier(string(text)).Entries {
+		links = append(links, Link{
+			Name: stringPtr(entry.Name),
+			URL:  stringPtr(entry.URL),
+			Done: entry.Done,
+		})
 	}
 	if len(links) == 0 {
 		return nil, fmt.Errorf("no valid links found in file %s", file)
@@ -416,3 +598,121 @@ func (a *Airtable) linkCopierToList(file string) (*List, error) {
 	}
 	return &list, nil
 }
+
+// The Web API cannot edit the options of an existing field,
+// so changes to tags and categories are applied to the records (with typecast)
+// and to the options kept in the cache
+
+func checkChoiceField(field string) error {
+	if field != "Tags" && field != "Category" {
+		return fmt.Errorf("unknown field: %s", field)
+	}
+	return nil
+}
+
+func (a *Airtable) createChoice(field string, name string, color *string) error {
+	if err := checkChoiceField(field); err != nil {
+		return err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || strings.Contains(name, ",") {
+		return fmt.Errorf("invalid name: '%s'", name)
+	}
+	if err := a.cache.addChoice(field, Choice{Name: name, Color: color}); err != nil {
+		return err
+	}
+	logMessage("INFO", "Created %s option %s", field, name)
+	return nil
+}
+
+// Replace an option with another one in every link that has it
+// If newName is nil, the option is removed from the links
+func (a *Airtable) replaceChoice(field string, name string, newName *string) (int, error) {
+	links, err := a.cache.getGroupLinks(field, name)
+	if err != nil {
+		return 0, err
+	}
+	return a.updateLinks(links, func(link Link) map[string]any {
+		switch field {
+		case "Tags":
+			tags := []string{}
+			for _, tag := range link.Tags {
+				if tag != name {
+					tags = append(tags, tag)
+				} else if newName != nil && !slices.Contains(link.Tags, *newName) {
+					tags = append(tags, *newName)
+				}
+			}
+			return map[string]any{"Tags": tags}
+		case "Category":
+			return map[string]any{"Category": newName}
+		}
+		return nil
+	})
+}
+
+// Rename an option, or merge it into another one if newName already exists
+func (a *Airtable) renameChoice(field string, name string, newName string) (int, error) {
+	if err := checkChoiceField(field); err != nil {
+		return 0, err
+	}
+	newName = strings.TrimSpace(newName)
+	if newName == "" || strings.Contains(newName, ",") {
+		return 0, fmt.Errorf("invalid name: '%s'", newName)
+	}
+	if newName == name {
+		return 0, nil
+	}
+	// Keep the color of the option, unless merging into an existing one
+	var color *string
+	choices, _ := a.cache.getChoices(field)
+	for _, choice := range choices {
+		if choice.Name == name {
+			color = choice.Color
+		}
+	}
+	if slices.ContainsFunc(choices, func(c Choice) bool { return c.Name == newName }) {
+		color = nil
+	}
+	count, err := a.replaceChoice(field, name, &newName)
+	if err != nil {
+		return count, err
+	}
+	if err := a.cache.addChoice(field, Choice{Name: newName, Color: color}); err != nil {
+		return count, err
+	}
+	if err := a.cache.hideChoice(field, name); err != nil {
+		return count, err
+	}
+	logMessage("INFO", "Renamed %s option %s to %s in %d links", field, name, newName, count)
+	return count, nil
+}
+
+func (a *Airtable) deleteChoice(field string, name string) (int, error) {
+	if err := checkChoiceField(field); err != nil {
+		return 0, err
+	}
+	count, err := a.replaceChoice(field, name, nil)
+	if err != nil {
+		return count, err
+	}
+	if err := a.cache.hideChoice(field, name); err != nil {
+		return count, err
+	}
+	logMessage("INFO", "Deleted %s option %s from %d links", field, name, count)
+	return count, nil
+}
+
+func (a *Airtable) recolorChoice(field string, name string, color string) error {
+	if err := checkChoiceField(field); err != nil {
+		return err
+	}
+	if !slices.Contains(choiceColors, color) {
+		return fmt.Errorf("unknown color: %s", color)
+	}
+	if err := a.cache.setChoiceColor(field, name, color); err != nil {
+		return err
+	}
+	logMessage("INFO", "Recolored %s option %s to %s", field, name, color)
+	return nil
+}
@@ -316,3 +316,54 @@ func TestListToLinkCopier(t *testing.T) {
 	}
 	log.Println(*lc)
 }
+
+func TestResolveLinks(t *testing.T) {
+	airtable := &Airtable{cache: &Cache{file: ":memory:"}}
+	_ = airtable.cache.init()
+	_ = airtable.cache.saveLinks([]Link{
+		{Name: stringPtr("A"), URL: stringPtr("https://a.com"), ID: stringPtr("recAAAAAAAAAAAAAA")},
+		{Name: stringPtr("B"), URL: stringPtr("https://b.com"), ID: stringPtr("recBBBBBBBBBBBBBB")},
+	})
+
+	links, err := airtable.resolveLinks("recAAAAAAAAAAAAAA\n[B](https://b.com)")
+	if err != nil {
+		t.Errorf("resolveLinks() error = %v", err)
+	}
+	if len(links) != 2 {
+		t.Errorf("resolveLinks() returned %d links, expected 2", len(links))
+	}
+
+	_, err = airtable.resolveLinks("not a link")
+	if err == nil {
+		t.Errorf("resolveLinks() expected an error")
+	}
+}
+
+func TestSelection(t *testing.T) {
+	airtable := &Airtable{cache: &Cache{file: ":memory:"}}
+	_ = airtable.cache.init()
+	_ = airtable.cache.saveLinks([]Link{
+		{Name: stringPtr("A"), URL: stringPtr("https://a.com"), ID: stringPtr("recAAAAAAAAAAAAAA"), Tags: []string{"go"}},
+		{Name: stringPtr("B"), URL: stringPtr("https://b.com"), ID: stringPtr("recBBBBBBBBBBBBBB"), Tags: []string{"go"}},
+	})
+
+	// A link picked from a group is acted on alone
+	t.Setenv("groupBy", "Tags")
+	t.Setenv("group", "go")
+	t.Setenv("IDs", "recAAAAAAAAAAAAAA")
+	links, vars, err := airtable.getSelection()
+	if err != nil || len(links) != 1 || vars["IDs"] != "recAAAAAAAAAAAAAA" {
+		t.Errorf("getSelection() with IDs = %d links, %v, %v", len(links), vars, err)
+	}
+	t.Setenv("IDs", "")
+	if links, vars, _ = airtable.getSelection(); len(links) != 2 || vars["groupBy"] != "Tags" {
+		t.Errorf("getSelection() of a group = %d links, %v", len(links), vars)
+	}
+
+	// A link created since the last sync is not cached yet
+	t.Setenv("ID", "recCCCCCCCCCCCCCC")
+	links, err = airtable.actionLinks()
+	if err != nil || len(links) != 1 || *links[0].ID != "recCCCCCCCCCCCCCC" {
+		t.Errorf("actionLinks() = %v, %v", links, err)
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"maps"
 	"os"
@@ -72,18 +71,32 @@ func (i *Item) setVars(vars map[string]string) {
 }
 
 type Workflow struct {
-	Items     []Item            `json:"items,omitempty"`
-	Variables map[string]string `json:"variables,omitempty"`
+	Views     []View
+	Variables map[string]string
+	Rerun     *float64
+}
+
+// Ask Alfred to run the Script Filter again after some seconds
+func (w *Workflow) rerun(seconds float64) {
+	w.Rerun = &seconds
 }
 
 func (w *Workflow) addItem(item Item, prepend ...bool) {
+	w.addView(itemView(item), prepend...)
+}
+
+func (w *Workflow) addView(view View, prepend ...bool) {
 	if len(prepend) > 0 && prepend[0] {
-		w.Items = append([]Item{item}, w.Items...)
+		w.Views = append([]View{view}, w.Views...)
 	} else {
-		w.Items = append(w.Items, item)
+		w.Views = append(w.Views, view)
 	}
 }
 
+func alertIcon() *Icon {
+	return &Icon{Path: stringPtr(os.Getenv("alfred_preferences") + "/resources/AlertCautionIcon.icns")}
+}
+
 func (w *Workflow) warnEmpty(s ...string) {
 	title := "No Result Found"
 	if len(s) > 0 && s[0] != "" {
@@ -93,12 +106,11 @@ func (w *Workflow) warnEmpty(s ...string) {
 	if len(s) > 1 && s[1] != "" {
 		icon = s[1]
 	}
-	valid := false
-	w.Items = []Item{
+	w.Views = []View{
 		{
-			Title: title,
-			Valid: &valid,
-			Icon:  &Icon{Path: &icon},
+			Title:   title,
+			Icon:    icon,
+			Actions: []Action{{Valid: false}},
 		},
 	}
 }
@@ -117,11 +129,15 @@ func (w *Workflow) setVars(vars map[string]string) {
 	maps.Copy(w.Variables, vars)
 }
 
+// Print the items with the renderer of the front end, see render.go
 func (w *Workflow) output() {
-	jsonItems, err := json.MarshalIndent(w, "", "  ")
+	renderer, err := currentRenderer()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err.Error())
+	}
+	if err = renderer.render(os.Stdout, w); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err.Error())
 		return
 	}
-	fmt.Println(string(jsonItems))
+	fetchFaviconsInBackground()
 }
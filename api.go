@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"path"
 	"strings"
 	"time"
 
@@ -30,6 +31,7 @@ type Airtable struct {
 	auth    *Auth
 	dbPath  string
 	cache   *Cache
+	archive *Archive
 }
 
 type Record struct {
@@ -48,9 +50,12 @@ func (a *Airtable) init(skipAuth ...bool) error {
 	if err := a.cache.init(); err != nil {
 		return err
 	}
-	if len(skipAuth) > 0 && skipAuth[0] {
-	} else if err := a.getAuth(); err != nil {
-		return err
+	// The archive is opened on first use
+	a.archive = &Archive{file: path.Join(path.Dir(a.dbPath), "archive.db")}
+	if len(skipAuth) == 0 || !skipAuth[0] {
+		if err := a.getAuth(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -78,14 +83,17 @@ func (a *Airtable) fetchRecords(tableName string, params map[string]any) ([]Reco
 		return nil, err
 	}
 	req.Header.Add("Authorization", "Bearer "+a.auth.AccessToken)
+	call := newAPICall(req, tableName)
 
 	resp, err := client.Do(req)
 	if err != nil {
+		call.end(0, 0, err)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		call.end(resp.StatusCode, 0, fmt.Errorf("%s", resp.Status))
 		if resp.StatusCode == http.StatusUnauthorized {
 			_ = a.cache.setData("AccessToken", "")
 			_ = a.cache.setData("RefreshToken", "")
@@ -97,7 +105,9 @@ func (a *Airtable) fetchRecords(tableName string, params map[string]any) ([]Reco
 	}
 
 	var response Response
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	call.end(resp.StatusCode, len(response.Records), err)
+	if err != nil {
 		return nil, err
 	}
 
@@ -115,73 +125,110 @@ func (a *Airtable) fetchRecords(tableName string, params map[string]any) ([]Reco
 	return response.Records, nil
 }
 
-func (a *Airtable) fetchSchema() (*[]string, *[]string, error) {
+type Choice struct {
+	ID    *string `json:"id,omitempty"`
+	Name  string  `json:"name"`
+	Color *string `json:"color,omitempty"`
+}
+
+// Colors of select options in Airtable
+var choiceColors = []string{
+	"blueLight2", "cyanLight2", "tealLight2", "greenLight2", "yellowLight2", "orangeLight2", "redLight2", "pinkLight2", "purpleLight2", "grayLight2",
+	"blueLight1", "cyanLight1", "tealLight1", "greenLight1", "yellowLight1", "orangeLight1", "redLight1", "pinkLight1", "purpleLight1", "grayLight1",
+	"blueBright", "cyanBright", "tealBright", "greenBright", "yellowBright", "orangeBright", "redBright", "pinkBright", "purpleBright", "grayBright",
+	"blueDark1", "cyanDark1", "tealDark1", "greenDark1", "yellowDark1", "orangeDark1", "redDark1", "pinkDark1", "purpleDark1", "grayDark1",
+}
+
+type Field struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Options *struct {
+		Choices []Choice `json:"choices,omitempty"`
+	} `json:"options,omitempty"`
+}
+
+type Table struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	Fields []Field `json:"fields"`
+}
+
+func (a *Airtable) fetchTables() ([]Table, error) {
 	if err := throttle(); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	u := fmt.Sprintf("https://api.airtable.com/v0/meta/bases/%s/tables", a.baseID)
+	u := fmt.Sprintf("%s/meta/bases/%s/tables", a.baseURL, a.baseID)
 	client := &http.Client{}
 	req, err := http.NewRequest("GET", u, nil)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	req.Header.Add("Authorization", "Bearer "+a.auth.AccessToken)
+	call := newAPICall(req, "meta/tables")
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, nil, err
+		call.end(0, 0, err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, nil, fmt.Errorf("failed to fetch schema: %s", resp.Status)
+		call.end(resp.StatusCode, 0, fmt.Errorf("%s", resp.Status))
+		return nil, fmt.Errorf("failed to fetch schema: %s", resp.Status)
 	}
 
-	type MetaResponse struct {
-		Tables []struct {
-			Name   string `json:"name"`
-			Fields []struct {
-				Name    string `json:"name"`
-				Options *struct {
-					Choices *[]struct {
-						Name string `json:"name"`
-					} `json:"choices"`
-				} `json:"options"`
-			} `json:"fields"`
-		} `json:"tables"`
+	var response struct {
+		Tables []Table `json:"tables"`
 	}
-
-	var response MetaResponse
-	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, nil, err
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	call.end(resp.StatusCode, len(response.Tables), err)
+	if err != nil {
+		return nil, err
 	}
+	return response.Tables, nil
+}
 
-	tags := []string{}
-	categories := []string{}
-
-	for _, table := range response.Tables {
-		if table.Name == "Links" {
-			for _, field := range table.Fields {
-				switch field.Name {
-				case "Tags":
-					if field.Options != nil {
-						for _, choice := range *field.Options.Choices {
-							tags = append(tags, choice.Name)
-						}
-					}
-				case "Category":
-					if field.Options != nil {
-						for _, choice := range *field.Options.Choices {
-							categories = append(categories, choice.Name)
-						}
-					}
-				}
+// Fetch the select options of the Tags and Category fields in the Links table
+func (a *Airtable) fetchChoices() (map[string][]Choice, error) {
+	tables, err := a.fetchTables()
+	if err != nil {
+		return nil, err
+	}
+	choices := map[string][]Choice{}
+	for _, table := range tables {
+		if table.Name != "Links" {
+			continue
+		}
+		for _, field := range table.Fields {
+			if field.Name != "Tags" && field.Name != "Category" {
+				continue
+			}
+			choices[field.Name] = []Choice{}
+			if field.Options != nil {
+				choices[field.Name] = field.Options.Choices
 			}
 		}
 	}
+	logMessage("INFO", "Fetched %d tags and %d categories", len(choices["Tags"]), len(choices["Category"]))
+	return choices, nil
+}
 
-	logMessage("INFO", "Fetched %d tags and %d categories", len(tags), len(categories))
+func (a *Airtable) fetchSchema() (*[]string, *[]string, error) {
+	choices, err := a.fetchChoices()
+	if err != nil {
+		return nil, nil, err
+	}
+	tags := []string{}
+	for _, choice := range choices["Tags"] {
+		tags = append(tags, choice.Name)
+	}
+	categories := []string{}
+	for _, choice := range choices["Category"] {
+		categories = append(categories, choice.Name)
+	}
 	return &tags, &categories, nil
 }
 
@@ -234,14 +281,17 @@ func (a *Airtable) createRecordsBatch(tableName string, records *[]*Record) erro
 	}
 	req.Header.Add("Authorization", "Bearer "+a.auth.AccessToken)
 	req.Header.Add("Content-Type", "application/json")
+	call := newAPICall(req, tableName)
 
 	resp, err := client.Do(req)
 	if err != nil {
+		call.end(0, 0, err)
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		call.end(resp.StatusCode, 0, fmt.Errorf("%s", resp.Status))
 		// Read the response body to get more detailed error information
 		body, readErr := io.ReadAll(resp.Body)
 		if readErr != nil {
@@ -251,7 +301,9 @@ func (a *Airtable) createRecordsBatch(tableName string, records *[]*Record) erro
 	}
 
 	var response Response
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	call.end(resp.StatusCode, len(response.Records), err)
+	if err != nil {
 		return err
 	}
 
@@ -265,16 +317,42 @@ func (a *Airtable) createRecordsBatch(tableName string, records *[]*Record) erro
 }
 
 func (a *Airtable) updateRecords(tableName string, records *[]*Record) error {
-	if err := throttle(); err != nil {
-		return err
+	if records == nil || len(*records) == 0 {
+		return nil
 	}
-
 	for _, record := range *records {
 		if record == nil || record.ID == nil {
 			return fmt.Errorf("record with an ID is required for update")
 		}
 		record.CreatedTime = nil
 	}
+
+	// Airtable API limit: maximum 10 records per request
+	const batchSize = 10
+	allRecords := *records
+	updatedRecords := make([]*Record, 0, len(allRecords))
+
+	for i := 0; i < len(allRecords); i += batchSize {
+		end := min(i+batchSize, len(allRecords))
+
+		batch := allRecords[i:end]
+		err := a.updateRecordsBatch(tableName, &batch)
+		if err != nil {
+			return err
+		}
+
+		updatedRecords = append(updatedRecords, batch...)
+	}
+
+	*records = updatedRecords
+	return nil
+}
+
+func (a *Airtable) updateRecordsBatch(tableName string, records *[]*Record) error {
+	if err := throttle(); err != nil {
+		return err
+	}
+
 	u := fmt.Sprintf("%s/%s/%s", a.baseURL, a.baseID, tableName)
 	client := &http.Client{}
 
@@ -293,19 +371,24 @@ func (a *Airtable) updateRecords(tableName string, records *[]*Record) error {
 	}
 	req.Header.Add("Authorization", "Bearer "+a.auth.AccessToken)
 	req.Header.Add("Content-Type", "application/json")
+	call := newAPICall(req, tableName)
 
 	resp, err := client.Do(req)
 	if err != nil {
+		call.end(0, 0, err)
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		call.end(resp.StatusCode, 0, fmt.Errorf("%s", resp.Status))
 		return fmt.Errorf("failed to update records: %s", resp.Status)
 	}
 
 	var response Response
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	call.end(resp.StatusCode, len(response.Records), err)
+	if err != nil {
 		return err
 	}
 
@@ -319,6 +402,33 @@ func (a *Airtable) updateRecords(tableName string, records *[]*Record) error {
 }
 
 func (a *Airtable) deleteRecords(tableName string, records *[]*Record) error {
+	if records == nil || len(*records) == 0 {
+		return nil
+	}
+	for _, record := range *records {
+		if record == nil || record.ID == nil {
+			return fmt.Errorf("record with an ID is required for delete")
+		}
+	}
+
+	// Airtable API limit: maximum 10 records per request
+	const batchSize = 10
+	allRecords := *records
+
+	for i := 0; i < len(allRecords); i += batchSize {
+		end := min(i+batchSize, len(allRecords))
+
+		batch := allRecords[i:end]
+		err := a.deleteRecordsBatch(tableName, &batch)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *Airtable) deleteRecordsBatch(tableName string, records *[]*Record) error {
 	if err := throttle(); err != nil {
 		return err
 	}
@@ -326,9 +436,6 @@ func (a *Airtable) deleteRecords(tableName string, records *[]*Record) error {
 	u := fmt.Sprintf("%s/%s/%s", a.baseURL, a.baseID, tableName)
 	searchParams := []string{}
 	for _, record := range *records {
-		if record == nil || record.ID == nil {
-			return fmt.Errorf("record with an ID is required for delete")
-		}
 		searchParams = append(searchParams, fmt.Sprintf("records[]=%s", *record.ID))
 	}
 	u = u + "?" + strings.Join(searchParams, "&")
@@ -338,17 +445,21 @@ func (a *Airtable) deleteRecords(tableName string, records *[]*Record) error {
 		return err
 	}
 	req.Header.Add("Authorization", "Bearer "+a.auth.AccessToken)
+	call := newAPICall(req, tableName)
 
 	resp, err := client.Do(req)
 	if err != nil {
+		call.end(0, 0, err)
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		call.end(resp.StatusCode, 0, fmt.Errorf("%s", resp.Status))
 		return fmt.Errorf("failed to delete record: %s", resp.Status)
 	}
 
+	call.end(resp.StatusCode, len(*records), nil)
 	logMessage("INFO", "Deleted %d records", len(*records))
 	return nil
 }
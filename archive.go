@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Keep a local copy of the pages of links, in a separate database,
+// so that their content survives when the pages go away
+
+type Archive struct {
+	file string
+	db   *sql.DB
+}
+
+type ArchivedPage struct {
+	ID         string
+	URL        string
+	Title      *string
+	Text       string
+	HTML       string
+	ArchivedAt *time.Time
+	Error      *string
+}
+
+type ArchiveMatch struct {
+	ID      string
+	Snippet string
+}
+
+// Texts shorter than this are not worth compressing
+const compressMinSize = 256
+
+var registerArchiveDriver sync.Once
+
+// The text index is compressed with gzip through SQL functions
+func archiveDriver() string {
+	registerArchiveDriver.Do(func() {
+		sql.Register("sqlite3_archive", &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				if err := conn.RegisterFunc("gzip_compress", func(v any) (any, error) {
+					if s, ok := v.(string); ok && len(s) >= compressMinSize {
+						return gzipText(s)
+					}
+					return v, nil
+				}, true); err != nil {
+					return err
+				}
+				// NULL is passed as an empty []byte
+				return conn.RegisterFunc("gzip_uncompress", func(v any) (any, error) {
+					if b, ok := v.([]byte); ok {
+						if len(b) == 0 {
+							return nil, nil
+						}
+						return gunzipText(b)
+					}
+					return v, nil
+				}, true)
+			},
+		})
+	})
+	return "sqlite3_archive"
+}
+
+func gzipText(s string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipText(b []byte) (string, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	out, err := io.ReadAll(r)
+	return string(out), err
+}
+
+func (ar *Archive) init() error {
+	if ar.db != nil {
+		return nil
+	}
+	db, err := sql.Open(archiveDriver(), ar.file)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS Pages (
+		ID TEXT PRIMARY KEY,
+		URL TEXT,
+		HTML BLOB,
+		ArchivedAt DATETIME,
+		Error TEXT
+	);
+
+	CREATE VIRTUAL TABLE IF NOT EXISTS PageText USING fts4(
+		ID, Title, Text,
+		notindexed=ID, tokenize=unicode61, compress=gzip_compress, uncompress=gzip_uncompress
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	ar.db = db
+	return nil
+}
+
+// Save an archived page
+// A failure does not replace a copy archived before, which is kept for when the page is gone
+func (ar *Archive) save(page *ArchivedPage) error {
+	if err := ar.init(); err != nil {
+		return err
+	}
+	var html []byte
+	if page.Error != nil {
+		var kept bool
+		err := ar.db.QueryRow(`SELECT COUNT(*) > 0 FROM Pages WHERE ID = ? AND Error IS NULL`, page.ID).Scan(&kept)
+		if err != nil || kept {
+			return err
+		}
+	} else {
+		var err error
+		if html, err = gzipText(page.HTML); err != nil {
+			return err
+		}
+	}
+	tx, err := ar.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	_, err = tx.Exec(`
+	INSERT OR REPLACE INTO Pages (ID, URL, HTML, ArchivedAt, Error) VALUES (?, ?, ?, ?, ?)
+	`, page.ID, page.URL, html, page.ArchivedAt, page.Error)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM PageText WHERE ID = ?`, page.ID); err != nil {
+		return err
+	}
+	if page.Error == nil {
+		_, err = tx.Exec(`INSERT INTO PageText (ID, Title, Text) VALUES (?, ?, ?)`, page.ID, page.Title, page.Text)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Get an archived page, or nil if the link has not been archived
+func (ar *Archive) get(ID string) (*ArchivedPage, error) {
+	if err := ar.init(); err != nil {
+		return nil, err
+	}
+	page := ArchivedPage{ID: ID}
+	var html []byte
+	err := ar.db.QueryRow(`
+	SELECT URL, HTML, ArchivedAt, Error FROM Pages WHERE ID = ?
+	`, ID).Scan(&page.URL, &html, &page.ArchivedAt, &page.Error)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(html) > 0 {
+		if page.HTML, err = gunzipText(html); err != nil {
+			return nil, err
+		}
+	}
+	err = ar.db.QueryRow(`SELECT Title, Text FROM PageText WHERE ID = ?`, ID).Scan(&page.Title, &page.Text)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// When each link was archived, or last failed to be, without the content
+func (ar *Archive) status() (map[string]ArchivedPage, error) {
+	if err := ar.init(); err != nil {
+		return nil, err
+	}
+	rows, err := ar.db.Query(`SELECT ID, URL, ArchivedAt, Error FROM Pages`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	pages := map[string]ArchivedPage{}
+	for rows.Next() {
+		var page ArchivedPage
+		if err = rows.Scan(&page.ID, &page.URL, &page.ArchivedAt, &page.Error); err != nil {
+			return nil, err
+		}
+		pages[page.ID] = page
+	}
+	return pages, rows.Err()
+}
+
+func (ar *Archive) delete(ids []string) error {
+	if err := ar.init(); err != nil {
+		return err
+	}
+	for _, ID := range ids {
+		if _, err := ar.db.Exec(`DELETE FROM Pages WHERE ID = ?`, ID); err != nil {
+			return err
+		}
+		if _, err := ar.db.Exec(`DELETE FROM PageText WHERE ID = ?`, ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var ftsSpecialRe = regexp.MustCompile(`["*^():-]`)
+
+// Search the archived text; every word of the query must match, as a prefix
+func (ar *Archive) search(query string, limit int) ([]ArchiveMatch, error) {
+	if err := ar.init(); err != nil {
+		return nil, err
+	}
+	terms := []string{}
+	for _, word := range strings.Fields(ftsSpecialRe.ReplaceAllString(query, " ")) {
+		// Operators are only recognized in upper case
+		terms = append(terms, strings.ToLower(word)+"*")
+	}
+	if len(terms) == 0 {
+		return []ArchiveMatch{}, nil
+	}
+	rows, err := ar.db.Query(`
+	SELECT ID, snippet(PageText, '', '', '…', -1, 12) FROM PageText WHERE PageText MATCH ? LIMIT ?
+	`, strings.Join(terms, " "), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	matches := []ArchiveMatch{}
+	for rows.Next() {
+		var m ArchiveMatch
+		if err = rows.Scan(&m.ID, &m.Snippet); err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// Fetch the page of a link and archive its HTML and readable text
+func archivePage(link Link) *ArchivedPage {
+	now := time.Now().UTC()
+	page := ArchivedPage{ID: *link.ID, URL: *link.URL, ArchivedAt: &now}
+	body, finalURL, err := fetchPage(*link.URL)
+	if err != nil {
+		page.Error = stringPtr(err.Error())
+		return &page
+	}
+	page.HTML = string(body)
+	page.Title = parsePageMeta(bytes.NewReader(body), finalURL).Title
+	if page.Title == nil {
+		page.Title = link.Name
+	}
+	if page.Text, err = extractText(bytes.NewReader(body)); err != nil {
+		page.Error = stringPtr(err.Error())
+	}
+	return &page
+}
+
+// Archive the links that are not archived yet, or all of them if force is set
+// Failed pages are retried once they are older than CHECK_MAX_AGE
+// Returns the number of pages archived
+func (a *Airtable) archiveLinks(force bool) (int, error) {
+	links, err := a.cache.getLinks(nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	archived, err := a.archive.status()
+	if err != nil {
+		return 0, err
+	}
+
+	// Drop the pages of deleted links
+	ids := map[string]bool{}
+	for _, link := range links {
+		ids[*link.ID] = true
+	}
+	deleted := []string{}
+	for ID := range archived {
+		if !ids[ID] {
+			deleted = append(deleted, ID)
+		}
+	}
+	if err = a.archive.delete(deleted); err != nil {
+		return 0, err
+	}
+
+	jobs := []Link{}
+	for _, link := range links {
+		if link.URL == nil || !testURL(*link.URL) {
+			continue
+		}
+		if page, ok := archived[*link.ID]; ok && !force && page.URL == *link.URL {
+			if page.Error == nil || (page.ArchivedAt != nil && time.Since(*page.ArchivedAt) < checkMaxAge()) {
+				continue
+			}
+		}
+		jobs = append(jobs, link)
+	}
+
+	count := 0
+	crawl(jobs, func(link Link) string { return *link.URL }, archivePage, func(page *ArchivedPage) {
+		if err := a.archive.save(page); err != nil {
+			logMessage("ERROR", "Error archiving %s: %s", page.URL, err)
+		} else if page.Error == nil {
+			count++
+		}
+	})
+	logMessage("INFO", "Archived %d pages", count)
+	return count, nil
+}
+
+func (a *Airtable) archiveLink(ID string) error {
+	links, err := a.cache.getLinksByIDs([]string{ID})
+	if err != nil {
+		return err
+	}
+	if len(links) == 0 {
+		return fmt.Errorf("link %s not found", ID)
+	}
+	page := archivePage(links[0])
+	if err = a.archive.save(page); err != nil {
+		return err
+	}
+	if page.Error != nil {
+		return fmt.Errorf("failed to archive page: %s", *page.Error)
+	}
+	return nil
+}
+
+var headRe = regexp.MustCompile(`(?i)<head[^>]*>`)
+
+// Write an archived page to files that Quick Look and the browser can open:
+// the HTML, with a <base> so that relative links still work, and the readable text
+func (page *ArchivedPage) writeFiles() (string, string, error) {
+	dir := path.Join(os.Getenv("alfred_workflow_cache"), "archive")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", err
+	}
+	base := fmt.Sprintf(`<base href="%s">`, strings.ReplaceAll(page.URL, `"`, "%22"))
+	html := page.HTML
+	if loc := headRe.FindStringIndex(html); loc != nil {
+		html = html[:loc[1]] + base + html[loc[1]:]
+	} else {
+		html = base + html
+	}
+	htmlFile := path.Join(dir, page.ID+".html")
+	textFile := path.Join(dir, page.ID+".txt")
+	if err := os.WriteFile(htmlFile, []byte(html), 0o644); err != nil {
+		return "", "", err
+	}
+	text := page.Text
+	if page.Title != nil {
+		text = *page.Title + "\n" + page.URL + "\n\n" + text
+	}
+	if err := os.WriteFile(textFile, []byte(text), 0o644); err != nil {
+		return "", "", err
+	}
+	return htmlFile, textFile, nil
+}
+
+// Show the archived copy of a link
+func (a *Airtable) showArchive(ID string) {
+	wf := Workflow{}
+	page, err := a.archive.get(ID)
+	back := Item{
+		Title: "Go Back",
+		Icon:  &Icon{Path: stringPtr("media/back.png")},
+		Variables: map[string]string{
+			"ID":   "",
+			"mode": "list-links",
+		},
+	}
+	archiveItem := Item{
+		Title:    "Archive Now",
+		Subtitle: "Fetch the page and keep a local copy",
+		Icon:     &Icon{Path: stringPtr("media/save.png")},
+		Variables: map[string]string{
+			"ID":   ID,
+			"exec": "archive-link",
+		},
+	}
+	switch {
+	case err != nil:
+		wf.warnEmpty("Error: " + err.Error())
+	case page == nil:
+		archiveItem.Title = "Not Archived Yet"
+		wf.addItem(archiveItem)
+	case page.Error != nil:
+		archiveItem.Title = "Failed to Archive"
+		archiveItem.Subtitle = *page.Error + "  ·  Try again"
+		wf.addItem(archiveItem)
+	default:
+		htmlFile, textFile, err := page.writeFiles()
+		if err != nil {
+			wf.warnEmpty("Error: " + err.Error())
+			break
+		}
+		title := page.URL
+		if page.Title != nil {
+			title = *page.Title
+		}
+		archivedAt := page.ArchivedAt.Local().Format("2006-01-02 15:04")
+		wf.addItem(Item{
+			Title:        title,
+			Subtitle:     "Archived page  ·  " + archivedAt,
+			QuickLookURL: &htmlFile,
+			Icon:         &Icon{Path: stringPtr("media/link.png")},
+			Variables:    map[string]string{"URL": "file://" + htmlFile},
+		})
+		wf.addItem(Item{
+			Title:        "Readable Text",
+			Subtitle:     fmt.Sprintf("%d words  ·  %s", len(strings.Fields(page.Text)), archivedAt),
+			QuickLookURL: &textFile,
+			Icon:         &Icon{Path: stringPtr("media/note.png")},
+			Variables:    map[string]string{"URL": "file://" + textFile},
+		})
+		archiveItem.Title = "Archive Again"
+		wf.addItem(archiveItem)
+	}
+	wf.addItem(back)
+	wf.output()
+}
+
+// Search links by the text of their archived pages
+func (a *Airtable) searchArchive(query string) {
+	wf := Workflow{}
+	if query == "" {
+		archived, _ := a.archive.status()
+		wf.addItem(Item{
+			Title:    "Search Archived Pages",
+			Subtitle: fmt.Sprintf("Type to search the text of %d archived pages", len(archived)),
+			Valid:    boolPtr(false),
+			Icon:     &Icon{Path: stringPtr("media/note.png")},
+		})
+		wf.addItem(Item{
+			Title:    "Archive All Links",
+			Subtitle: "Keep a local copy of the pages that are not archived yet",
+			Icon:     &Icon{Path: stringPtr("media/save.png")},
+			Variables: map[string]string{
+				"exec": "archive-links",
+			},
+		})
+		wf.output()
+		return
+	}
+	matches, err := a.archive.search(query, 50)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+		wf.output()
+		return
+	}
+	ids := make([]string, len(matches))
+	snippets := map[string]string{}
+	for i, m := range matches {
+		ids[i] = m.ID
+		snippets[m.ID] = m.Snippet
+	}
+	links, err := a.cache.getLinksByIDs(ids)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+		wf.output()
+		return
+	}
+	for _, link := range links {
+		view := link.view()
+		view.Subtitle = collapseSpaces(snippets[*link.ID])
+		view.Match = ""
+		wf.addView(view)
+	}
+	if len(links) == 0 {
+		wf.warnEmpty("No Archived Pages Found")
+	}
+	wf.output()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	archive := &Archive{file: path.Join(t.TempDir(), "archive.db")}
+	now := time.Now().UTC()
+	text := strings.Repeat("Gophers like concurrency and channels. ", 20)
+	page := &ArchivedPage{
+		ID:         "recA",
+		URL:        "https://example.com/a",
+		Title:      stringPtr("About Gophers"),
+		Text:       text,
+		HTML:       "<html><body>" + text + "</body></html>",
+		ArchivedAt: &now,
+	}
+	if err := archive.save(page); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	_ = archive.save(&ArchivedPage{ID: "recB", URL: "https://example.com/b", Text: "Nothing to see", ArchivedAt: &now})
+
+	got, err := archive.get("recA")
+	if err != nil || got == nil {
+		t.Fatalf("get() = %v, %v", got, err)
+	}
+	if got.Text != text || got.HTML != page.HTML || got.Title == nil || *got.Title != "About Gophers" {
+		t.Errorf("get() returned a different page: %+v", got)
+	}
+	if missing, _ := archive.get("recC"); missing != nil {
+		t.Errorf("get() of a page not archived = %+v, want nil", missing)
+	}
+
+	matches, err := archive.search("gopher concurr", 10)
+	if err != nil {
+		t.Fatalf("search() error = %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != "recA" || !strings.Contains(matches[0].Snippet, "Gophers") {
+		t.Errorf("search() = %+v, expected recA", matches)
+	}
+	if matches, _ = archive.search(`NOT "zebra (`, 10); len(matches) != 0 {
+		t.Errorf("search() with special characters = %+v, expected no match", matches)
+	}
+
+	// A failure keeps the copy archived before
+	_ = archive.save(&ArchivedPage{ID: "recA", URL: "https://example.com/a", ArchivedAt: &now, Error: stringPtr("404 Not Found")})
+	if got, _ = archive.get("recA"); got == nil || got.Error != nil || got.Text != text {
+		t.Errorf("get() after a failure = %+v, expected the previous copy", got)
+	}
+
+	if err = archive.delete([]string{"recA"}); err != nil {
+		t.Fatalf("delete() error = %v", err)
+	}
+	status, _ := archive.status()
+	if len(status) != 1 || status["recB"].ID != "recB" {
+		t.Errorf("status() after delete = %+v, expected recB only", status)
+	}
+	if matches, _ = archive.search("gophers", 10); len(matches) != 0 {
+		t.Errorf("search() after delete = %+v, expected no match", matches)
+	}
+}
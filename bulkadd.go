@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Add many links at once from pasted text, markdown or HTML
+
+var htmlRe = regexp.MustCompile(`(?i)<(?:a|p|div|span|li|ul|ol|br|html|body|meta)\b[^>]*>`)
+
+// Every link of a text with its anchor text
+// HTML, as copied from a web page, is recognized by its tags
+func extractLinks(text string) []MDLink {
+	if htmlRe.MatchString(text) {
+		return extractHTMLLinks(text)
+	}
+	return extractMDLinks(text)
+}
+
+// The anchors of an HTML fragment, and the bare URLs of its text
+func extractHTMLLinks(text string) []MDLink {
+	links := []MDLink{}
+	z := html.NewTokenizer(strings.NewReader(text))
+	var anchor *MDLink
+	var anchorText strings.Builder
+	skip := 0
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			switch token.Data {
+			case "script", "style":
+				if tt == html.StartTagToken {
+					skip++
+				}
+			case "a":
+				anchor = nil
+				attrs := map[string]string{}
+				for _, attr := range token.Attr {
+					attrs[attr.Key] = strings.TrimSpace(attr.Val)
+				}
+				if testURL(attrs["href"]) {
+					// The title attribute is the text of anchors without text
+					anchor = &MDLink{URL: attrs["href"], Kind: "html", Context: attrs["title"]}
+				}
+				anchorText.Reset()
+			case "img":
+				if anchor != nil {
+					for _, attr := range token.Attr {
+						if attr.Key == "alt" {
+							anchorText.WriteString(" " + attr.Val + " ")
+						}
+					}
+				}
+			case "br", "p", "div", "li":
+				anchorText.WriteString(" ")
+			}
+		case html.EndTagToken:
+			switch name, _ := z.TagName(); string(name) {
+			case "script", "style":
+				skip = max(skip-1, 0)
+			case "a":
+				if anchor != nil {
+					anchor.Title = collapseSpaces(anchorText.String())
+					if anchor.Title == "" {
+						anchor.Title = anchor.Context
+					}
+					if anchor.Title == "" {
+						anchor.Title = anchor.URL
+					}
+					anchor.Context = ""
+					links = append(links, *anchor)
+				}
+				anchor = nil
+			}
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			if anchor != nil {
+				anchorText.WriteString(html.UnescapeString(string(z.Text())))
+			} else {
+				for _, link := range extractMDLinks(html.UnescapeString(string(z.Text()))) {
+					if link.Kind == "bare" {
+						link.Context = ""
+						links = append(links, link)
+					}
+				}
+			}
+		}
+	}
+}
+
+// The links of a text that are not saved yet, each URL once
+// Returns them and the number of links already saved
+func (a *Airtable) unsavedLinks(found []MDLink) ([]Link, int) {
+	links := []Link{}
+	saved := 0
+	seen := map[string]bool{}
+	for _, md := range found {
+		key := normalizeURL(md.URL)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if existing, _ := a.cache.getLinksByURL(md.URL); len(existing) > 0 {
+			saved++
+			continue
+		}
+		link := Link{Name: stringPtr(md.Title), URL: stringPtr(md.URL)}
+		if md.Title == "" {
+			link.Name = link.URL
+		}
+		links = append(links, link)
+	}
+	return links, saved
+}
+
+// Preview the links of a text and choose where to save them:
+// without a list, to a list matching the input, or to a new list named after the input
+func (a *Airtable) bulkAdd(text string, input string) {
+	wf := Workflow{}
+	links, saved := a.unsavedLinks(extractLinks(text))
+	if len(links) == 0 {
+		message := "No Links Found"
+		if saved > 0 {
+			message = fmt.Sprintf("All %d Links Are Already Saved", saved)
+		}
+		wf.warnEmpty(message)
+		wf.output()
+		return
+	}
+	summary := fmt.Sprintf("%d new links  ·  %d already saved", len(links), saved)
+	variables := func(listID string, newList string) map[string]string {
+		return map[string]string{
+			"text":    text,
+			"listID":  listID,
+			"newList": newList,
+			"exec":    "save-links",
+			"mode":    "",
+		}
+	}
+
+	if input == "" {
+		wf.addItem(Item{
+			Title:     fmt.Sprintf("Save %d Links Without a List", len(links)),
+			Subtitle:  summary + "  ·  Type to choose or create a list",
+			Icon:      &Icon{Path: stringPtr("media/save.png")},
+			Variables: variables("", ""),
+		})
+	}
+	lists, _ := a.cache.getLists(nil)
+	match := strings.ToLower(input)
+	exists := false
+	for _, list := range lists {
+		if strings.EqualFold(*list.Name, input) {
+			exists = true
+		}
+		if match != "" && !strings.Contains(strings.ToLower(*list.match()), match) {
+			continue
+		}
+		wf.addItem(Item{
+			Title:     fmt.Sprintf("Save %d Links to %s", len(links), *list.Name),
+			Subtitle:  summary,
+			Icon:      &Icon{Path: stringPtr("media/list.png")},
+			Variables: variables(*list.ID, ""),
+		})
+	}
+	if input != "" && !exists {
+		wf.addItem(Item{
+			Title:     fmt.Sprintf("Save %d Links to New List: %s", len(links), input),
+			Subtitle:  summary,
+			Icon:      &Icon{Path: stringPtr("media/add.png")},
+			Variables: variables("", input),
+		})
+	}
+	for _, link := range links {
+		wf.addItem(Item{
+			Title:        *link.Name,
+			Subtitle:     *link.URL,
+			QuickLookURL: link.URL,
+			Icon:         &Icon{Path: stringPtr("media/link.png")},
+			Valid:        boolPtr(false),
+		})
+	}
+	wf.setVar("text", text)
+	wf.setVar("mode", "bulk-add")
+	wf.output()
+}
+
+// Save every link of a text that is not saved yet, to a list, a new list or no list
+func (a *Airtable) saveBulkLinks(text string, listID string, newList string) (int, error) {
+	links, _ := a.unsavedLinks(extractLinks(text))
+	if len(links) == 0 {
+		return 0, fmt.Errorf("no new links found")
+	}
+	if newList != "" {
+		lists, err := a.cache.getLists(nil)
+		if err != nil {
+			return 0, err
+		}
+		if i := slices.IndexFunc(lists, func(l List) bool { return *l.Name == newList }); i >= 0 {
+			listID = *lists[i].ID
+		} else {
+			records := []*Record{{Fields: &map[string]any{"Name": newList}}}
+			if err = a.createRecords("Lists", &records); err != nil {
+				return 0, err
+			}
+			if err = a.cache.saveLists([]List{*records[0].toList()}); err != nil {
+				return 0, err
+			}
+			listID = *records[0].ID
+		}
+	}
+	records := make([]*Record, len(links))
+	for i, link := range links {
+		if listID != "" {
+			link.ListIDs = []string{listID}
+		}
+		record := link.toRecord()
+		records[i] = &record
+	}
+	if err := a.createRecords("Links", &records); err != nil {
+		return 0, err
+	}
+	created := make([]Link, len(records))
+	for i, record := range records {
+		created[i] = *record.toLink()
+	}
+	logMessage("INFO", "Saved %d links", len(created))
+	return len(created), a.cache.saveLinks(created)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			"chat",
+			"check this https://a.com/post and [B](https://b.com)\nalso <https://c.com>",
+			[]string{"https://a.com/post|https://a.com/post", "B|https://b.com", "https://c.com|https://c.com"},
+		},
+		{
+			"html",
+			`<p>Read <a href="https://a.com" title="Ignored">the <b>A</b>&amp;B post</a> or https://d.com.</p>
+<ul><li><a href="https://e.com" title="E site"></a></li><li><a href="https://f.com"><img alt="F logo" src="f.png"></a></li>
+<li><a href="/relative">Relative</a></li></ul><script>var u = "https://x.com"</script>`,
+			[]string{"the A&B post|https://a.com", "https://d.com|https://d.com", "E site|https://e.com", "F logo|https://f.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, link := range extractLinks(tt.text) {
+				got = append(got, link.Title+"|"+link.URL)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("extractLinks()\n got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveBulkLinks(t *testing.T) {
+	fake := &fakeAirtable{}
+	airtable := newTestAirtable(t, fake)
+	_ = airtable.cache.saveLinks([]Link{{ID: stringPtr("recSaved"), Name: stringPtr("Saved"), URL: stringPtr("https://saved.com")}})
+
+	text := ""
+	for i := range 12 {
+		text += fmt.Sprintf("- [Page %d](https://example.com/%d)\n", i, i)
+	}
+	text += "- https://www.saved.com/\n- [Again](https://example.com/1/)\n"
+	links, saved := airtable.unsavedLinks(extractLinks(text))
+	if len(links) != 12 || saved != 1 {
+		t.Errorf("unsavedLinks() = %d links, %d saved, want 12 and 1", len(links), saved)
+	}
+
+	count, err := airtable.saveBulkLinks(text, "", "Pasted")
+	if err != nil || count != 12 {
+		t.Fatalf("saveBulkLinks() = %d, %v, want 12", count, err)
+	}
+	lists, _ := airtable.cache.getLists(nil)
+	if len(lists) != 1 || *lists[0].Name != "Pasted" || len(lists[0].LinkIDs) != 12 {
+		t.Errorf("lists = %+v, want Pasted with 12 links", lists)
+	}
+	// Everything is saved now
+	if _, err = airtable.saveBulkLinks(text, "", ""); err == nil {
+		t.Error("saveBulkLinks() of saved links error = nil")
+	}
+}
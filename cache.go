@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -38,6 +39,14 @@ type List struct {
 	ID           *string    `json:"ID,omitempty"`
 }
 
+// Links grouped by a tag, a category or a domain
+type Group struct {
+	Name      string
+	Done      int
+	ToDo      int
+	LastAdded *time.Time
+}
+
 type Cache struct {
 	file         string
 	db           *sql.DB
@@ -88,13 +97,54 @@ func (c *Cache) init() error {
 			RecordURL TEXT,
 			ID TEXT PRIMARY KEY
 		);
+
+		CREATE TABLE IF NOT EXISTS Pages (
+			URL TEXT PRIMARY KEY,
+			Title TEXT,
+			Description TEXT,
+			Canonical TEXT,
+			Image TEXT,
+			SiteName TEXT,
+			StartedAt DATETIME,
+			FetchedAt DATETIME,
+			Error TEXT
+		);
+
+		CREATE TABLE IF NOT EXISTS Choices (
+			Field TEXT,
+			Name TEXT,
+			ID TEXT,
+			Color TEXT,
+			CustomColor TEXT,
+			Hidden BOOLEAN DEFAULT FALSE,
+			PRIMARY KEY (Field, Name)
+		);
   `
 		_, err = db.Exec(createTableQuery)
 		if err != nil {
 			return err
 		}
+		err = addColumns(db, "Links", [][2]string{
+			{"NormalizedURL", "TEXT"},
+			{"Status", "INTEGER"},
+			{"FinalURL", "TEXT"},
+			{"CheckedAt", "DATETIME"},
+			{"CheckError", "TEXT"},
+		})
+		if err != nil {
+			return err
+		}
+		err = addColumns(db, "Lists", [][2]string{
+			{"LinkOrder", "TEXT"},
+		})
+		if err != nil {
+			return err
+		}
 
 		c.db = db
+		if err = c.normalizeURLs(); err != nil {
+			return err
+		}
 	}
 
 	if str, _ := c.getData("LastSyncedAt"); str != nil {
@@ -173,6 +223,130 @@ func (c *Cache) getLinks(list *List, linkID *string) ([]Link, error) {
 	return links, nil
 }
 
+// Get the links that belong to a group
+func (c *Cache) getGroupLinks(by string, name string) ([]Link, error) {
+	links, err := c.getLinks(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var groupLinks []Link
+	for _, link := range links {
+		if slices.Contains(link.groupKeys(by), name) {
+			groupLinks = append(groupLinks, link)
+		}
+	}
+	return groupLinks, nil
+}
+
+// Get the links with the given IDs
+func (c *Cache) getLinksByIDs(ids []string) ([]Link, error) {
+	links, err := c.getLinks(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var found []Link
+	for _, link := range links {
+		if slices.Contains(ids, *link.ID) {
+			found = append(found, link)
+		}
+	}
+	return found, nil
+}
+
+// Get the link saved with the URL
+func (c *Cache) getLinkByURL(URL string) (*Link, error) {
+	links, err := c.getLinksByURL(URL)
+	if err != nil || len(links) == 0 {
+		return nil, err
+	}
+	return &links[0], nil
+}
+
+// Get the links saved with the same URL once normalized
+func (c *Cache) getLinksByURL(URL string) ([]Link, error) {
+	err := c.init()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.db.Query(`SELECT ID FROM Links WHERE NormalizedURL = ?`, normalizeURL(URL))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return c.getLinksByIDs(ids)
+}
+
+// Delete records from the database by their IDs
+func (c *Cache) deleteRecords(table string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := c.init()
+	if err != nil {
+		return err
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	_, err = c.db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE ID IN (%s)`, table, placeholders), args...)
+	if err != nil {
+		return err
+	}
+	logMessage("INFO", "Deleted %d records from %s", len(ids), table)
+	return nil
+}
+
+// Group the links by tag, category or domain
+// Groups are sorted by the number of links
+func (c *Cache) getGroups(by string) ([]Group, error) {
+	links, err := c.getLinks(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	groupsMap := map[string]*Group{}
+	for _, link := range links {
+		for _, key := range link.groupKeys(by) {
+			group, ok := groupsMap[key]
+			if !ok {
+				group = &Group{Name: key}
+				groupsMap[key] = group
+			}
+			if link.Done {
+				group.Done++
+			} else {
+				group.ToDo++
+			}
+			if link.Created != nil && (group.LastAdded == nil || link.Created.After(*group.LastAdded)) {
+				group.LastAdded = link.Created
+			}
+		}
+	}
+	groups := make([]Group, 0, len(groupsMap))
+	for _, group := range groupsMap {
+		groups = append(groups, *group)
+	}
+	slices.SortFunc(groups, func(a, b Group) int {
+		if n := (b.Done + b.ToDo) - (a.Done + a.ToDo); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return groups, nil
+}
+
 func (c *Cache) getLists(list *List) ([]List, error) {
 	err := c.init()
 	if err != nil {
@@ -238,6 +412,7 @@ func (c *Cache) getLists(list *List) ([]List, error) {
 
 // Save links to the database
 // If a link with the ID already exists, update it
+// The results of the last health check are kept unless the URL has changed
 func (c *Cache) saveLinks(links []Link) error {
 	err := c.init()
 	if err != nil {
@@ -245,19 +420,31 @@ func (c *Cache) saveLinks(links []Link) error {
 	}
 
 	insertQuery := `
-  INSERT OR REPLACE INTO Links (
-    Name, Note, URL, Category, Tags, Created, LastModified, RecordURL, ID, Done, ListIDs
-  ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+  INSERT INTO Links (
+    Name, Note, URL, Category, Tags, Created, LastModified, RecordURL, ID, Done, ListIDs, NormalizedURL
+  ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+  ON CONFLICT (ID) DO UPDATE SET
+    Name = excluded.Name, Note = excluded.Note, URL = excluded.URL, Category = excluded.Category,
+    Tags = excluded.Tags, Created = excluded.Created, LastModified = excluded.LastModified,
+    RecordURL = excluded.RecordURL, Done = excluded.Done, ListIDs = excluded.ListIDs,
+    NormalizedURL = excluded.NormalizedURL,
+    Status = CASE WHEN Links.URL IS excluded.URL THEN Links.Status END,
+    FinalURL = CASE WHEN Links.URL IS excluded.URL THEN Links.FinalURL END,
+    CheckedAt = CASE WHEN Links.URL IS excluded.URL THEN Links.CheckedAt END,
+    CheckError = CASE WHEN Links.URL IS excluded.URL THEN Links.CheckError END
   `
 	for _, link := range links {
-		var tags, listIDs string
+		var tags, listIDs, normalizedURL string
 		if link.Tags != nil {
 			tags = strings.Join(link.Tags, ",")
 		}
 		if link.ListIDs != nil {
 			listIDs = strings.Join(link.ListIDs, ",")
 		}
-		_, err = c.db.Exec(insertQuery, link.Name, link.Note, link.URL, link.Category, tags, link.Created, link.LastModified, link.RecordURL, link.ID, link.Done, listIDs)
+		if link.URL != nil {
+			normalizedURL = normalizeURL(*link.URL)
+		}
+		_, err = c.db.Exec(insertQuery, link.Name, link.Note, link.URL, link.Category, tags, link.Created, link.LastModified, link.RecordURL, link.ID, link.Done, listIDs, normalizedURL)
 		if err != nil {
 			return err
 		}
@@ -272,13 +459,14 @@ func (c *Cache) saveLists(lists []List) error {
 		return err
 	}
 
+	// LinkOrder keeps the order of the links in the list, which the join in getLists loses
 	insertQuery := `
 	INSERT OR REPLACE INTO Lists (
-		Name, Note, Created, LastModified, RecordURL, ID
-	) VALUES (?, ?, ?, ?, ?, ?)
+		Name, Note, Created, LastModified, RecordURL, ID, LinkOrder
+	) VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
 	for _, list := range lists {
-		_, err = c.db.Exec(insertQuery, list.Name, list.Note, list.Created, list.LastModified, list.RecordURL, list.ID)
+		_, err = c.db.Exec(insertQuery, list.Name, list.Note, list.Created, list.LastModified, list.RecordURL, list.ID, strings.Join(list.LinkIDs, ","))
 		if err != nil {
 			return err
 		}
@@ -287,6 +475,26 @@ func (c *Cache) saveLists(lists []List) error {
 	return nil
 }
 
+// The IDs of the links of a list, in the order set in Airtable
+func (c *Cache) getLinkOrder(listID string) ([]string, error) {
+	err := c.init()
+	if err != nil {
+		return nil, err
+	}
+	var order sql.NullString
+	err = c.db.QueryRow(`SELECT LinkOrder FROM Lists WHERE ID = ?`, listID).Scan(&order)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !order.Valid || order.String == "" {
+		return nil, nil
+	}
+	return strings.Split(order.String, ","), nil
+}
+
 // Delete records from the database whose IDs are not in the list of IDs
 func (c *Cache) clearDeletedRecords(table string, ids []string) error {
 	if len(ids) == 0 {
@@ -340,6 +548,63 @@ func (c *Cache) clearDeletedRecords(table string, ids []string) error {
 	return nil
 }
 
+// Add the columns that were introduced after a table was created
+func addColumns(db *sql.DB, table string, columns [][2]string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	_ = rows.Close()
+	for _, column := range columns {
+		if existing[column[0]] {
+			continue
+		}
+		if _, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column[0], column[1])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recompute the normalized URLs when the URL rules have changed
+func (c *Cache) normalizeURLs() error {
+	hash := getURLRules().hash()
+	if current, _ := c.getData("URLRules"); current != nil && *current == hash {
+		return nil
+	}
+	rows, err := c.db.Query(`SELECT ID, URL FROM Links`)
+	if err != nil {
+		return err
+	}
+	normalized := map[string]string{}
+	for rows.Next() {
+		var id string
+		var URL sql.NullString
+		if err = rows.Scan(&id, &URL); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		normalized[id] = normalizeURL(URL.String)
+	}
+	_ = rows.Close()
+	for id, URL := range normalized {
+		if _, err = c.db.Exec(`UPDATE Links SET NormalizedURL = ? WHERE ID = ?`, URL, id); err != nil {
+			return err
+		}
+	}
+	logMessage("INFO", "Normalized %d URLs", len(normalized))
+	return c.setData("URLRules", hash)
+}
+
 func (c *Cache) setData(key string, value string) error {
 	insertQuery := `
   INSERT OR REPLACE INTO Metadata (Key, Value) VALUES (?, ?)
@@ -372,6 +637,8 @@ func (c *Cache) clearCache() error {
   DELETE FROM Metadata;
   DELETE FROM Links;
   DELETE FROM Lists;
+  DELETE FROM Choices;
+  DELETE FROM Pages;
   `
 	_, err := c.db.Exec(deleteQuery)
 	if err != nil {
@@ -381,3 +648,171 @@ func (c *Cache) clearCache() error {
 	logMessage("INFO", "Cleared cache")
 	return nil
 }
+
+// Save the select options of a field fetched from the schema
+// Local changes (custom colors, hidden options) are kept,
+// options created locally are kept until they show up in the schema
+func (c *Cache) saveChoices(field string, choices []Choice) error {
+	err := c.init()
+	if err != nil {
+		return err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	names := []any{field}
+	for _, choice := range choices {
+		_, err = tx.Exec(`
+		INSERT INTO Choices (Field, Name, ID, Color) VALUES (?, ?, ?, ?)
+		ON CONFLICT (Field, Name) DO UPDATE SET ID = excluded.ID, Color = excluded.Color
+		`, field, choice.Name, choice.ID, choice.Color)
+		if err != nil {
+			return err
+		}
+		names = append(names, choice.Name)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(names)-1), ",")
+	deleteQuery := `DELETE FROM Choices WHERE Field = ? AND ID IS NOT NULL`
+	if placeholders != "" {
+		deleteQuery += ` AND Name NOT IN (` + placeholders + `)`
+	}
+	if _, err = tx.Exec(deleteQuery, names...); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	logMessage("INFO", "Saved %d choices of %s", len(choices), field)
+	return nil
+}
+
+// Get the visible select options of a field
+func (c *Cache) getChoices(field string) ([]Choice, error) {
+	err := c.init()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.Query(`
+	SELECT Name, ID, COALESCE(CustomColor, Color) FROM Choices
+	WHERE Field = ? AND NOT Hidden
+	ORDER BY rowid
+	`, field)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var choices []Choice
+	for rows.Next() {
+		var choice Choice
+		if err = rows.Scan(&choice.Name, &choice.ID, &choice.Color); err != nil {
+			return nil, err
+		}
+		choices = append(choices, choice)
+	}
+	return choices, nil
+}
+
+func (c *Cache) getChoiceNames(field string) []string {
+	choices, _ := c.getChoices(field)
+	names := make([]string, len(choices))
+	for i, choice := range choices {
+		names[i] = choice.Name
+	}
+	return names
+}
+
+// Add a select option locally, or unhide it if it exists
+func (c *Cache) addChoice(field string, choice Choice) error {
+	_, err := c.db.Exec(`
+	INSERT INTO Choices (Field, Name, ID, Color, CustomColor, Hidden) VALUES (?, ?, NULL, NULL, ?, FALSE)
+	ON CONFLICT (Field, Name) DO UPDATE SET Hidden = FALSE, CustomColor = COALESCE(excluded.CustomColor, CustomColor)
+	`, field, choice.Name, choice.Color)
+	return err
+}
+
+func (c *Cache) hideChoice(field string, name string) error {
+	_, err := c.db.Exec(`UPDATE Choices SET Hidden = TRUE WHERE Field = ? AND Name = ?`, field, name)
+	return err
+}
+
+func (c *Cache) setChoiceColor(field string, name string, color string) error {
+	_, err := c.db.Exec(`UPDATE Choices SET CustomColor = ? WHERE Field = ? AND Name = ?`, color, field, name)
+	return err
+}
+
+// Get the metadata of a page
+// FetchedAt is nil while the page is being fetched
+func (c *Cache) getPageMeta(URL string) (*PageMeta, *time.Time, error) {
+	meta := PageMeta{URL: URL}
+	var startedAt *time.Time
+	err := c.db.QueryRow(`
+	SELECT Title, Description, Canonical, Image, SiteName, StartedAt, FetchedAt, Error FROM Pages WHERE URL = ?
+	`, URL).Scan(&meta.Title, &meta.Description, &meta.Canonical, &meta.Image, &meta.SiteName, &startedAt, &meta.FetchedAt, &meta.Error)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &meta, startedAt, nil
+}
+
+// Mark a page as being fetched
+func (c *Cache) startPageFetch(URL string) error {
+	_, err := c.db.Exec(`
+	INSERT INTO Pages (URL, StartedAt) VALUES (?, ?)
+	ON CONFLICT (URL) DO UPDATE SET StartedAt = excluded.StartedAt, FetchedAt = NULL, Error = NULL
+	`, URL, time.Now())
+	return err
+}
+
+func (c *Cache) savePageMeta(meta *PageMeta) error {
+	_, err := c.db.Exec(`
+	INSERT OR REPLACE INTO Pages (URL, Title, Description, Canonical, Image, SiteName, StartedAt, FetchedAt, Error)
+	VALUES (?, ?, ?, ?, ?, ?, (SELECT StartedAt FROM Pages WHERE URL = ?), ?, ?)
+	`, meta.URL, meta.Title, meta.Description, meta.Canonical, meta.Image, meta.SiteName, meta.URL, meta.FetchedAt, meta.Error)
+	if err != nil {
+		logMessage("ERROR", "Error saving metadata of %s: %s", meta.URL, err)
+	}
+	return err
+}
+
+// Get the results of the last health check of all links
+// Links that were never checked have a nil CheckedAt
+func (c *Cache) getLinkHealth() ([]LinkHealth, error) {
+	err := c.init()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.db.Query(`
+	SELECT ID, URL, Status, FinalURL, CheckedAt, CheckError FROM Links WHERE URL IS NOT NULL AND URL != ''
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	health := []LinkHealth{}
+	for rows.Next() {
+		var h LinkHealth
+		var status sql.NullInt64
+		if err = rows.Scan(&h.ID, &h.URL, &status, &h.FinalURL, &h.CheckedAt, &h.Error); err != nil {
+			return nil, err
+		}
+		h.Status = int(status.Int64)
+		health = append(health, h)
+	}
+	return health, rows.Err()
+}
+
+func (c *Cache) saveLinkHealth(h *LinkHealth) error {
+	_, err := c.db.Exec(`
+	UPDATE Links SET Status = ?, FinalURL = ?, CheckedAt = ?, CheckError = ? WHERE ID = ? AND URL = ?
+	`, h.Status, h.FinalURL, h.CheckedAt, h.Error, h.ID, h.URL)
+	if err != nil {
+		logMessage("ERROR", "Error saving health of %s: %s", h.URL, err)
+	}
+	return err
+}
@@ -298,3 +298,155 @@ func TestClearCache(t *testing.T) {
 		t.Errorf("getLinks() returned %d links, expected 0", len(links))
 	}
 }
+
+func TestSaveChoices(t *testing.T) {
+	cache := &Cache{file: ":memory:"}
+	_ = cache.init()
+
+	choices := []Choice{
+		{ID: stringPtr("sel1"), Name: "go", Color: stringPtr("blueLight2")},
+		{ID: stringPtr("sel2"), Name: "rust", Color: stringPtr("redLight2")},
+	}
+	err := cache.saveChoices("Tags", choices)
+	if err != nil {
+		t.Errorf("saveChoices() error = %v", err)
+	}
+
+	_ = cache.addChoice("Tags", Choice{Name: "zig"})
+	_ = cache.hideChoice("Tags", "rust")
+	_ = cache.setChoiceColor("Tags", "go", "greenBright")
+
+	// A sync drops removed options but keeps local changes
+	err = cache.saveChoices("Tags", choices[:1])
+	if err != nil {
+		t.Errorf("saveChoices() error = %v", err)
+	}
+	got, err := cache.getChoices("Tags")
+	if err != nil {
+		t.Errorf("getChoices() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("getChoices() returned %d choices, expected 2", len(got))
+	}
+	if got[0].Name != "go" || *got[0].Color != "greenBright" {
+		t.Errorf("getChoices() returned %s (%v), expected 'go' (greenBright)", got[0].Name, got[0].Color)
+	}
+	if got[1].Name != "zig" || got[1].ID != nil {
+		t.Errorf("getChoices() returned %s, expected local option 'zig'", got[1].Name)
+	}
+	if names := cache.getChoiceNames("Category"); len(names) != 0 {
+		t.Errorf("getChoiceNames() returned %v, expected none", names)
+	}
+}
+
+func TestGetGroups(t *testing.T) {
+	cache := &Cache{file: ":memory:"}
+	_ = cache.init()
+
+	now := time.Now()
+	links := []Link{
+		{Name: stringPtr("A"), URL: stringPtr("https://www.A.com/x"), ID: stringPtr("recA"), Tags: []string{"go", "web"}, Created: &now, Done: true},
+		{Name: stringPtr("B"), URL: stringPtr("https://b.com"), ID: stringPtr("recB"), Tags: []string{"go"}, Created: &now},
+		{Name: stringPtr("C"), URL: stringPtr("https://c.com"), ID: stringPtr("recC"), Category: stringPtr("article"), Created: &now},
+	}
+	_ = cache.saveLinks(links)
+
+	groups, err := cache.getGroups("Tags")
+	if err != nil {
+		t.Errorf("getGroups() error = %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("getGroups() returned %d groups, expected 2", len(groups))
+	}
+	if groups[0].Name != "go" || groups[0].Done != 1 || groups[0].ToDo != 1 {
+		t.Errorf("getGroups() returned %+v, expected go with 1 done and 1 to do", groups[0])
+	}
+
+	groups, _ = cache.getGroups("Domain")
+	if len(groups) != 3 || groups[0].Name != "a.com" {
+		t.Errorf("getGroups() returned %+v, expected 3 domains", groups)
+	}
+
+	groupLinks, err := cache.getGroupLinks("Category", "article")
+	if err != nil {
+		t.Errorf("getGroupLinks() error = %v", err)
+	}
+	if len(groupLinks) != 1 || *groupLinks[0].ID != "recC" {
+		t.Errorf("getGroupLinks() returned %d links, expected recC", len(groupLinks))
+	}
+}
+
+func TestCacheDeleteRecords(t *testing.T) {
+	cache := &Cache{file: ":memory:"}
+	_ = cache.init()
+
+	links := []Link{
+		{Name: stringPtr("A"), URL: stringPtr("https://a.com"), ID: stringPtr("recA")},
+		{Name: stringPtr("B"), URL: stringPtr("https://b.com"), ID: stringPtr("recB")},
+	}
+	_ = cache.saveLinks(links)
+
+	link, err := cache.getLinkByURL("https://b.com")
+	if err != nil || link == nil || *link.ID != "recB" {
+		t.Errorf("getLinkByURL() returned %v, %v, expected recB", link, err)
+	}
+
+	err = cache.deleteRecords("Links", []string{"recA"})
+	if err != nil {
+		t.Errorf("deleteRecords() error = %v", err)
+	}
+	found, _ := cache.getLinksByIDs([]string{"recA", "recB"})
+	if len(found) != 1 || *found[0].ID != "recB" {
+		t.Errorf("getLinksByIDs() returned %d links, expected recB", len(found))
+	}
+}
+
+func TestGetLinksByURL(t *testing.T) {
+	cache := &Cache{file: ":memory:"}
+	_ = cache.init()
+
+	_ = cache.saveLinks([]Link{
+		{Name: stringPtr("A"), URL: stringPtr("https://www.example.com/post/?utm_source=x"), ID: stringPtr("recA")},
+		{Name: stringPtr("B"), URL: stringPtr("https://example.com/other"), ID: stringPtr("recB")},
+	})
+
+	links, err := cache.getLinksByURL("http://example.com/post#top")
+	if err != nil {
+		t.Errorf("getLinksByURL() error = %v", err)
+	}
+	if len(links) != 1 || *links[0].ID != "recA" {
+		t.Errorf("getLinksByURL() returned %d links, expected recA", len(links))
+	}
+}
+
+func TestLinkHealth(t *testing.T) {
+	cache := &Cache{file: ":memory:"}
+	_ = cache.init()
+
+	link := Link{Name: stringPtr("A"), URL: stringPtr("https://example.com/a"), ID: stringPtr("recA")}
+	_ = cache.saveLinks([]Link{link})
+	now := time.Now().UTC()
+	err := cache.saveLinkHealth(&LinkHealth{ID: "recA", URL: "https://example.com/a", Status: 404, CheckedAt: &now})
+	if err != nil {
+		t.Fatalf("saveLinkHealth() error = %v", err)
+	}
+
+	// A sync with the same URL keeps the result
+	link.Name = stringPtr("A2")
+	_ = cache.saveLinks([]Link{link})
+	health, err := cache.getLinkHealth()
+	if err != nil {
+		t.Fatalf("getLinkHealth() error = %v", err)
+	}
+	if len(health) != 1 || health[0].Status != 404 || health[0].CheckedAt == nil {
+		t.Errorf("getLinkHealth() = %+v, expected status 404 to be kept", health)
+	}
+
+	// A new URL must be checked again
+	link.URL = stringPtr("https://example.com/b")
+	_ = cache.saveLinks([]Link{link})
+	health, _ = cache.getLinkHealth()
+	if len(health) != 1 || health[0].Status != 0 || health[0].CheckedAt != nil {
+		t.Errorf("getLinkHealth() = %+v, expected the result to be reset", health)
+	}
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Subcommands for the terminal and scripts, used when no Alfred mode is set
+// They read the cache like the Alfred modes; run sync first to refresh it
+// Exit codes: 0 on success, 1 on errors, 2 on usage errors
+
+const cliUsage = `Usage: %s <command> [flags]
+
+Commands:
+  links list    [--tag T] [--category C] [--domain D] [--list ID] [--done=BOOL] [--query TEXT] [--format table|json|jsonl]
+  links add     URL [--title T] [--tag T]... [--category C] [--list ID]... [--note N]
+  links done    ID|URL...
+  links delete  ID|URL...
+  lists list    [--format table|json|jsonl]
+  lists show    ID [--format table|json|jsonl]
+  sync          [--force]
+  export        [--format html|csv|jsonl|opml] [--list ID] [--tag T] [--done=BOOL] [--output FILE]
+  serve         [--addr ADDR]
+  native-host   manifest|install --extension ID... [--browser chrome|chromium|brave|edge|firefox] [--dir DIR]
+  doctor        [--fix sign-in|resync|reset-cache|clear-logs]
+`
+
+// An error in the arguments, shown with the usage
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+func usagef(format string, args ...any) error {
+	return usageError{fmt.Sprintf(format, args...)}
+}
+
+// A flag that is unset, true or false
+type optionalBool struct {
+	value *bool
+}
+
+func (b *optionalBool) String() string {
+	if b.value == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b.value)
+}
+
+func (b *optionalBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	b.value = &v
+	return nil
+}
+
+func (b *optionalBool) IsBoolFlag() bool {
+	return true
+}
+
+// A flag that can be repeated
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// Parse flags placed before or after the arguments
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		} else if err != nil {
+			return nil, usageError{err.Error()}
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// Run a subcommand and return the exit code
+func runCLI(a *Airtable, args []string, stdout io.Writer, stderr io.Writer) int {
+	err := a.cli(args, stdout)
+	var usage usageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		fmt.Fprintf(stdout, cliUsage, filepath.Base(os.Args[0]))
+		return 0
+	case errors.As(err, &usage):
+		fmt.Fprintln(stderr, "Error:", err)
+		fmt.Fprintf(stderr, cliUsage, filepath.Base(os.Args[0]))
+		return 2
+	default:
+		fmt.Fprintln(stderr, "Error:", err)
+		return 1
+	}
+}
+
+func (a *Airtable) cli(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return usagef("a command is required")
+	}
+	command, args := args[0], args[1:]
+	sub := ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	switch command {
+	case "help", "-h", "--help":
+		return flag.ErrHelp
+	case "links":
+		switch sub {
+		case "list":
+			return a.cliListLinks(args[1:], w)
+		case "add":
+			return a.cliAddLink(args[1:], w)
+		case "done", "delete":
+			return a.cliUpdateLinks(sub, args[1:], w)
+		}
+		return usagef("unknown links command: %q", sub)
+	case "lists":
+		switch sub {
+		case "list":
+			return a.cliListLists(args[1:], w)
+		case "show":
+			return a.cliShowList(args[1:], w)
+		}
+		return usagef("unknown lists command: %q", sub)
+	case "sync":
+		return a.cliSync(args, w)
+	case "export":
+		return a.cliExport(args, w)
+	case "serve":
+		return a.cliServe(args, w)
+	case "native-host":
+		return a.cliNativeHost(args, w)
+	case "doctor":
+		return a.cliDoctor(args, w)
+	}
+	return usagef("unknown command: %q", command)
+}
+
+// Write records as an aligned table, a JSON array or JSON lines
+func writeRecords[T any](w io.Writer, format string, records []T, header []string, row func(T) []string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		for _, record := range records {
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, record := range records {
+			fmt.Fprintln(tw, strings.Join(row(record), "\t"))
+		}
+		return tw.Flush()
+	}
+	return usagef("unknown format: %q", format)
+}
+
+func linkRow(link Link) []string {
+	done := ""
+	if link.Done {
+		done = "✓"
+	}
+	return []string{*link.ID, done, *link.Name, *link.URL, strings.Join(link.Tags, ",")}
+}
+
+var linkHeader = []string{"ID", "DONE", "NAME", "URL", "TAGS"}
+
+func (a *Airtable) cliListLinks(args []string, w io.Writer) error {
+	fs := newFlagSet("links list")
+	tag := fs.String("tag", "", "")
+	category := fs.String("category", "", "")
+	domain := fs.String("domain", "", "")
+	listID := fs.String("list", "", "")
+	text := fs.String("query", "", "")
+	format := fs.String("format", "table", "")
+	var done optionalBool
+	fs.Var(&done, "done", "")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usagef("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+
+	links, err := a.cache.getLinks(nil, nil)
+	if err != nil {
+		return err
+	}
+	query := LinkQuery{Tag: *tag, Category: *category, Domain: *domain, ListID: *listID, Query: *text, Done: done.value}
+	links = query.filter(links)
+	return writeRecords(w, *format, links, linkHeader, linkRow)
+}
+
+// The filters of links, shared by the links list command and the server
+type LinkQuery struct {
+	Tag      string
+	Category string
+	Domain   string
+	ListID   string
+	Query    string
+	Done     *bool
+}
+
+func (q LinkQuery) filter(links []Link) []Link {
+	filter := ExportFilter{ListID: q.ListID, Done: q.Done}
+	groups := map[string]string{"Tags": q.Tag, "Category": q.Category, "Domain": q.Domain}
+	match := strings.ToLower(q.Query)
+	return slices.DeleteFunc(links, func(link Link) bool {
+		if !filter.match(link) {
+			return true
+		}
+		for by, name := range groups {
+			if name != "" && !slices.Contains(link.groupKeys(by), name) {
+				return true
+			}
+		}
+		return match != "" && !strings.Contains(strings.ToLower(*link.match()), match)
+	})
+}
+
+var errLinkSaved = errors.New("already saved")
+
+// Save a new link and cache it; without a name, it is named after the title of its page
+func (a *Airtable) addLink(link *Link) error {
+	if link.URL == nil {
+		return fmt.Errorf("URL is required")
+	}
+	if !testURL(*link.URL) {
+		return fmt.Errorf("invalid URL: %s", *link.URL)
+	}
+	if saved, _ := a.cache.getLinkByURL(*link.URL); saved != nil {
+		return fmt.Errorf("%w as %s", errLinkSaved, *saved.ID)
+	}
+	if link.Name == nil {
+		link.Name = link.URL
+		if meta, err := fetchPageMeta(*link.URL); err == nil && meta.Title != nil {
+			link.Name = meta.Title
+		}
+	}
+	if err := a.createLink(link); err != nil {
+		return err
+	}
+	return a.cache.saveLinks([]Link{*link})
+}
+
+func (a *Airtable) cliAddLink(args []string, w io.Writer) error {
+	fs := newFlagSet("links add")
+	title := fs.String("title", "", "")
+	category := fs.String("category", "", "")
+	note := fs.String("note", "", "")
+	var tags, listIDs stringList
+	fs.Var(&tags, "tag", "")
+	fs.Var(&listIDs, "list", "")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usagef("a single URL is required")
+	}
+	URL := positional[0]
+	link := Link{URL: &URL, Tags: tags, ListIDs: listIDs, Name: nonEmpty(*title), Note: nonEmpty(*note), Category: nonEmpty(*category)}
+	if err = a.addLink(&link); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, *link.ID)
+	return nil
+}
+
+func (a *Airtable) cliUpdateLinks(action string, args []string, w io.Writer) error {
+	positional, err := parseFlags(newFlagSet("links "+action), args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return usagef("link IDs or URLs are required")
+	}
+	links, err := a.resolveLinks(positional...)
+	if err != nil {
+		return err
+	}
+	count, err := a.bulkUpdate(links, action, "")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, bulkSummary(action, count))
+	return nil
+}
+
+func listRow(list List) []string {
+	return []string{*list.ID, strconv.Itoa(len(list.LinkIDs)), *list.Name}
+}
+
+var listHeader = []string{"ID", "LINKS", "NAME"}
+
+func (a *Airtable) cliListLists(args []string, w io.Writer) error {
+	fs := newFlagSet("lists list")
+	format := fs.String("format", "table", "")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usagef("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+	lists, err := a.cache.getLists(nil)
+	if err != nil {
+		return err
+	}
+	return writeRecords(w, *format, lists, listHeader, listRow)
+}
+
+var errNotFound = errors.New("not found")
+
+// A cached list with its links in order
+func (a *Airtable) listWithLinks(id string) (List, []Link, error) {
+	lists, err := a.cache.getLists(nil)
+	if err != nil {
+		return List{}, nil, err
+	}
+	i := slices.IndexFunc(lists, func(l List) bool { return *l.ID == id })
+	if i < 0 {
+		return List{}, nil, fmt.Errorf("list %s %w", id, errNotFound)
+	}
+	list := lists[i]
+	links, err := a.cache.getLinks(&list, nil)
+	if err != nil {
+		return List{}, nil, err
+	}
+	order, err := a.cache.getLinkOrder(*list.ID)
+	if err != nil {
+		return List{}, nil, err
+	}
+	sortByOrder(links, order)
+	return list, links, nil
+}
+
+// A list with its links in order; as JSON, the list comes first, then its links
+func (a *Airtable) cliShowList(args []string, w io.Writer) error {
+	fs := newFlagSet("lists show")
+	format := fs.String("format", "table", "")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usagef("a single list ID is required")
+	}
+	list, links, err := a.listWithLinks(positional[0])
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			List
+			Links []Link `json:"Links"`
+		}{list, links})
+	case "jsonl":
+		if err = writeRecords(w, *format, []List{list}, nil, nil); err != nil {
+			return err
+		}
+	case "table":
+		fmt.Fprintln(w, *list.Name)
+		if list.Note != nil {
+			fmt.Fprintln(w, *list.Note)
+		}
+		fmt.Fprintln(w)
+	}
+	return writeRecords(w, *format, links, linkHeader, linkRow)
+}
+
+func (a *Airtable) cliSync(args []string, w io.Writer) error {
+	fs := newFlagSet("sync")
+	force := fs.Bool("force", false, "")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usagef("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+	return a.syncData(*force)
+}
+
+func (a *Airtable) cliServe(args []string, w io.Writer) error {
+	fs := newFlagSet("serve")
+	addr := fs.String("addr", "", "")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usagef("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+	return a.serve(*addr, w)
+}
+
+func (a *Airtable) cliExport(args []string, w io.Writer) error {
+	fs := newFlagSet("export")
+	format := fs.String("format", "html", "")
+	listID := fs.String("list", "", "")
+	tag := fs.String("tag", "", "")
+	output := fs.String("output", "-", "")
+	var done optionalBool
+	fs.Var(&done, "done", "")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usagef("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+	if _, ok := exportFormats[*format]; !ok {
+		return usagef("unknown format: %q", *format)
+	}
+	filter := ExportFilter{ListID: *listID, Done: done.value}
+	if *tag != "" {
+		filter.GroupBy, filter.Group = "Tags", *tag
+	}
+	if *output == "-" {
+		export, err := a.getExport(filter)
+		if err != nil {
+			return err
+		}
+		return export.write(*format, w)
+	}
+	file, count, err := a.exportLinks(*format, *output, filter)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d links exported to %s\n", count, file)
+	return nil
+}
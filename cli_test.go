@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCLI(t *testing.T) {
+	fake := &fakeAirtable{}
+	airtable := newTestAirtable(t, fake)
+	_ = airtable.cache.saveLists([]List{{ID: stringPtr("recL"), Name: stringPtr("Reading"), LinkIDs: []string{"recB", "recA"}}})
+	_ = airtable.cache.saveLinks([]Link{
+		{ID: stringPtr("recA"), Name: stringPtr("Go"), URL: stringPtr("https://go.dev"), Tags: []string{"go"}, ListIDs: []string{"recL"}},
+		{ID: stringPtr("recB"), Name: stringPtr("Go blog"), URL: stringPtr("https://go.dev/blog"), Tags: []string{"go"}, Done: true, ListIDs: []string{"recL"}},
+		{ID: stringPtr("recC"), Name: stringPtr("Rust"), URL: stringPtr("https://rust-lang.org"), Tags: []string{"rust"}},
+	})
+
+	run := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := runCLI(airtable, args, &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	code, out, _ := run("links", "list", "--tag", "go", "--done=false", "--format", "json")
+	var links []Link
+	if err := json.Unmarshal([]byte(out), &links); err != nil || code != 0 {
+		t.Fatalf("links list = %d, %q, %v", code, out, err)
+	}
+	if len(links) != 1 || *links[0].ID != "recA" {
+		t.Errorf("links list --tag go --done=false = %v, want recA", links)
+	}
+	if code, out, _ = run("links", "list", "--done", "--format", "jsonl"); code != 0 || strings.Count(out, "\n") != 1 || !strings.Contains(out, `"recB"`) {
+		t.Errorf("links list --done = %d, %q, want recB", code, out)
+	}
+	if code, out, _ = run("links", "list", "--query", "RUST"); code != 0 || !strings.HasPrefix(out, "ID    DONE  NAME  URL                    TAGS\nrecC") {
+		t.Errorf("links list --query = %d, %q", code, out)
+	}
+
+	code, out, _ = run("lists", "show", "recL")
+	if want := "Reading\n\nID    DONE  NAME     URL                  TAGS\nrecB  ✓     Go blog  https://go.dev/blog  go\nrecA        Go       https://go.dev       go\n"; code != 0 || out != want {
+		t.Errorf("lists show = %d, %q, want %q", code, out, want)
+	}
+
+	// Flags can follow the URL
+	code, out, stderr := run("links", "add", "https://zig.dev", "--title", "Zig", "--tag", "zig", "--tag", "lang")
+	if code != 0 {
+		t.Fatalf("links add = %d, %s", code, stderr)
+	}
+	id := strings.TrimSpace(out)
+	if record := fake.records["Links"][id]; record["Name"] != "Zig" || len(record["Tags"].([]any)) != 2 {
+		t.Errorf("created %v", record)
+	}
+	if saved, _ := airtable.cache.getLinkByURL("https://zig.dev"); saved == nil || *saved.ID != id {
+		t.Errorf("cache has %v, want %s", saved, id)
+	}
+
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"links", "add", "https://go.dev/"}, 1},
+		{[]string{"lists", "show", "recMissing"}, 1},
+		{[]string{"links", "list", "--done=maybe"}, 2},
+		{[]string{"links", "list", "--format", "xml"}, 2},
+		{[]string{"links", "add"}, 2},
+		{[]string{"unknown"}, 2},
+		{[]string{"help"}, 0},
+	}
+	for _, tt := range tests {
+		if code, _, _ := run(tt.args...); code != tt.code {
+			t.Errorf("%v exit code = %d, want %d", tt.args, code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Diagnose the setup of the workflow: the data directory, the cache, the tokens,
+// the API and the base, the schema, the last sync and the logs
+// Runs without signing in, so that it works when the tokens are the problem
+
+type Check struct {
+	Name string
+	// ok, warn or fail
+	Status string
+	Detail string
+	// How to fix a problem, and the fix run by doctor-fix, if there is one
+	Hint string
+	Fix  string
+}
+
+// The fields the workflow reads and writes
+var expectedFields = map[string][]string{
+	"Links": {"Name", "Note", "URL", "Category", "Tags", "Last Modified", "Record URL", "Done", "Lists"},
+	"Lists": {"Name", "Note", "Last Modified", "Record URL", "Links"},
+}
+
+// The select fields whose options are kept in the cache, with their type
+var expectedChoiceFields = map[string]string{
+	"Tags":     "multipleSelects",
+	"Category": "singleSelect",
+}
+
+func newAirtable(dataDir string) *Airtable {
+	return &Airtable{
+		baseURL: "https://api.airtable.com/v0",
+		baseID:  os.Getenv("BASE_ID"),
+		dbPath:  path.Join(dataDir, "airtable.db"),
+	}
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+func formatAge(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%d minutes ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%d hours ago", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d days ago", int(d.Hours()/24))
+}
+
+// Run every check in order; checks that depend on a failed one are left out
+func (a *Airtable) diagnose() []Check {
+	checks := []Check{}
+	add := func(c Check) bool {
+		checks = append(checks, c)
+		return c.Status != "fail"
+	}
+
+	dataDir := os.Getenv("alfred_workflow_data")
+	if !add(checkDataDir(dataDir)) {
+		return checks
+	}
+	add(checkNotifier())
+	if a.cache == nil {
+		a.cache = &Cache{file: a.dbPath}
+	}
+	if !add(a.checkCache()) {
+		return checks
+	}
+	// The API needs a token, the base and the schema need a token that works
+	if add(a.checkTokens()) {
+		if api := a.checkAPI(); add(api) && api.Status == "ok" {
+			tables, check := a.checkBase()
+			if add(check) {
+				add(a.checkSchema(tables))
+			}
+		}
+	}
+	add(a.checkSync())
+	add(checkLogs())
+	return checks
+}
+
+func checkDataDir(dir string) Check {
+	c := Check{Name: "Data directory", Status: "ok", Detail: dir}
+	if dir == "" {
+		c.Status, c.Detail = "fail", "alfred_workflow_data is not set"
+		c.Hint = "Run from Alfred, or set alfred_workflow_data to a directory"
+		return c
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		c.Status, c.Detail = "fail", err.Error()
+		return c
+	}
+	f, err := os.CreateTemp(dir, ".doctor")
+	if err != nil {
+		c.Status, c.Detail = "fail", "not writable: "+err.Error()
+		return c
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+	return c
+}
+
+func checkNotifier() Check {
+	c := Check{Name: "Notifications", Status: "ok", Detail: "terminal-notifier"}
+	if p, err := exec.LookPath("terminal-notifier"); err == nil {
+		c.Detail = p
+	} else {
+		c.Status, c.Detail = "warn", "terminal-notifier is not installed"
+		c.Hint = "brew install terminal-notifier"
+	}
+	return c
+}
+
+func (a *Airtable) checkCache() Check {
+	c := Check{Name: "Cache", Status: "fail", Hint: "Move the cache aside and sign in again", Fix: "reset-cache"}
+	if err := a.cache.init(); err != nil {
+		c.Detail = "cannot open the cache: " + err.Error()
+		if strings.Contains(err.Error(), "locked") {
+			c.Hint, c.Fix = "Quit other runs of the workflow and try again", ""
+		}
+		return c
+	}
+	var result string
+	if err := a.cache.db.QueryRow(`PRAGMA quick_check`).Scan(&result); err != nil || result != "ok" {
+		c.Detail = fmt.Sprintf("integrity check failed: %s %v", result, err)
+		return c
+	}
+	// Another process holding a write lock makes every change wait, then fail
+	conn, err := a.cache.db.Conn(context.Background())
+	if err == nil {
+		defer conn.Close()
+		// Fail at once instead of waiting for the lock
+		_, _ = conn.ExecContext(context.Background(), `PRAGMA busy_timeout = 0`)
+		if _, err = conn.ExecContext(context.Background(), `BEGIN IMMEDIATE`); err == nil {
+			_, err = conn.ExecContext(context.Background(), `ROLLBACK`)
+		}
+	}
+	if err != nil {
+		c.Detail = "the cache is locked: " + err.Error()
+		c.Hint, c.Fix = "Quit other runs of the workflow and try again", ""
+		return c
+	}
+	var links, lists int
+	_ = a.cache.db.QueryRow(`SELECT COUNT(*) FROM Links`).Scan(&links)
+	_ = a.cache.db.QueryRow(`SELECT COUNT(*) FROM Lists`).Scan(&lists)
+	info, _ := os.Stat(a.cache.file)
+	size := int64(0)
+	if info != nil {
+		size = info.Size()
+	}
+	return Check{Name: "Cache", Status: "ok", Detail: fmt.Sprintf("%d links, %d lists  ·  %s", links, lists, formatSize(size))}
+}
+
+func (a *Airtable) checkTokens() Check {
+	c := Check{Name: "Sign-in", Status: "fail", Hint: "Sign in to Airtable again", Fix: "sign-in"}
+	auth := &Auth{Token: &oauth2.Token{}}
+	auth.read(a.cache)
+	a.auth = auth
+	switch {
+	case auth.AccessToken == "" && auth.RefreshToken == "":
+		c.Detail = "not signed in"
+	case auth.Valid():
+		c.Status = "ok"
+		c.Detail = "token valid until " + auth.Expiry.Local().Format("15:04")
+		c.Hint, c.Fix = "", ""
+		if auth.RefreshExpiry != nil {
+			c.Detail += fmt.Sprintf(", refresh token until %s", auth.RefreshExpiry.Local().Format("2006-01-02"))
+			if time.Until(*auth.RefreshExpiry) < 7*24*time.Hour {
+				c.Status = "warn"
+				c.Hint, c.Fix = "The refresh token expires soon, sign in again", "sign-in"
+			}
+		}
+	case auth.refreshValid():
+		c.Status = "warn"
+		c.Detail = fmt.Sprintf("token expired, refresh token valid until %s", auth.RefreshExpiry.Local().Format("2006-01-02"))
+		c.Hint = "The token is refreshed on the next run"
+	default:
+		c.Detail = "token and refresh token expired"
+	}
+	return c
+}
+
+// Call the API with the token: whoami needs no base
+func (a *Airtable) checkAPI() Check {
+	c := Check{Name: "Airtable API", Status: "fail"}
+	if !a.auth.Valid() {
+		c.Status, c.Detail = "warn", "skipped until the token is refreshed"
+		return c
+	}
+	req, err := http.NewRequest("GET", a.baseURL+"/meta/whoami", nil)
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	req.Header.Add("Authorization", "Bearer "+a.auth.AccessToken)
+	call := newAPICall(req, "meta/whoami")
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		call.end(0, 0, err)
+		c.Detail = "unreachable: " + err.Error()
+		c.Hint = "Check the network connection"
+		return c
+	}
+	defer resp.Body.Close()
+	call.end(resp.StatusCode, 0, nil)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var user struct {
+			ID    string `json:"id"`
+			Email string `json:"email"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&user)
+		c.Status, c.Detail = "ok", "signed in as "+cmp.Or(user.Email, user.ID)
+	case http.StatusUnauthorized:
+		c.Detail = "the token was rejected"
+		c.Hint, c.Fix = "Sign in to Airtable again", "sign-in"
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		c.Detail = fmt.Sprintf("%s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return c
+}
+
+func (a *Airtable) checkBase() ([]Table, Check) {
+	c := Check{Name: "Base", Status: "fail", Detail: a.baseID}
+	if a.baseID == "" {
+		c.Detail = "BASE_ID is not set"
+		c.Hint = "Set BASE_ID in the workflow configuration"
+		return nil, c
+	}
+	tables, err := a.fetchTables()
+	if err != nil {
+		c.Detail = fmt.Sprintf("%s: %s", a.baseID, err)
+		c.Hint = "Check BASE_ID, and that the base was granted when signing in"
+		c.Fix = "sign-in"
+		return nil, c
+	}
+	c.Status = "ok"
+	return tables, c
+}
+
+func (a *Airtable) checkSchema(tables []Table) Check {
+	c := Check{Name: "Schema", Status: "ok"}
+	missing := []string{}
+	var links *Table
+	for _, name := range []string{"Links", "Lists"} {
+		i := slices.IndexFunc(tables, func(t Table) bool { return t.Name == name })
+		if i < 0 {
+			missing = append(missing, "table "+name)
+			continue
+		}
+		if name == "Links" {
+			links = &tables[i]
+		}
+		for _, field := range expectedFields[name] {
+			if !slices.ContainsFunc(tables[i].Fields, func(f Field) bool { return f.Name == field }) {
+				missing = append(missing, name+"."+field)
+			}
+		}
+	}
+	wrongType := []string{}
+	counts := []string{}
+	if links != nil {
+		for _, name := range []string{"Tags", "Category"} {
+			i := slices.IndexFunc(links.Fields, func(f Field) bool { return f.Name == name })
+			if i < 0 {
+				continue
+			}
+			field := links.Fields[i]
+			if field.Type != expectedChoiceFields[name] {
+				wrongType = append(wrongType, fmt.Sprintf("%s is %s, not %s", name, field.Type, expectedChoiceFields[name]))
+				continue
+			}
+			options := []string{}
+			if field.Options != nil {
+				for _, choice := range field.Options.Choices {
+					options = append(options, choice.Name)
+				}
+			}
+			local := 0
+			for _, choice := range a.cache.getChoiceNames(name) {
+				if !slices.Contains(options, choice) {
+					local++
+				}
+			}
+			count := fmt.Sprintf("%d %s", len(options), strings.ToLower(name))
+			if local > 0 {
+				count += fmt.Sprintf(" (%d only in the cache)", local)
+			}
+			counts = append(counts, count)
+		}
+	}
+	switch {
+	case len(missing) > 0:
+		c.Status, c.Detail = "fail", "missing "+strings.Join(missing, ", ")
+		c.Hint = "Rename the fields back in Airtable"
+	case len(wrongType) > 0:
+		c.Status, c.Detail = "fail", strings.Join(wrongType, ", ")
+		c.Hint = "Change the field types back in Airtable"
+	default:
+		c.Detail = "Links and Lists  ·  " + strings.Join(counts, ", ")
+	}
+	return c
+}
+
+func (a *Airtable) checkSync() Check {
+	c := Check{Name: "Last sync", Status: "ok", Hint: "Sync all records again", Fix: "resync"}
+	last := a.cache.lastSyncedAt
+	switch {
+	case last.IsZero():
+		c.Status, c.Detail = "warn", "never synced"
+	case time.Since(last) > 24*time.Hour:
+		c.Status, c.Detail = "warn", formatAge(last)
+	default:
+		c.Detail = formatAge(last)
+	}
+	return c
+}
+
+// The log file and its rotated copies
+func logFiles() []string {
+	files, _ := filepath.Glob(logFile() + "*")
+	return files
+}
+
+func checkLogs() Check {
+	c := Check{Name: "Logs", Status: "ok", Hint: "Delete the log files", Fix: "clear-logs"}
+	files := logFiles()
+	size := int64(0)
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			size += info.Size()
+		}
+	}
+	c.Detail = fmt.Sprintf("%s in %d files  ·  %s", formatSize(size), len(files), logFile())
+	if size > 10<<20 {
+		c.Status = "warn"
+	}
+	return c
+}
+
+// Apply the fix of a check
+func (a *Airtable) doctorFix(fix string) error {
+	switch fix {
+	case "sign-in":
+		if err := a.cache.init(); err != nil {
+			return err
+		}
+		for _, key := range []string{"AccessToken", "Expiry", "RefreshToken", "RefreshExpiry"} {
+			_ = a.cache.setData(key, "")
+		}
+		return a.getAuth()
+	case "resync":
+		if err := a.init(); err != nil {
+			return err
+		}
+		a.cache.lastSyncedAt = time.Time{}
+		return a.syncData(true)
+	case "clear-logs":
+		for _, file := range logFiles() {
+			if err := os.Remove(file); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "reset-cache":
+		if a.cache != nil && a.cache.db != nil {
+			_ = a.cache.db.Close()
+			a.cache.db = nil
+		}
+		backup := fmt.Sprintf("%s.%s.bak", a.dbPath, time.Now().Format("20060102-150405"))
+		if err := os.Rename(a.dbPath, backup); err != nil {
+			return err
+		}
+		logMessage("INFO", "Moved the cache to %s", backup)
+		return nil
+	}
+	return fmt.Errorf("unknown fix: %s", fix)
+}
+
+var checkIcons = map[string]string{"ok": "✓", "warn": "!", "fail": "✗"}
+
+// The checks as Alfred items; a check with a fix runs it, a hint can be copied
+func doctorItems(checks []Check) Workflow {
+	wf := Workflow{}
+	for _, c := range checks {
+		item := Item{
+			Title:    c.Name,
+			Subtitle: c.Detail,
+			Icon:     &Icon{Path: stringPtr("media/checked.png")},
+			Valid:    boolPtr(false),
+		}
+		if c.Status != "ok" {
+			item.Title = fmt.Sprintf("%s: %s", c.Name, c.Status)
+			item.Icon = alertIcon()
+		}
+		if c.Hint != "" && c.Status != "ok" {
+			item.Subtitle += "  ·  " + c.Hint
+			item.Text.Copy = stringPtr(c.Hint)
+			item.Text.LargeType = stringPtr(c.Detail + "\n" + c.Hint)
+		}
+		if c.Fix != "" && c.Status != "ok" {
+			item.Valid = nil
+			item.Variables = map[string]string{"exec": "doctor-fix", "fix": c.Fix}
+		}
+		wf.addItem(item)
+	}
+	return wf
+}
+
+// The checks as text; returns whether all passed
+func writeDoctor(w io.Writer, checks []Check) bool {
+	ok := true
+	for _, c := range checks {
+		fmt.Fprintf(w, "%s %-15s %s\n", checkIcons[c.Status], c.Name, c.Detail)
+		if c.Status != "ok" && c.Hint != "" {
+			fmt.Fprintf(w, "  %-15s %s\n", "", c.Hint)
+		}
+		if c.Status != "ok" && c.Fix != "" {
+			fmt.Fprintf(w, "  %-15s doctor --fix %s\n", "", c.Fix)
+		}
+		ok = ok && c.Status != "fail"
+	}
+	return ok
+}
+
+func (a *Airtable) cliDoctor(args []string, w io.Writer) error {
+	fs := newFlagSet("doctor")
+	fix := fs.String("fix", "", "")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usagef("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+	if *fix != "" {
+		return a.doctorFix(*fix)
+	}
+	if !writeDoctor(w, a.diagnose()) {
+		return fmt.Errorf("some checks failed")
+	}
+	return nil
+}
+
+// Run the doctor, or one of its fixes, before anything else opens the cache or signs in
+// Checks are shown as Alfred items in doctor mode, and as text for the doctor command
+func runDoctor(mode string) int {
+	dataDir := os.Getenv("alfred_workflow_data")
+	if dataDir != "" {
+		_ = setupLogging()
+	}
+	a := newAirtable(dataDir)
+	a.cache = &Cache{file: a.dbPath}
+	defer func() {
+		if a.cache.db != nil {
+			a.cache.db.Close()
+		}
+	}()
+	switch mode {
+	case "doctor":
+		wf := doctorItems(a.diagnose())
+		wf.output()
+	case "doctor-fix":
+		fix := os.Getenv("fix")
+		if err := a.doctorFix(fix); err != nil {
+			notify(err.Error())
+			return 1
+		}
+		notify("Fixed!", fix)
+	default:
+		return runCLI(a, os.Args[1:], os.Stdout, os.Stderr)
+	}
+	return 0
+}
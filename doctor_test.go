@@ -0,0 +1,132 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiagnose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/meta/whoami":
+			_, _ = w.Write([]byte(`{"id":"usr1","email":"me@example.com"}`))
+		case "/meta/bases/app/tables":
+			_, _ = w.Write([]byte(`{"tables":[
+				{"id":"tbl1","name":"Links","fields":[
+					{"name":"Name"},{"name":"Note"},{"name":"URL"},{"name":"Last Modified"},{"name":"Record URL"},{"name":"Lists"},
+					{"name":"Category","type":"singleSelect","options":{"choices":[{"name":"Docs"}]}},
+					{"name":"Tags","type":"multipleSelects","options":{"choices":[{"name":"go"},{"name":"rust"}]}}]},
+				{"id":"tbl2","name":"Lists","fields":[
+					{"name":"Name"},{"name":"Note"},{"name":"Last Modified"},{"name":"Record URL"},{"name":"Links"}]}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	t.Setenv("alfred_workflow_data", dir)
+	t.Setenv("alfred_workflow_cache", dir)
+	airtable := &Airtable{baseURL: server.URL, baseID: "app", dbPath: filepath.Join(dir, "airtable.db")}
+	airtable.cache = &Cache{file: airtable.dbPath}
+	if err := airtable.cache.init(); err != nil {
+		t.Fatal(err)
+	}
+	refreshExpiry := time.Now().Add(30 * 24 * time.Hour).Unix()
+	for key, value := range map[string]string{
+		"AccessToken":   "token",
+		"Expiry":        strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10),
+		"RefreshToken":  "refresh",
+		"RefreshExpiry": strconv.FormatInt(refreshExpiry, 10),
+	} {
+		_ = airtable.cache.setData(key, value)
+	}
+
+	checks := map[string]Check{}
+	for _, c := range airtable.diagnose() {
+		checks[c.Name] = c
+	}
+	want := map[string]string{
+		"Data directory": "ok",
+		"Cache":          "ok",
+		"Sign-in":        "ok",
+		"Airtable API":   "ok",
+		"Base":           "ok",
+		"Schema":         "fail",
+		"Last sync":      "warn",
+		"Logs":           "ok",
+	}
+	for name, status := range want {
+		if got := checks[name].Status; got != status {
+			t.Errorf("%s: status = %q, want %q (%s)", name, got, status, checks[name].Detail)
+		}
+	}
+	if detail := checks["Airtable API"].Detail; !strings.Contains(detail, "me@example.com") {
+		t.Errorf("Airtable API: detail = %q", detail)
+	}
+	if detail := checks["Schema"].Detail; detail != "missing Links.Done" {
+		t.Errorf("Schema: detail = %q, want %q", detail, "missing Links.Done")
+	}
+	if fix := checks["Last sync"].Fix; fix != "resync" {
+		t.Errorf("Last sync: fix = %q, want resync", fix)
+	}
+
+	// A rejected token stops before the base
+	_ = airtable.cache.setData("AccessToken", "revoked")
+	checks = map[string]Check{}
+	for _, c := range airtable.diagnose() {
+		checks[c.Name] = c
+	}
+	if c := checks["Airtable API"]; c.Status != "fail" || c.Fix != "sign-in" {
+		t.Errorf("Airtable API: %+v, want a failure fixed by signing in", c)
+	}
+	if _, ok := checks["Base"]; ok {
+		t.Error("Base was checked with a rejected token")
+	}
+	wf := doctorItems(airtable.diagnose())
+	for _, view := range wf.Views {
+		if view.Title == "Airtable API: fail" && view.Actions[0].Variables["fix"] != "sign-in" {
+			t.Errorf("item %q: variables = %v", view.Title, view.Actions[0].Variables)
+		}
+	}
+}
+
+func TestCheckCacheLocked(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "airtable.db")
+	cache := &Cache{file: file}
+	if err := cache.init(); err != nil {
+		t.Fatal(err)
+	}
+	airtable := &Airtable{cache: cache}
+	if c := airtable.checkCache(); c.Status != "ok" {
+		t.Fatalf("checkCache() = %+v, want ok", c)
+	}
+
+	other, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	tx, err := other.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err = tx.Exec(`INSERT INTO Metadata (Key, Value) VALUES ('Lock', '1')`); err != nil {
+		t.Fatal(err)
+	}
+	c := airtable.checkCache()
+	if c.Status != "fail" || !strings.Contains(c.Detail, "locked") {
+		t.Errorf("checkCache() = %+v, want locked", c)
+	}
+}
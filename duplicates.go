@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Find and merge links saved more than once
+
+const titleSimilarity = 0.9
+
+// Lowercase a title and drop punctuation, so that "Go 1.22 is released!" matches "Go 1.22 Is Released"
+func titleKey(title string) string {
+	var out strings.Builder
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			out.WriteRune(r)
+		} else {
+			out.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(out.String()), " ")
+}
+
+// Levenshtein distance between two strings, by runes
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// Similarity of two titles between 0 and 1
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(editDistance(ra, rb))/float64(longest)
+}
+
+type DuplicateGroup struct {
+	Links []Link
+	// "URL" if the links share a normalized URL, "Title" if only their titles are similar
+	Reason string
+}
+
+// Group links by normalized URL, then by very similar titles
+// Links in each group are sorted by creation time, the oldest first
+func findDuplicates(links []Link) []DuplicateGroup {
+	// union-find over the indexes of links
+	parent := make([]int, len(links))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	byURL := map[int]bool{}
+	union := func(i, j int, sameURL bool) {
+		ri, rj := find(i), find(j)
+		if ri != rj {
+			parent[rj] = ri
+			byURL[ri] = byURL[ri] || byURL[rj]
+		}
+		if sameURL {
+			byURL[ri] = true
+		}
+	}
+
+	urls := map[string]int{}
+	// Titles are only compared within buckets of the same first characters
+	buckets := map[string][]int{}
+	keys := make([]string, len(links))
+	for i, link := range links {
+		if link.URL != nil {
+			URL := normalizeURL(*link.URL)
+			if j, ok := urls[URL]; ok {
+				union(j, i, true)
+			} else {
+				urls[URL] = i
+			}
+		}
+		if link.Name == nil || (link.URL != nil && *link.Name == *link.URL) {
+			continue
+		}
+		keys[i] = titleKey(*link.Name)
+		if len([]rune(keys[i])) < 8 {
+			keys[i] = ""
+			continue
+		}
+		prefix := string([]rune(keys[i])[:4])
+		buckets[prefix] = append(buckets[prefix], i)
+	}
+	for _, bucket := range buckets {
+		for x, i := range bucket {
+			for _, j := range bucket[x+1:] {
+				if keys[i] == keys[j] || similarity(keys[i], keys[j]) >= titleSimilarity {
+					union(i, j, false)
+				}
+			}
+		}
+	}
+
+	groupsMap := map[int][]Link{}
+	for i, link := range links {
+		root := find(i)
+		groupsMap[root] = append(groupsMap[root], link)
+	}
+	groups := []DuplicateGroup{}
+	for root, group := range groupsMap {
+		if len(group) < 2 {
+			continue
+		}
+		slices.SortStableFunc(group, func(a, b Link) int {
+			if a.Created == nil || b.Created == nil {
+				return 0
+			}
+			return a.Created.Compare(*b.Created)
+		})
+		reason := "Title"
+		if byURL[root] {
+			reason = "URL"
+		}
+		groups = append(groups, DuplicateGroup{Links: group, Reason: reason})
+	}
+	slices.SortFunc(groups, func(a, b DuplicateGroup) int {
+		if n := len(b.Links) - len(a.Links); n != 0 {
+			return n
+		}
+		return strings.Compare(linkTitle(a.Links[0]), linkTitle(b.Links[0]))
+	})
+	return groups
+}
+
+// The name of a link, or its URL if it has no name
+func linkTitle(link Link) string {
+	if link.Name != nil && *link.Name != "" {
+		return *link.Name
+	}
+	if link.URL != nil {
+		return *link.URL
+	}
+	return ""
+}
+
+// Merge the other links into the one to keep:
+// tags and lists are combined, notes concatenated, done if any of them is done
+func mergeLinks(keep Link, others []Link) Link {
+	merged := keep
+	merged.Tags = slices.Clone(keep.Tags)
+	merged.ListIDs = slices.Clone(keep.ListIDs)
+	notes := []string{}
+	if keep.Note != nil && *keep.Note != "" {
+		notes = append(notes, *keep.Note)
+	}
+	for _, other := range others {
+		for _, tag := range other.Tags {
+			if !slices.Contains(merged.Tags, tag) {
+				merged.Tags = append(merged.Tags, tag)
+			}
+		}
+		for _, listID := range other.ListIDs {
+			if !slices.Contains(merged.ListIDs, listID) {
+				merged.ListIDs = append(merged.ListIDs, listID)
+			}
+		}
+		if other.Note != nil && *other.Note != "" && !slices.Contains(notes, *other.Note) {
+			notes = append(notes, *other.Note)
+		}
+		if merged.Category == nil {
+			merged.Category = other.Category
+		}
+		merged.Done = merged.Done || other.Done
+	}
+	if len(notes) > 0 {
+		merged.Note = stringPtr(strings.Join(notes, "\n\n"))
+	}
+	return merged
+}
+
+// Merge links into the one with keepID, and delete the others
+func (a *Airtable) mergeDuplicates(keepID string, ids []string) (*Link, error) {
+	links, err := a.cache.getLinksByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(links, func(l Link) bool { return *l.ID == keepID })
+	if i < 0 {
+		return nil, fmt.Errorf("link %s not found", keepID)
+	}
+	keep := links[i]
+	others := slices.Delete(slices.Clone(links), i, i+1)
+	if len(others) == 0 {
+		return nil, fmt.Errorf("nothing to merge")
+	}
+	merged := mergeLinks(keep, others)
+
+	_, err = a.updateLinks([]Link{keep}, func(link Link) map[string]any {
+		fields := map[string]any{
+			"Tags":  merged.Tags,
+			"Lists": merged.ListIDs,
+			"Done":  merged.Done,
+		}
+		if merged.Note != nil {
+			fields["Note"] = *merged.Note
+		}
+		if merged.Category != nil {
+			fields["Category"] = *merged.Category
+		}
+		return fields
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = a.deleteLinks(others); err != nil {
+		return nil, err
+	}
+	logMessage("INFO", "Merged %d links into %s", len(others), keepID)
+	return &merged, nil
+}
+
+func duplicateIDs(links []Link) string {
+	ids := make([]string, len(links))
+	for i, link := range links {
+		ids[i] = *link.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+// list the groups of duplicate links
+func (a *Airtable) listDuplicates() {
+	wf := Workflow{}
+	links, err := a.cache.getLinks(nil, nil)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+		wf.output()
+		return
+	}
+	groups := findDuplicates(links)
+	if len(groups) == 0 {
+		wf.warnEmpty("No Duplicates Found")
+	}
+	for _, group := range groups {
+		keep := group.Links[0]
+		keep.Name = stringPtr(linkTitle(keep))
+		reason := "same URL"
+		if group.Reason == "Title" {
+			reason = "similar titles"
+		}
+		names := []string{}
+		for _, link := range group.Links {
+			names = append(names, "- "+linkTitle(link)+"\n  "+*link.URL)
+		}
+		item := Item{
+			Title:        *keep.Name,
+			Subtitle:     fmt.Sprintf("%d copies with %s  ·  Merge into the oldest one", len(group.Links), reason),
+			Match:        keep.match(),
+			QuickLookURL: keep.URL,
+			Icon:         &Icon{Path: stringPtr("media/link.png")},
+			Variables: map[string]string{
+				"keepID": *keep.ID,
+				"IDs":    duplicateIDs(group.Links),
+				"exec":   "merge-links",
+			},
+			Mods: &map[string]Mod{
+				"alt": {
+					Subtitle: "Choose which link to keep",
+					Icon:     &Icon{Path: stringPtr("media/edit.png")},
+					Variables: map[string]string{
+						"IDs":  duplicateIDs(group.Links),
+						"mode": "list-duplicate-group",
+					},
+				},
+			},
+		}
+		item.Text.LargeType = stringPtr(strings.Join(names, "\n"))
+		wf.addItem(item)
+	}
+	wf.output()
+}
+
+// list the links of a duplicate group, to choose the one to keep
+func (a *Airtable) listDuplicateGroup(ids []string) {
+	wf := Workflow{}
+	links, err := a.cache.getLinksByIDs(ids)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+	} else if len(links) == 0 {
+		wf.warnEmpty("No Links Found")
+	}
+	for _, link := range links {
+		link.Name = stringPtr(linkTitle(link))
+		view := link.view()
+		view.Subtitle = "Keep this one and merge the others into it  ·  " + view.Subtitle
+		view.setVar("keepID", *link.ID)
+		view.setVar("IDs", strings.Join(ids, ","))
+		view.setVar("exec", "merge-links")
+		view.setVar("mode", "")
+		wf.addView(view)
+	}
+	wf.addItem(Item{
+		Title: "Go Back",
+		Icon:  &Icon{Path: stringPtr("media/back.png")},
+		Variables: map[string]string{
+			"IDs":  "",
+			"mode": "find-duplicates",
+		},
+	})
+	wf.output()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	day := func(d int) *time.Time {
+		t := time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	links := []Link{
+		{ID: stringPtr("rec2"), Name: stringPtr("Example"), URL: stringPtr("https://www.example.com/post/?utm_source=x"), Created: day(2)},
+		{ID: stringPtr("rec1"), Name: stringPtr("Example post"), URL: stringPtr("https://example.com/post"), Created: day(1)},
+		{ID: stringPtr("rec3"), Name: stringPtr("Go 1.22 is released!"), URL: stringPtr("https://go.dev/blog/go1.22"), Created: day(3)},
+		{ID: stringPtr("rec4"), Name: stringPtr("Go 1.22 Is Released"), URL: stringPtr("https://news.example.com/go"), Created: day(4)},
+		{ID: stringPtr("rec5"), Name: stringPtr("Something else entirely"), URL: stringPtr("https://other.com"), Created: day(5)},
+		{ID: stringPtr("rec6"), Name: stringPtr("Home"), URL: stringPtr("https://a.com"), Created: day(6)},
+		{ID: stringPtr("rec7"), Name: stringPtr("Home"), URL: stringPtr("https://b.com"), Created: day(7)},
+	}
+	groups := findDuplicates(links)
+	if len(groups) != 2 {
+		t.Fatalf("findDuplicates() returned %d groups, want 2", len(groups))
+	}
+	got := map[string][]string{}
+	for _, group := range groups {
+		ids := []string{}
+		for _, link := range group.Links {
+			ids = append(ids, *link.ID)
+		}
+		got[group.Reason] = ids
+	}
+	if want := []string{"rec1", "rec2"}; !slices.Equal(got["URL"], want) {
+		t.Errorf("URL group = %v, want %v", got["URL"], want)
+	}
+	if want := []string{"rec3", "rec4"}; !slices.Equal(got["Title"], want) {
+		t.Errorf("Title group = %v, want %v", got["Title"], want)
+	}
+
+	// Links without a name are sorted by URL
+	unnamed := []Link{
+		{ID: stringPtr("rec8"), URL: stringPtr("https://c.com"), Created: day(8)},
+		{ID: stringPtr("rec9"), URL: stringPtr("https://www.c.com/"), Created: day(9)},
+	}
+	groups = findDuplicates(append(links, unnamed...))
+	if len(groups) != 3 || *groups[2].Links[0].ID != "rec8" {
+		t.Errorf("findDuplicates() with unnamed links returned %d groups, want 3 with the group of rec8 last", len(groups))
+	}
+}
+
+func TestMergeLinks(t *testing.T) {
+	keep := Link{
+		ID:      stringPtr("rec1"),
+		Note:    stringPtr("first"),
+		Tags:    []string{"go"},
+		ListIDs: []string{"recL1"},
+	}
+	others := []Link{
+		{ID: stringPtr("rec2"), Note: stringPtr("second"), Tags: []string{"go", "blog"}, ListIDs: []string{"recL2"}, Category: stringPtr("Article"), Done: true},
+		{ID: stringPtr("rec3"), Note: stringPtr("first"), ListIDs: []string{"recL1"}},
+	}
+	merged := mergeLinks(keep, others)
+	if *merged.ID != "rec1" {
+		t.Errorf("ID = %s, want rec1", *merged.ID)
+	}
+	if want := []string{"go", "blog"}; !slices.Equal(merged.Tags, want) {
+		t.Errorf("Tags = %v, want %v", merged.Tags, want)
+	}
+	if want := []string{"recL1", "recL2"}; !slices.Equal(merged.ListIDs, want) {
+		t.Errorf("ListIDs = %v, want %v", merged.ListIDs, want)
+	}
+	if want := "first\n\nsecond"; merged.Note == nil || *merged.Note != want {
+		t.Errorf("Note = %v, want %q", merged.Note, want)
+	}
+	if merged.Category == nil || *merged.Category != "Article" {
+		t.Errorf("Category = %v, want Article", merged.Category)
+	}
+	if !merged.Done {
+		t.Error("Done = false, want true")
+	}
+	if len(keep.Tags) != 1 {
+		t.Errorf("mergeLinks modified the kept link's tags: %v", keep.Tags)
+	}
+}
+
+func TestListDuplicatesUnnamed(t *testing.T) {
+	airtable := &Airtable{cache: &Cache{file: ":memory:"}}
+	links := []Link{
+		{ID: stringPtr("rec1"), URL: stringPtr("https://c.com"), RecordURL: stringPtr("https://airtable.com/rec1")},
+		{ID: stringPtr("rec2"), Name: stringPtr("C"), URL: stringPtr("https://www.c.com/"), RecordURL: stringPtr("https://airtable.com/rec2")},
+	}
+	if err := airtable.cache.saveLinks(links); err != nil {
+		t.Fatal(err)
+	}
+	// Links without a name are shown by URL
+	airtable.listDuplicates()
+	airtable.listDuplicateGroup([]string{"rec1", "rec2"})
+}
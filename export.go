@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export links and lists to standard bookmark formats
+// The output only depends on the data, so exports can be kept in git
+
+var exportFormats = map[string]string{
+	"html":  ".html",
+	"csv":   ".csv",
+	"jsonl": ".jsonl",
+	"opml":  ".opml",
+}
+
+// Which links to export: those of a list, of a group (see getGroupLinks), done or not
+type ExportFilter struct {
+	ListID  string
+	GroupBy string
+	Group   string
+	Done    *bool
+}
+
+func exportFilterFromEnv() ExportFilter {
+	filter := ExportFilter{
+		ListID:  os.Getenv("listID"),
+		GroupBy: os.Getenv("groupBy"),
+		Group:   os.Getenv("group"),
+	}
+	if done, err := strconv.ParseBool(os.Getenv("done")); err == nil {
+		filter.Done = &done
+	}
+	return filter
+}
+
+func (f *ExportFilter) match(link Link) bool {
+	if f.ListID != "" && !slices.Contains(link.ListIDs, f.ListID) {
+		return false
+	}
+	if f.GroupBy != "" && !slices.Contains(link.groupKeys(f.GroupBy), f.Group) {
+		return false
+	}
+	if f.Done != nil && link.Done != *f.Done {
+		return false
+	}
+	return true
+}
+
+// The links and lists to export, in a stable order:
+// links by creation time, lists by name, then by ID
+// Lists only keep the exported links
+type Export struct {
+	Links []Link
+	Lists []List
+}
+
+func (a *Airtable) getExport(filter ExportFilter) (*Export, error) {
+	links, err := a.cache.getLinks(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	lists, err := a.cache.getLists(nil)
+	if err != nil {
+		return nil, err
+	}
+	export := Export{}
+	for _, link := range links {
+		if filter.match(link) {
+			export.Links = append(export.Links, link)
+		}
+	}
+	slices.SortFunc(export.Links, func(a, b Link) int {
+		if c := compareTimes(a.Created, b.Created); c != 0 {
+			return c
+		}
+		return strings.Compare(*a.ID, *b.ID)
+	})
+	slices.SortFunc(lists, func(a, b List) int {
+		if c := strings.Compare(*a.Name, *b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(*a.ID, *b.ID)
+	})
+
+	names := map[string]string{}
+	for _, list := range lists {
+		names[*list.ID] = *list.Name
+	}
+	for i := range export.Links {
+		link := &export.Links[i]
+		link.Created = utcTime(link.Created)
+		link.LastModified = utcTime(link.LastModified)
+		// Keep the lists that are still cached, sorted like the lists
+		ids := []string{}
+		for _, list := range lists {
+			if slices.Contains(link.ListIDs, *list.ID) {
+				ids = append(ids, *list.ID)
+			}
+		}
+		link.ListIDs = ids
+		link.ListNames = make([]string, len(ids))
+		for j, id := range ids {
+			link.ListNames[j] = names[id]
+		}
+	}
+	for _, list := range lists {
+		list.LinkIDs = nil
+		for _, link := range export.Links {
+			if slices.Contains(link.ListIDs, *list.ID) {
+				list.LinkIDs = append(list.LinkIDs, *link.ID)
+			}
+		}
+		if len(list.LinkIDs) == 0 && (filter != ExportFilter{}) {
+			continue
+		}
+		list.LinkNames = nil
+		list.LinksDone = nil
+		list.Created = utcTime(list.Created)
+		list.LastModified = utcTime(list.LastModified)
+		export.Lists = append(export.Lists, list)
+	}
+	return &export, nil
+}
+
+// Nil times come last
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	return a.Compare(*b)
+}
+
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func unixTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func (e *Export) write(format string, w io.Writer) error {
+	switch format {
+	case "html":
+		return e.writeNetscape(w)
+	case "csv":
+		return e.writeCSV(w)
+	case "jsonl":
+		return e.writeJSONL(w)
+	case "opml":
+		return e.writeOPML(w)
+	}
+	return fmt.Errorf("unknown export format: %s", format)
+}
+
+// Netscape bookmark file, as imported by browsers and bookmark services
+// Each list is a folder, links in no list are at the top level
+func (e *Export) writeNetscape(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	b.WriteString(`<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file.
+     It will be read and overwritten.
+     DO NOT EDIT! -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+`)
+	writeLink := func(link Link, indent string) {
+		fmt.Fprintf(b, `%s<DT><A HREF="%s"`, indent, html.EscapeString(*link.URL))
+		if link.Created != nil {
+			fmt.Fprintf(b, ` ADD_DATE="%s"`, unixTime(link.Created))
+		}
+		if link.LastModified != nil {
+			fmt.Fprintf(b, ` LAST_MODIFIED="%s"`, unixTime(link.LastModified))
+		}
+		if len(link.Tags) > 0 {
+			fmt.Fprintf(b, ` TAGS="%s"`, html.EscapeString(strings.Join(link.Tags, ",")))
+		}
+		fmt.Fprintf(b, ">%s</A>\n", html.EscapeString(*link.Name))
+		if link.Note != nil && *link.Note != "" {
+			fmt.Fprintf(b, "%s<DD>%s\n", indent, html.EscapeString(*link.Note))
+		}
+	}
+	for _, list := range e.Lists {
+		fmt.Fprintf(b, `    <DT><H3`)
+		if list.Created != nil {
+			fmt.Fprintf(b, ` ADD_DATE="%s"`, unixTime(list.Created))
+		}
+		if list.LastModified != nil {
+			fmt.Fprintf(b, ` LAST_MODIFIED="%s"`, unixTime(list.LastModified))
+		}
+		fmt.Fprintf(b, ">%s</H3>\n", html.EscapeString(*list.Name))
+		if list.Note != nil && *list.Note != "" {
+			fmt.Fprintf(b, "    <DD>%s\n", html.EscapeString(*list.Note))
+		}
+		b.WriteString("    <DL><p>\n")
+		for _, link := range e.Links {
+			if slices.Contains(list.LinkIDs, *link.ID) {
+				writeLink(link, "        ")
+			}
+		}
+		b.WriteString("    </DL><p>\n")
+	}
+	for _, link := range e.Links {
+		if len(link.ListIDs) == 0 {
+			writeLink(link, "    ")
+		}
+	}
+	b.WriteString("</DL><p>\n")
+	return b.Flush()
+}
+
+var csvHeader = []string{"ID", "Name", "URL", "Note", "Category", "Tags", "Lists", "Done", "Created", "Last Modified", "Record URL"}
+
+// One row per link; tags and lists are joined with commas
+func (e *Export) writeCSV(w io.Writer) error {
+	c := csv.NewWriter(w)
+	if err := c.Write(csvHeader); err != nil {
+		return err
+	}
+	value := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	for _, link := range e.Links {
+		err := c.Write([]string{
+			*link.ID,
+			value(link.Name),
+			value(link.URL),
+			value(link.Note),
+			value(link.Category),
+			strings.Join(link.Tags, ","),
+			strings.Join(link.ListNames, ","),
+			strconv.FormatBool(link.Done),
+			formatTime(link.Created),
+			formatTime(link.LastModified),
+			value(link.RecordURL),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// One JSON object per line with every field: the lists first, then the links
+func (e *Export) writeJSONL(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, list := range e.Lists {
+		if err := enc.Encode(struct {
+			Type string `json:"Type"`
+			List
+		}{"list", list}); err != nil {
+			return err
+		}
+	}
+	for _, link := range e.Links {
+		if err := enc.Encode(struct {
+			Type string `json:"Type"`
+			Link
+		}{"link", link}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Type     string        `xml:"type,attr,omitempty"`
+	URL      string        `xml:"url,attr,omitempty"`
+	Category string        `xml:"category,attr,omitempty"`
+	Created  string        `xml:"created,attr,omitempty"`
+	Note     string        `xml:"note,attr,omitempty"`
+	Done     string        `xml:"done,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// OPML 2.0 outline: one outline per list, with the links of the list as children
+// Tags are slash-delimited categories
+func (e *Export) writeOPML(w io.Writer) error {
+	linkOutline := func(link Link) opmlOutline {
+		o := opmlOutline{Text: *link.Name, Type: "link", URL: *link.URL}
+		categories := make([]string, len(link.Tags))
+		for i, tag := range link.Tags {
+			categories[i] = "/" + tag
+		}
+		o.Category = strings.Join(categories, ",")
+		if link.Created != nil {
+			o.Created = link.Created.Format(time.RFC1123Z)
+		}
+		if link.Note != nil {
+			o.Note = *link.Note
+		}
+		if link.Done {
+			o.Done = "true"
+		}
+		return o
+	}
+	body := []opmlOutline{}
+	for _, list := range e.Lists {
+		o := opmlOutline{Text: *list.Name, Outlines: []opmlOutline{}}
+		if list.Note != nil {
+			o.Note = *list.Note
+		}
+		for _, link := range e.Links {
+			if slices.Contains(list.LinkIDs, *link.ID) {
+				o.Outlines = append(o.Outlines, linkOutline(link))
+			}
+		}
+		body = append(body, o)
+	}
+	for _, link := range e.Links {
+		if len(link.ListIDs) == 0 {
+			body = append(body, linkOutline(link))
+		}
+	}
+	doc := struct {
+		XMLName xml.Name `xml:"opml"`
+		Version string   `xml:"version,attr"`
+		Head    struct {
+			Title string `xml:"title"`
+		} `xml:"head"`
+		Body []opmlOutline `xml:"body>outline"`
+	}{Version: "2.0", Body: body}
+	doc.Head.Title = "Links"
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Export to a file, or to stdout if file is "-"
+// Without a file, the export is written to the exports directory of the workflow data
+// Returns the file written and the number of links
+func (a *Airtable) exportLinks(format string, file string, filter ExportFilter) (string, int, error) {
+	ext, ok := exportFormats[format]
+	if !ok {
+		return "", 0, fmt.Errorf("unknown export format: %s", format)
+	}
+	export, err := a.getExport(filter)
+	if err != nil {
+		return "", 0, err
+	}
+	if file == "-" {
+		return file, len(export.Links), export.write(format, os.Stdout)
+	}
+	if file == "" {
+		dir := path.Join(os.Getenv("alfred_workflow_data"), "exports")
+		if err = os.MkdirAll(dir, 0o755); err != nil {
+			return "", 0, err
+		}
+		file = path.Join(dir, "links"+ext)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return "", 0, err
+	}
+	if err = export.write(format, f); err != nil {
+		_ = f.Close()
+		return "", 0, err
+	}
+	logMessage("INFO", "Exported %d links to %s", len(export.Links), file)
+	return file, len(export.Links), f.Close()
+}
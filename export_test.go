@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testExportCache(t *testing.T) *Airtable {
+	airtable := &Airtable{cache: &Cache{file: ":memory:"}}
+	if err := airtable.cache.init(); err != nil {
+		t.Fatalf("init() error = %v", err)
+	}
+	day := func(d int) *time.Time {
+		t := time.Date(2024, 1, d, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+		return &t
+	}
+	_ = airtable.cache.saveLists([]List{
+		{Name: stringPtr("Reading"), Note: stringPtr("To read"), ID: stringPtr("recL2"), Created: day(1)},
+		{Name: stringPtr("Go"), ID: stringPtr("recL1"), Created: day(2)},
+	})
+	_ = airtable.cache.saveLinks([]Link{
+		{Name: stringPtr("Second & last"), URL: stringPtr("https://b.com/?a=1&b=2"), ID: stringPtr("recB"), Created: day(3), LastModified: day(9), Done: true, ListIDs: []string{"recL2", "recL1"}},
+		{Name: stringPtr("First"), URL: stringPtr("https://a.com"), ID: stringPtr("recA"), Created: day(2), LastModified: day(2), Tags: []string{"go", "web"}, Note: stringPtr(`Say "hi"`), ListIDs: []string{"recL1"}},
+		{Name: stringPtr("Loose"), URL: stringPtr("https://c.com"), ID: stringPtr("recC"), Created: day(4), Category: stringPtr("Tool")},
+	})
+	return airtable
+}
+
+func TestExportNetscape(t *testing.T) {
+	airtable := testExportCache(t)
+	export, err := airtable.getExport(ExportFilter{})
+	if err != nil {
+		t.Fatalf("getExport() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if err = export.write("html", &buf); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	want := `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file.
+     It will be read and overwritten.
+     DO NOT EDIT! -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3 ADD_DATE="1704193200">Go</H3>
+    <DL><p>
+        <DT><A HREF="https://a.com" ADD_DATE="1704193200" LAST_MODIFIED="1704193200" TAGS="go,web">First</A>
+        <DD>Say &#34;hi&#34;
+        <DT><A HREF="https://b.com/?a=1&amp;b=2" ADD_DATE="1704279600" LAST_MODIFIED="1704798000">Second &amp; last</A>
+    </DL><p>
+    <DT><H3 ADD_DATE="1704106800">Reading</H3>
+    <DD>To read
+    <DL><p>
+        <DT><A HREF="https://b.com/?a=1&amp;b=2" ADD_DATE="1704279600" LAST_MODIFIED="1704798000">Second &amp; last</A>
+    </DL><p>
+    <DT><A HREF="https://c.com" ADD_DATE="1704366000">Loose</A>
+</DL><p>
+`
+	if got := buf.String(); got != want {
+		t.Errorf("writeNetscape() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	airtable := testExportCache(t)
+	done := false
+	export, _ := airtable.getExport(ExportFilter{Done: &done})
+	var buf bytes.Buffer
+	if err := export.write("csv", &buf); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	want := `ID,Name,URL,Note,Category,Tags,Lists,Done,Created,Last Modified,Record URL
+recA,First,https://a.com,"Say ""hi""",,"go,web",Go,false,2024-01-02T11:00:00Z,2024-01-02T11:00:00Z,
+recC,Loose,https://c.com,,Tool,,,false,2024-01-04T11:00:00Z,,
+`
+	if got := buf.String(); got != want {
+		t.Errorf("writeCSV() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	airtable := testExportCache(t)
+	export, _ := airtable.getExport(ExportFilter{ListID: "recL2"})
+	var buf bytes.Buffer
+	if err := export.write("jsonl", &buf); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("writeJSONL() wrote %d lines, want 2 lists and 1 link:\n%s", len(lines), buf.String())
+	}
+	var link map[string]any
+	if err := json.Unmarshal([]byte(lines[2]), &link); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if link["Type"] != "link" || link["ID"] != "recB" || link["Done"] != true || link["Created"] != "2024-01-03T11:00:00Z" {
+		t.Errorf("writeJSONL() link = %v", link)
+	}
+	if names, _ := link["List-Names"].([]any); len(names) != 2 || names[0] != "Go" {
+		t.Errorf("writeJSONL() list names = %v, want them sorted", link["List-Names"])
+	}
+
+	// The same data always gives the same output
+	var again bytes.Buffer
+	export, _ = airtable.getExport(ExportFilter{ListID: "recL2"})
+	_ = export.write("jsonl", &again)
+	if again.String() != buf.String() {
+		t.Errorf("writeJSONL() is not deterministic")
+	}
+}
+
+func TestExportOPML(t *testing.T) {
+	airtable := testExportCache(t)
+	export, _ := airtable.getExport(ExportFilter{GroupBy: "Tags", Group: "go"})
+	var buf bytes.Buffer
+	if err := export.write("opml", &buf); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	var doc struct {
+		Body []opmlOutline `xml:"body>outline"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid OPML: %v\n%s", err, buf.String())
+	}
+	if len(doc.Body) != 1 || doc.Body[0].Text != "Go" || len(doc.Body[0].Outlines) != 1 {
+		t.Fatalf("writeOPML() = %+v, want the Go list with one link", doc.Body)
+	}
+	link := doc.Body[0].Outlines[0]
+	if link.URL != "https://a.com" || link.Category != "/go,/web" || link.Note != `Say "hi"` {
+		t.Errorf("writeOPML() link = %+v", link)
+	}
+}
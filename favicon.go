@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/net/html"
+)
+
+// Show the icon of each site on its links
+// Icons are fetched in the background and kept as PNG files in the workflow cache
+
+const (
+	faviconSize   = 64
+	faviconMaxAge = 30 * 24 * time.Hour
+	// Hosts without a usable icon are tried again after this
+	faviconRetryAge = 7 * 24 * time.Hour
+	// A fetch that started longer ago than this has failed
+	faviconFetchTimeout = time.Minute
+	faviconSizeLimit    = 1 << 20
+)
+
+var (
+	faviconQueue   []string
+	faviconQueueMu sync.Mutex
+)
+
+func faviconDir() string {
+	return path.Join(os.Getenv("alfred_workflow_cache"), "favicons")
+}
+
+// The file of a host with a suffix: .png, -done.png, .none when there is no icon, .pending while fetching
+func faviconFile(host string, suffix string) string {
+	name := strings.NewReplacer(":", "_", "/", "_").Replace(host)
+	return path.Join(faviconDir(), name+suffix)
+}
+
+func fileAge(file string) (time.Duration, bool) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, false
+	}
+	return time.Since(info.ModTime()), true
+}
+
+// The icon of a host, or nil if there is none yet
+// Missing and expired icons are queued, and fetched in the background once the items are output
+func favicon(host string, done bool) *string {
+	if host == "" || os.Getenv("alfred_workflow_cache") == "" {
+		return nil
+	}
+	file := faviconFile(host, ".png")
+	if done {
+		file = faviconFile(host, "-done.png")
+	}
+	if age, ok := fileAge(file); ok {
+		if age > faviconMaxAge {
+			queueFavicon(host)
+		}
+		return &file
+	}
+	if age, ok := fileAge(faviconFile(host, ".none")); ok && age < faviconRetryAge {
+		return nil
+	}
+	queueFavicon(host)
+	return nil
+}
+
+func queueFavicon(host string) {
+	if age, ok := fileAge(faviconFile(host, ".pending")); ok && age < faviconFetchTimeout {
+		return
+	}
+	faviconQueueMu.Lock()
+	defer faviconQueueMu.Unlock()
+	if !slices.Contains(faviconQueue, host) {
+		faviconQueue = append(faviconQueue, host)
+	}
+}
+
+// Start fetching the queued icons in another process
+func fetchFaviconsInBackground() {
+	faviconQueueMu.Lock()
+	hosts := faviconQueue
+	faviconQueue = nil
+	faviconQueueMu.Unlock()
+	if len(hosts) == 0 {
+		return
+	}
+	if err := os.MkdirAll(faviconDir(), 0o755); err != nil {
+		return
+	}
+	for _, host := range hosts {
+		_ = os.WriteFile(faviconFile(host, ".pending"), nil, 0o644)
+	}
+	runInBackground("mode=fetch-favicons", "hosts="+strings.Join(hosts, ","))
+}
+
+type faviconResult struct {
+	host string
+	img  image.Image
+	err  error
+}
+
+// Fetch the icons of hosts, with a rate limit per host
+func fetchFavicons(hosts []string) {
+	if err := os.MkdirAll(faviconDir(), 0o755); err != nil {
+		logMessage("ERROR", "Error creating the favicon directory: %s", err)
+		return
+	}
+	count := 0
+	crawl(hosts, func(host string) string { return "https://" + host }, func(host string) faviconResult {
+		img, err := fetchFavicon(host)
+		return faviconResult{host, img, err}
+	}, func(r faviconResult) {
+		if err := saveFavicon(r.host, r.img, r.err); err != nil {
+			logMessage("ERROR", "Error saving the icon of %s: %s", r.host, err)
+		} else if r.err == nil {
+			count++
+		}
+	})
+	logMessage("INFO", "Fetched %d icons", count)
+}
+
+// Find the icon of a host: from the <link> tags of its home page, or /favicon.ico
+func fetchFavicon(host string) (image.Image, error) {
+	root := "https://" + host + "/"
+	candidates := []string{}
+	if body, finalURL, err := fetchPage(root); err == nil {
+		candidates = parseIcons(bytes.NewReader(body), finalURL)
+	}
+	candidates = append(candidates, root+"favicon.ico")
+	for _, URL := range candidates {
+		img, err := downloadIcon(URL)
+		if err == nil {
+			return img, nil
+		}
+	}
+	return nil, fmt.Errorf("no icon found for %s", host)
+}
+
+// The icons declared in the <head> of a page, the largest first
+// SVG icons are skipped, since they cannot be converted to PNG
+func parseIcons(r io.Reader, base *url.URL) []string {
+	type icon struct {
+		URL  string
+		size int
+	}
+	icons := []icon{}
+	z := html.NewTokenizer(r)
+loop:
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			break loop
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) == "body" {
+				break loop
+			}
+			if string(name) != "link" {
+				continue
+			}
+			attrs := map[string]string{}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				attrs[string(key)] = strings.TrimSpace(string(val))
+			}
+			rels := strings.Fields(strings.ToLower(attrs["rel"]))
+			touch := slices.Contains(rels, "apple-touch-icon") || slices.Contains(rels, "apple-touch-icon-precomposed")
+			if !touch && !slices.Contains(rels, "icon") {
+				continue
+			}
+			if strings.Contains(attrs["type"], "svg") || strings.HasSuffix(strings.ToLower(attrs["href"]), ".svg") {
+				continue
+			}
+			href := resolveURL(base, attrs["href"])
+			if href == nil {
+				continue
+			}
+			size := 0
+			for s := range strings.FieldsSeq(strings.ToLower(attrs["sizes"])) {
+				if w, _, ok := strings.Cut(s, "x"); ok {
+					if n, err := strconv.Atoi(w); err == nil {
+						size = max(size, n)
+					}
+				}
+			}
+			if size == 0 && touch {
+				size = 180
+			}
+			icons = append(icons, icon{*href, size})
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "head" {
+				break loop
+			}
+		}
+	}
+	slices.SortStableFunc(icons, func(a, b icon) int { return b.size - a.size })
+	URLs := make([]string, len(icons))
+	for i, icon := range icons {
+		URLs[i] = icon.URL
+	}
+	return URLs
+}
+
+func downloadIcon(URL string) (image.Image, error) {
+	req, err := http.NewRequest("GET", URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch icon: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, faviconSizeLimit))
+	if err != nil {
+		return nil, err
+	}
+	img, err := decodeIcon(data)
+	if err != nil {
+		return nil, err
+	}
+	if b := img.Bounds(); b.Dx() < 16 || b.Dy() < 16 {
+		return nil, fmt.Errorf("icon is too small: %dx%d", b.Dx(), b.Dy())
+	}
+	return img, nil
+}
+
+// Decode a PNG, GIF, JPEG or ICO image
+func decodeIcon(data []byte) (image.Image, error) {
+	if bytes.HasPrefix(data, []byte{0, 0, 1, 0}) {
+		return decodeICO(data)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// Decode the largest image of an ICO file, stored either as PNG or as a bitmap
+func decodeICO(data []byte) (image.Image, error) {
+	if len(data) < 6 {
+		return nil, fmt.Errorf("invalid ICO file")
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	best, bestSize, bestBPP := -1, 0, 0
+	if 6+16*count > len(data) {
+		return nil, fmt.Errorf("invalid ICO file")
+	}
+	for i := range count {
+		entry := data[6+16*i:]
+		size := int(entry[0])
+		if size == 0 {
+			size = 256
+		}
+		bpp := int(binary.LittleEndian.Uint16(entry[6:]))
+		if size > bestSize || (size == bestSize && bpp > bestBPP) {
+			best, bestSize, bestBPP = i, size, bpp
+		}
+	}
+	if best < 0 {
+		return nil, fmt.Errorf("empty ICO file")
+	}
+	entry := data[6+16*best:]
+	length := int(binary.LittleEndian.Uint32(entry[8:]))
+	offset := int(binary.LittleEndian.Uint32(entry[12:]))
+	if offset < 0 || length < 0 || offset+length > len(data) {
+		return nil, fmt.Errorf("invalid ICO file")
+	}
+	icon := data[offset : offset+length]
+	if bytes.HasPrefix(icon, []byte("\x89PNG")) {
+		return png.Decode(bytes.NewReader(icon))
+	}
+	return decodeDIB(icon)
+}
+
+// Decode a bitmap without its file header, as stored in ICO files:
+// its height is doubled to include the 1-bit transparency mask after the colors
+func decodeDIB(data []byte) (image.Image, error) {
+	if len(data) < 40 {
+		return nil, fmt.Errorf("invalid bitmap")
+	}
+	headerSize := int(binary.LittleEndian.Uint32(data))
+	width := int(int32(binary.LittleEndian.Uint32(data[4:])))
+	height := int(int32(binary.LittleEndian.Uint32(data[8:]))) / 2
+	bpp := int(binary.LittleEndian.Uint16(data[14:]))
+	colors := int(binary.LittleEndian.Uint32(data[32:]))
+	if width <= 0 || height <= 0 || width > 256 || height > 256 || headerSize < 40 || headerSize > len(data) {
+		return nil, fmt.Errorf("invalid bitmap")
+	}
+	if !slices.Contains([]int{1, 4, 8, 24, 32}, bpp) {
+		return nil, fmt.Errorf("unsupported bitmap depth: %d", bpp)
+	}
+	palette := []color.NRGBA{}
+	pos := headerSize
+	if bpp <= 8 {
+		if colors == 0 {
+			colors = 1 << bpp
+		}
+		if pos+4*colors > len(data) {
+			return nil, fmt.Errorf("invalid bitmap")
+		}
+		for i := range colors {
+			p := data[pos+4*i:]
+			palette = append(palette, color.NRGBA{p[2], p[1], p[0], 255})
+		}
+		pos += 4 * colors
+	}
+	stride := (width*bpp + 31) / 32 * 4
+	maskStride := (width + 31) / 32 * 4
+	if pos+stride*height > len(data) {
+		return nil, fmt.Errorf("invalid bitmap")
+	}
+	mask := data[pos+stride*height:]
+	hasMask := len(mask) >= maskStride*height
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	hasAlpha := false
+	for y := range height {
+		row := data[pos+stride*(height-1-y):]
+		for x := range width {
+			var c color.NRGBA
+			switch bpp {
+			case 32:
+				c = color.NRGBA{row[4*x+2], row[4*x+1], row[4*x], row[4*x+3]}
+				hasAlpha = hasAlpha || c.A != 0
+			case 24:
+				c = color.NRGBA{row[3*x+2], row[3*x+1], row[3*x], 255}
+			default:
+				bit := x * bpp
+				index := int(row[bit/8]>>(8-bpp-bit%8)) & (1<<bpp - 1)
+				if index < len(palette) {
+					c = palette[index]
+				}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	// Old 32-bit icons and the others use the mask for transparency
+	if bpp < 32 || !hasAlpha {
+		for y := range height {
+			for x := range width {
+				transparent := hasMask && mask[maskStride*(height-1-y)+x/8]>>(7-x%8)&1 == 1
+				c := img.NRGBAAt(x, y)
+				c.A = 255
+				if transparent {
+					c.A = 0
+				}
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+	return img, nil
+}
+
+// Save the icon of a host, with a variant for links that are done,
+// or remember that it has none
+func saveFavicon(host string, img image.Image, fetchErr error) error {
+	defer func() { _ = os.Remove(faviconFile(host, ".pending")) }()
+	if fetchErr != nil {
+		logMessage("INFO", "No icon for %s: %s", host, fetchErr)
+		return os.WriteFile(faviconFile(host, ".none"), nil, 0o644)
+	}
+	icon := image.NewNRGBA(image.Rect(0, 0, faviconSize, faviconSize))
+	draw.CatmullRom.Scale(icon, icon.Bounds(), img, img.Bounds(), draw.Over, nil)
+	if err := writePNG(faviconFile(host, ".png"), icon); err != nil {
+		return err
+	}
+	if err := writePNG(faviconFile(host, "-done.png"), doneOverlay(icon)); err != nil {
+		return err
+	}
+	_ = os.Remove(faviconFile(host, ".none"))
+	return nil
+}
+
+func writePNG(file string, img image.Image) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	// Write then rename, so that Alfred never shows a partial file
+	if err := os.WriteFile(file+".tmp", buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// Fade the icon and draw a green check mark badge in the corner
+func doneOverlay(icon *image.NRGBA) *image.NRGBA {
+	out := image.NewNRGBA(icon.Bounds())
+	for i := 0; i < len(icon.Pix); i += 4 {
+		copy(out.Pix[i:i+3], icon.Pix[i:i+3])
+		out.Pix[i+3] = icon.Pix[i+3] / 2
+	}
+	size := float64(faviconSize)
+	cx, cy, r := size*0.72, size*0.72, size*0.27
+	green := color.NRGBA{52, 199, 89, 255}
+	white := color.NRGBA{255, 255, 255, 255}
+	check := [][2]float64{{cx - r*0.45, cy + r*0.02}, {cx - r*0.12, cy + r*0.35}, {cx + r*0.48, cy - r*0.3}}
+	for y := range faviconSize {
+		for x := range faviconSize {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			dist := math.Hypot(px-cx, py-cy)
+			// white border, green disc, white check mark, each anti-aliased by its coverage
+			blend(out, x, y, white, dist-(r+2))
+			blend(out, x, y, green, dist-r)
+			line := math.Min(segmentDistance(px, py, check[0], check[1]), segmentDistance(px, py, check[1], check[2]))
+			blend(out, x, y, white, line-r*0.12)
+		}
+	}
+	return out
+}
+
+// Paint a color over a pixel, given the signed distance of the pixel to the edge of the shape
+func blend(img *image.NRGBA, x, y int, c color.NRGBA, dist float64) {
+	coverage := math.Max(0, math.Min(1, 0.5-dist))
+	if coverage == 0 {
+		return
+	}
+	dst := img.NRGBAAt(x, y)
+	dstAlpha := dst.A
+	a := coverage + float64(dstAlpha)/255*(1-coverage)
+	mix := func(src, dst uint8) uint8 {
+		return uint8((float64(src)*coverage + float64(dst)*float64(dstAlpha)/255*(1-coverage)) / a)
+	}
+	img.SetNRGBA(x, y, color.NRGBA{mix(c.R, dst.R), mix(c.G, dst.G), mix(c.B, dst.B), uint8(a * 255)})
+}
+
+func segmentDistance(px, py float64, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t := math.Max(0, math.Min(1, ((px-a[0])*dx+(py-a[1])*dy)/(dx*dx+dy*dy)))
+	return math.Hypot(px-a[0]-t*dx, py-a[1]-t*dy)
+}
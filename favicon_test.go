@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseIcons(t *testing.T) {
+	page := `<html><head>
+<link rel="icon" href="/favicon-16.png" sizes="16x16">
+<link rel="icon" type="image/svg+xml" href="/icon.svg">
+<link rel="mask-icon" href="/mask.png">
+<link rel="apple-touch-icon" href="/touch.png">
+<link rel="shortcut icon" href="https://cdn.example.com/favicon.ico">
+<link rel="icon" href="/favicon-32.png" sizes="32x32">
+</head><body><link rel="icon" href="/late.png"></body></html>`
+	base, _ := url.Parse("https://example.com/post")
+	got := parseIcons(strings.NewReader(page), base)
+	want := []string{
+		"https://example.com/touch.png",
+		"https://example.com/favicon-32.png",
+		"https://example.com/favicon-16.png",
+		"https://cdn.example.com/favicon.ico",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseIcons() = %v, want %v", got, want)
+	}
+}
+
+// Build an ICO file from its images: PNG data, or bitmaps given as [width, bpp]
+func buildICO(images ...any) []byte {
+	entries := []byte{}
+	data := [][]byte{}
+	for _, img := range images {
+		var d []byte
+		var size, bpp int
+		switch img := img.(type) {
+		case []byte:
+			d, size, bpp = img, 32, 32
+		case [2]int:
+			size, bpp = img[0], img[1]
+			var buf bytes.Buffer
+			header := make([]byte, 40)
+			binary.LittleEndian.PutUint32(header, 40)
+			binary.LittleEndian.PutUint32(header[4:], uint32(size))
+			binary.LittleEndian.PutUint32(header[8:], uint32(size*2))
+			binary.LittleEndian.PutUint16(header[12:], 1)
+			binary.LittleEndian.PutUint16(header[14:], uint16(bpp))
+			buf.Write(header)
+			stride := (size*bpp + 31) / 32 * 4
+			for y := range size {
+				row := make([]byte, stride)
+				for x := range size {
+					// red, with the bottom-left pixel (first row in the file) blue
+					b, r := byte(0), byte(255)
+					if x == 0 && y == 0 {
+						b, r = 255, 0
+					}
+					switch bpp {
+					case 32:
+						copy(row[4*x:], []byte{b, 0, r, 255})
+					case 24:
+						copy(row[3*x:], []byte{b, 0, r})
+					}
+				}
+				buf.Write(row)
+			}
+			// The mask makes the top-left pixel (last row in the file) transparent
+			maskStride := (size + 31) / 32 * 4
+			for y := range size {
+				row := make([]byte, maskStride)
+				if y == size-1 {
+					row[0] = 0x80
+				}
+				buf.Write(row)
+			}
+			d = buf.Bytes()
+		}
+		entry := make([]byte, 16)
+		entry[0], entry[1] = byte(size), byte(size)
+		binary.LittleEndian.PutUint16(entry[4:], 1)
+		binary.LittleEndian.PutUint16(entry[6:], uint16(bpp))
+		binary.LittleEndian.PutUint32(entry[8:], uint32(len(d)))
+		entries = append(entries, entry...)
+		data = append(data, d)
+	}
+	out := []byte{0, 0, 1, 0, byte(len(images)), 0}
+	offset := len(out) + len(entries)
+	for i, d := range data {
+		binary.LittleEndian.PutUint32(entries[16*i+12:], uint32(offset))
+		offset += len(d)
+	}
+	out = append(out, entries...)
+	for _, d := range data {
+		out = append(out, d...)
+	}
+	return out
+}
+
+func TestDecodeICO(t *testing.T) {
+	var pngData bytes.Buffer
+	_ = png.Encode(&pngData, image.NewNRGBA(image.Rect(0, 0, 32, 32)))
+
+	img, err := decodeIcon(buildICO([2]int{16, 32}, pngData.Bytes()))
+	if err != nil {
+		t.Fatalf("decodeIcon() error = %v", err)
+	}
+	if img.Bounds().Dx() != 32 {
+		t.Errorf("decodeIcon() picked a %dpx image, want the 32px PNG", img.Bounds().Dx())
+	}
+
+	for _, bpp := range []int{24, 32} {
+		t.Run(fmt.Sprintf("%d bits", bpp), func(t *testing.T) {
+			img, err := decodeIcon(buildICO([2]int{16, bpp}))
+			if err != nil {
+				t.Fatalf("decodeIcon() error = %v", err)
+			}
+			if c := color.NRGBAModel.Convert(img.At(0, 15)).(color.NRGBA); c != (color.NRGBA{0, 0, 255, 255}) {
+				t.Errorf("bottom-left pixel = %v, want blue", c)
+			}
+			if c := color.NRGBAModel.Convert(img.At(5, 5)).(color.NRGBA); c != (color.NRGBA{255, 0, 0, 255}) {
+				t.Errorf("pixel = %v, want red", c)
+			}
+			_, _, _, a := img.At(0, 0).RGBA()
+			if bpp == 24 && a != 0 {
+				t.Errorf("top-left pixel is not transparent")
+			}
+		})
+	}
+
+	if _, err := decodeIcon([]byte{0, 0, 1, 0, 5, 0}); err == nil {
+		t.Errorf("decodeIcon() of a truncated file should fail")
+	}
+}
+
+func TestFavicon(t *testing.T) {
+	t.Setenv("alfred_workflow_cache", t.TempDir())
+	defer func() { faviconQueue = nil }()
+	_ = os.MkdirAll(faviconDir(), 0o755)
+
+	if got := favicon("example.com", false); got != nil {
+		t.Errorf("favicon() = %v before fetching, want nil", *got)
+	}
+	if !slices.Contains(faviconQueue, "example.com") {
+		t.Errorf("favicon() did not queue example.com")
+	}
+
+	if err := saveFavicon("example.com", image.NewNRGBA(image.Rect(0, 0, 16, 16)), nil); err != nil {
+		t.Fatalf("saveFavicon() error = %v", err)
+	}
+	if got := favicon("example.com", true); got == nil || *got != faviconFile("example.com", "-done.png") {
+		t.Errorf("favicon() = %v, want the done icon", got)
+	}
+	data, _ := os.ReadFile(faviconFile("example.com", ".png"))
+	if img, err := png.Decode(bytes.NewReader(data)); err != nil || img.Bounds().Dx() != faviconSize {
+		t.Errorf("saved icon is not a %dpx PNG: %v", faviconSize, err)
+	}
+
+	// Hosts without an icon are not fetched again until they expire
+	faviconQueue = nil
+	_ = saveFavicon("noicon.com", nil, fmt.Errorf("no icon"))
+	if got := favicon("noicon.com", false); got != nil || len(faviconQueue) != 0 {
+		t.Errorf("favicon() = %v with queue %v, want nil and nothing queued", got, faviconQueue)
+	}
+}
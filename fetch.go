@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// Fetch the title and other metadata of web pages
+
+const (
+	fetchTimeout   = 10 * time.Second
+	fetchSizeLimit = 2 << 20
+	userAgent      = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15"
+)
+
+type PageMeta struct {
+	URL         string
+	Title       *string
+	Description *string
+	Canonical   *string
+	Image       *string
+	SiteName    *string
+	FetchedAt   *time.Time
+	Error       *string
+}
+
+var httpClient = &http.Client{Timeout: fetchTimeout}
+
+// Download a page, up to the size limit, and decode it to UTF-8
+// Returns the decoded body and the final URL after redirects
+func fetchPage(URL string) ([]byte, *url.URL, error) {
+	req, err := http.NewRequest("GET", URL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.Request.URL, fmt.Errorf("failed to fetch page: %s", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		return nil, resp.Request.URL, fmt.Errorf("not an HTML page: %s", contentType)
+	}
+
+	// Detect the charset from the header, a BOM or <meta charset>, e.g. GBK for Chinese sites
+	reader, err := charset.NewReader(io.LimitReader(resp.Body, fetchSizeLimit), contentType)
+	if err != nil {
+		return nil, resp.Request.URL, err
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, resp.Request.URL, err
+	}
+	return body, resp.Request.URL, nil
+}
+
+func fetchPageMeta(URL string) (*PageMeta, error) {
+	body, finalURL, err := fetchPage(URL)
+	if err != nil {
+		return nil, err
+	}
+	meta := parsePageMeta(strings.NewReader(string(body)), finalURL)
+	meta.URL = URL
+	now := time.Now()
+	meta.FetchedAt = &now
+	logMessage("INFO", "Fetched metadata of %s", URL)
+	return meta, nil
+}
+
+// Extract the metadata from the <head> of a page
+// Relative URLs are resolved against base
+func parsePageMeta(r io.Reader, base *url.URL) *PageMeta {
+	meta := PageMeta{}
+	var title, description, ogTitle, ogDescription string
+	z := html.NewTokenizer(r)
+	inTitle := false
+loop:
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			break loop
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := map[string]string{}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				attrs[string(key)] = strings.TrimSpace(string(val))
+			}
+			switch string(name) {
+			case "title":
+				inTitle = title == ""
+			case "meta":
+				key := strings.ToLower(attrs["property"])
+				if key == "" {
+					key = strings.ToLower(attrs["name"])
+				}
+				switch key {
+				case "description":
+					description = attrs["content"]
+				case "og:title":
+					ogTitle = attrs["content"]
+				case "og:description":
+					ogDescription = attrs["content"]
+				case "og:image":
+					meta.Image = resolveURL(base, attrs["content"])
+				case "og:site_name":
+					meta.SiteName = nonEmpty(attrs["content"])
+				case "og:url":
+					if meta.Canonical == nil {
+						meta.Canonical = resolveURL(base, attrs["content"])
+					}
+				}
+			case "link":
+				if strings.EqualFold(attrs["rel"], "canonical") {
+					meta.Canonical = resolveURL(base, attrs["href"])
+				}
+			case "body":
+				break loop
+			}
+		case html.TextToken:
+			if inTitle {
+				title += string(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				break loop
+			}
+		}
+	}
+
+	meta.Title = nonEmpty(collapseSpaces(title))
+	if meta.Title == nil {
+		meta.Title = nonEmpty(collapseSpaces(ogTitle))
+	}
+	meta.Description = nonEmpty(collapseSpaces(description))
+	if meta.Description == nil {
+		meta.Description = nonEmpty(collapseSpaces(ogDescription))
+	}
+	return &meta
+}
+
+func resolveURL(base *url.URL, ref string) *string {
+	if ref == "" {
+		return nil
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	return stringPtr(u.String())
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// Tags whose content is not part of the readable text
+var skipTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true, "iframe": true,
+	"nav": true, "header": true, "footer": true, "aside": true, "form": true, "button": true,
+}
+
+// Tags that start a new line of text
+var blockTags = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true, "br": true, "hr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"li": true, "dt": true, "dd": true, "pre": true, "blockquote": true, "figcaption": true,
+	"tr": true, "td": true, "th": true, "table": true, "ul": true, "ol": true, "dl": true,
+}
+
+// Extract the readable text of a page: the content of <article> or <main> if there is one,
+// or the <body> without navigation, scripts and styles
+func extractText(r io.Reader) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+	var find func(n *html.Node, tag string) *html.Node
+	find = func(n *html.Node, tag string) *html.Node {
+		if n.Type == html.ElementNode && n.Data == tag {
+			return n
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if found := find(c, tag); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	root := doc
+	for _, tag := range []string{"article", "main", "body"} {
+		if n := find(doc, tag); n != nil {
+			root = n
+			break
+		}
+	}
+
+	var text strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			text.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if skipTags[n.Data] {
+				return
+			}
+		}
+		if blockTags[n.Data] {
+			text.WriteString("\n")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if blockTags[n.Data] {
+			text.WriteString("\n")
+		}
+	}
+	walk(root)
+
+	lines := []string{}
+	for line := range strings.SplitSeq(text.String(), "\n") {
+		if line = collapseSpaces(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestParsePageMeta(t *testing.T) {
+	page := `<!DOCTYPE html>
+<html><head>
+<title>
+  Example &amp; Co
+</title>
+<meta name="description" content="An example page">
+<meta property="og:image" content="/cover.png">
+<meta property="og:site_name" content="Example">
+<link rel="canonical" href="https://example.com/post">
+</head><body><title>Not this</title></body></html>`
+	base, _ := url.Parse("https://example.com/post?utm_source=x")
+	meta := parsePageMeta(strings.NewReader(page), base)
+
+	if meta.Title == nil || *meta.Title != "Example & Co" {
+		t.Errorf("parsePageMeta() title = %v, expected 'Example & Co'", meta.Title)
+	}
+	if meta.Description == nil || *meta.Description != "An example page" {
+		t.Errorf("parsePageMeta() description = %v", meta.Description)
+	}
+	if meta.Image == nil || *meta.Image != "https://example.com/cover.png" {
+		t.Errorf("parsePageMeta() image = %v", meta.Image)
+	}
+	if meta.Canonical == nil || *meta.Canonical != "https://example.com/post" {
+		t.Errorf("parsePageMeta() canonical = %v", meta.Canonical)
+	}
+	if meta.SiteName == nil || *meta.SiteName != "Example" {
+		t.Errorf("parsePageMeta() site name = %v", meta.SiteName)
+	}
+}
+
+func TestFetchPageMeta(t *testing.T) {
+	page, _ := simplifiedchinese.GBK.NewEncoder().String(`<html><head><meta charset="gbk"><title>中文标题</title></head></html>`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	meta, err := fetchPageMeta(server.URL)
+	if err != nil {
+		t.Fatalf("fetchPageMeta() error = %v", err)
+	}
+	if meta.Title == nil || *meta.Title != "中文标题" {
+		t.Errorf("fetchPageMeta() title = %v, expected '中文标题'", meta.Title)
+	}
+}
+
+func TestExtractText(t *testing.T) {
+	page := `<html><head><title>Title</title><style>p { color: red }</style></head>
+<body>
+<nav><a href="/">Home</a> <a href="/about">About</a></nav>
+<article>
+  <h1>The   heading</h1>
+  <p>First <b>paragraph</b>.</p>
+  <script>alert("no")</script>
+  <ul><li>One</li><li>Two</li></ul>
+</article>
+<footer>Copyright</footer>
+</body></html>`
+	text, err := extractText(strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("extractText() error = %v", err)
+	}
+	want := "The heading\nFirst paragraph.\nOne\nTwo"
+	if text != want {
+		t.Errorf("extractText() = %q, want %q", text, want)
+	}
+
+	text, _ = extractText(strings.NewReader(`<body><nav>Menu</nav><div>Body text</div><footer>Footer</footer></body>`))
+	if text != "Body text" {
+		t.Errorf("extractText() without article = %q, want %q", text, "Body text")
+	}
+}
@@ -6,6 +6,9 @@ require (
 	github.com/joho/godotenv v1.5.1
 	github.com/mattn/go-sqlite3 v1.14.44
 	github.com/mozillazg/go-pinyin v0.21.0
+	golang.org/x/image v0.36.0
+	golang.org/x/net v0.50.0
 	golang.org/x/oauth2 v0.36.0
+	golang.org/x/text v0.34.0
 	golang.org/x/time v0.15.0
 )
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Check saved links for dead pages and redirects
+
+const (
+	checkWorkers = 8
+	// Minimum time between two requests to the same host
+	checkHostInterval = 2 * time.Second
+	// A check that started longer ago than this is considered interrupted
+	checkRunTimeout = 30 * time.Minute
+)
+
+type LinkHealth struct {
+	ID        string
+	URL       string
+	Status    int
+	FinalURL  *string
+	CheckedAt *time.Time
+	Error     *string
+}
+
+// Not found, gone, server errors and unreachable hosts
+// 401, 403 and 429 usually mean the site is blocking the checker, not that the page is gone
+func (h *LinkHealth) broken() bool {
+	if h.CheckedAt == nil {
+		return false
+	}
+	if h.Error != nil {
+		return true
+	}
+	return h.Status >= 400 && !slices.Contains([]int{401, 403, 429}, h.Status)
+}
+
+func (h *LinkHealth) redirected() bool {
+	return h.CheckedAt != nil && !h.broken() && h.FinalURL != nil && normalizeURL(*h.FinalURL) != normalizeURL(h.URL)
+}
+
+// Links are rechecked after CHECK_MAX_AGE days, 7 by default
+func checkMaxAge() time.Duration {
+	if days, err := time.ParseDuration(os.Getenv("CHECK_MAX_AGE") + "h"); err == nil && days >= 0 {
+		return days * 24
+	}
+	return 7 * 24 * time.Hour
+}
+
+func deadTag() string {
+	if tag := os.Getenv("DEAD_TAG"); tag != "" {
+		return tag
+	}
+	return "dead"
+}
+
+// Rate limiters per host, so that checking many links of the same site does not hammer it
+type hostLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func (h *hostLimiter) wait(URL string) error {
+	host := URL
+	if u, err := url.Parse(URL); err == nil {
+		host = strings.ToLower(u.Hostname())
+	}
+	h.mu.Lock()
+	if h.limiters == nil {
+		h.limiters = map[string]*rate.Limiter{}
+	}
+	limiter, ok := h.limiters[host]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Every(checkHostInterval), 1)
+		h.limiters[host] = limiter
+	}
+	h.mu.Unlock()
+	return limiter.Wait(ctx)
+}
+
+// Run fetch on many jobs concurrently, with a rate limit per host
+// The results are passed to save one at a time, in the calling goroutine
+func crawl[J, R any](jobs []J, jobURL func(J) string, fetch func(J) R, save func(R)) {
+	jobsChan := make(chan J)
+	results := make(chan R)
+	limiter := &hostLimiter{}
+	var wg sync.WaitGroup
+	for range min(checkWorkers, len(jobs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobsChan {
+				if err := limiter.wait(jobURL(job)); err != nil {
+					continue
+				}
+				results <- fetch(job)
+			}
+		}()
+	}
+	go func() {
+		for _, job := range jobs {
+			jobsChan <- job
+		}
+		close(jobsChan)
+		wg.Wait()
+		close(results)
+	}()
+	for result := range results {
+		save(result)
+	}
+}
+
+// Request a URL and record its status and the URL it redirects to
+// Falls back to GET for servers that do not support HEAD
+func checkURL(URL string) LinkHealth {
+	h := LinkHealth{URL: URL}
+	resp, err := checkRequest("HEAD", URL)
+	if err != nil || slices.Contains([]int{403, 404, 405, 501}, resp.StatusCode) {
+		resp, err = checkRequest("GET", URL)
+	}
+	now := time.Now().UTC()
+	h.CheckedAt = &now
+	if err != nil {
+		h.Error = stringPtr(err.Error())
+		return h
+	}
+	h.Status = resp.StatusCode
+	if final := resp.Request.URL.String(); final != URL {
+		h.FinalURL = &final
+	}
+	return h
+}
+
+func checkRequest(method, URL string) (*http.Response, error) {
+	req, err := http.NewRequest(method, URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, fetchSizeLimit))
+	_ = resp.Body.Close()
+	return resp, nil
+}
+
+// Whether a check is running in another process
+func (c *Cache) linkCheckRunning() bool {
+	started, _ := c.getData("LinkCheckStartedAt")
+	if started == nil {
+		return false
+	}
+	startedAt, err := time.Parse(time.RFC3339, *started)
+	if err != nil || time.Since(startedAt) > checkRunTimeout {
+		return false
+	}
+	finished, _ := c.getData("LinkCheckFinishedAt")
+	if finished == nil {
+		return true
+	}
+	finishedAt, err := time.Parse(time.RFC3339, *finished)
+	return err != nil || finishedAt.Before(startedAt)
+}
+
+// The links whose last check is older than maxAge, those never checked first
+func staleLinks(health []LinkHealth, maxAge time.Duration) []LinkHealth {
+	stale := []LinkHealth{}
+	for _, h := range health {
+		if h.CheckedAt == nil || time.Since(*h.CheckedAt) >= maxAge {
+			stale = append(stale, h)
+		}
+	}
+	slices.SortStableFunc(stale, func(a, b LinkHealth) int {
+		switch {
+		case a.CheckedAt == nil && b.CheckedAt == nil:
+			return 0
+		case a.CheckedAt == nil:
+			return -1
+		case b.CheckedAt == nil:
+			return 1
+		}
+		return a.CheckedAt.Compare(*b.CheckedAt)
+	})
+	return stale
+}
+
+// Check the links that are stale, or all of them if force is set
+// Each result is saved as soon as it comes in, so an interrupted check resumes where it stopped
+// Returns the number of links checked
+func (a *Airtable) checkLinks(force bool) (int, error) {
+	if a.cache.linkCheckRunning() {
+		return 0, fmt.Errorf("links are already being checked")
+	}
+	health, err := a.cache.getLinkHealth()
+	if err != nil {
+		return 0, err
+	}
+	maxAge := checkMaxAge()
+	if force {
+		maxAge = 0
+	}
+	stale := staleLinks(health, maxAge)
+	if len(stale) == 0 {
+		return 0, nil
+	}
+	_ = a.cache.setData("LinkCheckStartedAt", time.Now().Format(time.RFC3339))
+	defer func() { _ = a.cache.setData("LinkCheckFinishedAt", time.Now().Format(time.RFC3339)) }()
+
+	count := 0
+	crawl(stale, func(job LinkHealth) string { return job.URL }, func(job LinkHealth) LinkHealth {
+		h := checkURL(job.URL)
+		h.ID = job.ID
+		return h
+	}, func(h LinkHealth) {
+		if err := a.cache.saveLinkHealth(&h); err == nil {
+			count++
+		}
+	})
+	logMessage("INFO", "Checked %d links", count)
+	return count, nil
+}
+
+// Summarize the problems found by the last checks
+func healthSummary(health []LinkHealth) (broken int, redirected int) {
+	for _, h := range health {
+		if h.broken() {
+			broken++
+		} else if h.redirected() {
+			redirected++
+		}
+	}
+	return
+}
+
+func (h *LinkHealth) describe() string {
+	switch {
+	case h.Error != nil:
+		return "􀇿 " + *h.Error
+	case h.broken():
+		return fmt.Sprintf("􀇿 %d %s", h.Status, http.StatusText(h.Status))
+	case h.redirected():
+		return "􀄫 " + *h.FinalURL
+	}
+	return ""
+}
+
+// List the broken and redirected links
+// Stale links are checked in the background while the list is shown
+func (a *Airtable) listLinkHealth() {
+	wf := Workflow{}
+	health, err := a.cache.getLinkHealth()
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+		wf.output()
+		return
+	}
+
+	stale := len(staleLinks(health, checkMaxAge()))
+	broken, redirected := healthSummary(health)
+	summary := fmt.Sprintf("%d broken  ·  %d redirected  ·  %d of %d links checked", broken, redirected, len(health)-stale, len(health))
+	if a.cache.linkCheckRunning() {
+		wf.addItem(Item{
+			Title:    "Checking Links…",
+			Subtitle: summary,
+			Valid:    boolPtr(false),
+			Icon:     &Icon{Path: stringPtr("media/reload.png")},
+		})
+		wf.rerun(2)
+	} else {
+		// Links that could not be saved stay stale, so don't start again right after a check
+		finished, _ := a.cache.getData("LinkCheckFinishedAt")
+		recent := false
+		if finished != nil {
+			finishedAt, err := time.Parse(time.RFC3339, *finished)
+			recent = err == nil && time.Since(finishedAt) < time.Minute
+		}
+		if stale > 0 && !recent {
+			runInBackground("mode=check-links")
+			wf.rerun(1)
+		}
+		wf.addItem(Item{
+			Title:    "Check All Links Again",
+			Subtitle: summary,
+			Icon:     &Icon{Path: stringPtr("media/reload.png")},
+			Variables: map[string]string{
+				"force": "true",
+				"exec":  "check-links",
+			},
+		})
+	}
+
+	problems := map[string]LinkHealth{}
+	ids := []string{}
+	for _, h := range health {
+		if h.broken() || h.redirected() {
+			problems[h.ID] = h
+			ids = append(ids, h.ID)
+		}
+	}
+	links, err := a.cache.getLinksByIDs(ids)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+		wf.output()
+		return
+	}
+	dead := deadTag()
+	for _, link := range links {
+		if slices.Contains(link.Tags, dead) {
+			continue
+		}
+		h := problems[*link.ID]
+		view := link.view()
+		view.Subtitle = h.describe()
+		if h.redirected() {
+			view.setAction(modAction("cmd", "Update URL to "+*h.FinalURL, "media/edit.png", map[string]string{
+				"ID":   *link.ID,
+				"URL":  *h.FinalURL,
+				"exec": "update-url",
+			}))
+		} else {
+			view.removeAction("cmd")
+		}
+		view.setAction(modAction("shift", "Tag as 􀆃"+dead, "media/tag.png", map[string]string{
+			"IDs":        *link.ID,
+			"bulkAction": "tag",
+			"value":      dead,
+			"exec":       "bulk-update",
+		}))
+		wf.addView(view)
+	}
+	wf.output()
+}
+
+// Replace the URL of a link, e.g. with the target of its redirect
+func (a *Airtable) updateURL(ID string, URL string) error {
+	links, err := a.cache.getLinksByIDs([]string{ID})
+	if err != nil {
+		return err
+	}
+	if len(links) == 0 {
+		return fmt.Errorf("link %s not found", ID)
+	}
+	_, err = a.updateLinks(links, func(link Link) map[string]any {
+		return map[string]any{"URL": URL}
+	})
+	return err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/new":
+			w.WriteHeader(http.StatusOK)
+		case "/no-head":
+			if r.Method == "HEAD" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path       string
+		status     int
+		broken     bool
+		redirected bool
+	}{
+		{"/ok", 200, false, false},
+		{"/old", 200, false, true},
+		{"/no-head", 200, false, false},
+		{"/gone", 404, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			h := checkURL(server.URL + tt.path)
+			if h.Status != tt.status {
+				t.Errorf("Status = %d, want %d", h.Status, tt.status)
+			}
+			if h.broken() != tt.broken {
+				t.Errorf("broken() = %v, want %v", h.broken(), tt.broken)
+			}
+			if h.redirected() != tt.redirected {
+				t.Errorf("redirected() = %v, want %v", h.redirected(), tt.redirected)
+			}
+		})
+	}
+
+	h := checkURL("http://127.0.0.1:1/unreachable")
+	if h.Error == nil || !h.broken() {
+		t.Errorf("checkURL() of an unreachable host = %+v, expected an error", h)
+	}
+}
+
+func TestStaleLinks(t *testing.T) {
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	health := []LinkHealth{
+		{ID: "recOld", CheckedAt: &old},
+		{ID: "recRecent", CheckedAt: &recent},
+		{ID: "recNew"},
+	}
+	stale := staleLinks(health, 7*24*time.Hour)
+	if len(stale) != 2 || stale[0].ID != "recNew" || stale[1].ID != "recOld" {
+		t.Errorf("staleLinks() = %+v, want recNew then recOld", stale)
+	}
+	if all := staleLinks(health, 0); len(all) != 3 {
+		t.Errorf("staleLinks() with no max age returned %d links, want 3", len(all))
+	}
+}
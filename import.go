@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Import bookmarks exported by other services and browsers
+// Folders become lists, tags stay tags and the read state becomes Done
+
+var importFormats = map[string]string{
+	"pocket":   "Pocket CSV",
+	"raindrop": "Raindrop CSV",
+	"netscape": "Bookmarks HTML",
+	"chrome":   "Chrome Bookmarks",
+}
+
+// Links are uploaded in batches; the cache and the progress are saved after each batch,
+// so an interrupted import continues where it stopped
+const importBatchSize = 10
+
+// Guess the format from the file extension and, for CSV files, from the header
+func detectImportFormat(file string, data []byte) (string, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".html", ".htm":
+		return "netscape", nil
+	case ".csv":
+		header, err := csv.NewReader(bytes.NewReader(data)).Read()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case slices.Contains(header, "folder"):
+			return "raindrop", nil
+		case slices.Contains(header, "time_added") || slices.Contains(header, "status"):
+			return "pocket", nil
+		}
+	case ".json", "":
+		if bytes.Contains(data, []byte(`"roots"`)) {
+			return "chrome", nil
+		}
+	}
+	return "", fmt.Errorf("unknown bookmark format: %s", filepath.Base(file))
+}
+
+// Parse a bookmark file into links
+// The folders of a link are in ListNames
+func parseImport(format string, r io.Reader) ([]Link, error) {
+	switch format {
+	case "pocket":
+		return parsePocket(r)
+	case "raindrop":
+		return parseRaindrop(r)
+	case "netscape":
+		return parseNetscape(r)
+	case "chrome":
+		return parseChrome(r)
+	}
+	return nil, fmt.Errorf("unknown import format: %s", format)
+}
+
+// Read a CSV file into rows keyed by the column names of its header
+func readCSV(r io.Reader) ([]map[string]string, error) {
+	c := csv.NewReader(r)
+	c.FieldsPerRecord = -1
+	records, err := c.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	header := records[0]
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for i, value := range record {
+			if i < len(header) {
+				row[strings.TrimSpace(header[i])] = strings.TrimSpace(value)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func splitTags(s string, sep string) []string {
+	tags := []string{}
+	for tag := range strings.SplitSeq(s, sep) {
+		if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func importedLink(name, URL, note string, tags []string, folder string, done bool) Link {
+	link := Link{
+		Name: stringPtr(collapseSpaces(name)),
+		URL:  stringPtr(strings.TrimSpace(URL)),
+		Tags: tags,
+		Done: done,
+	}
+	if *link.Name == "" {
+		link.Name = link.URL
+	}
+	if note = strings.TrimSpace(note); note != "" {
+		link.Note = &note
+	}
+	if folder != "" {
+		link.ListNames = []string{folder}
+	}
+	return link
+}
+
+// Pocket: title, url, time_added, tags, status
+// Tags are separated by |, archived items are read
+func parsePocket(r io.Reader) ([]Link, error) {
+	rows, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	links := []Link{}
+	for _, row := range rows {
+		links = append(links, importedLink(row["title"], row["url"], "", splitTags(row["tags"], "|"), "", row["status"] == "archive"))
+	}
+	return links, nil
+}
+
+// Raindrop: id, title, note, excerpt, url, folder, tags, created, cover, highlights, favorite
+// Nested folders are separated by /, unsorted items have no folder
+func parseRaindrop(r io.Reader) ([]Link, error) {
+	rows, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	links := []Link{}
+	for _, row := range rows {
+		folder := strings.Join(splitTags(row["folder"], "/"), " / ")
+		if folder == "Unsorted" {
+			folder = ""
+		}
+		links = append(links, importedLink(row["title"], row["url"], row["note"], splitTags(row["tags"], ","), folder, false))
+	}
+	return links, nil
+}
+
+// Netscape bookmark file, as exported by browsers, Pocket and most bookmark services
+// H3 headings open folders, the toolbar folder of browsers is not a list
+// Pocket's export puts read items under a "Read Archive" heading
+func parseNetscape(r io.Reader) ([]Link, error) {
+	links := []Link{}
+	z := html.NewTokenizer(r)
+	folders := []string{}
+	var pending *string
+	done := false
+	// The element whose text is being read
+	reading := ""
+	var text strings.Builder
+	// The last link, which a DD describes
+	current := -1
+	attrs := map[string]string{}
+
+	finish := func() {
+		value := html.UnescapeString(text.String())
+		text.Reset()
+		switch reading {
+		case "h1":
+			done = strings.Contains(strings.ToLower(value), "archive")
+		case "h3":
+			if attrs["personal_toolbar_folder"] == "true" {
+				value = ""
+			}
+			pending = stringPtr(collapseSpaces(value))
+		case "a":
+			path := []string{}
+			for _, folder := range folders {
+				if folder != "" {
+					path = append(path, folder)
+				}
+			}
+			link := importedLink(value, attrs["href"], "", splitTags(attrs["tags"], ","), strings.Join(path, " / "), done)
+			links = append(links, link)
+			current = len(links) - 1
+		case "dd":
+			if current >= 0 {
+				if note := strings.TrimSpace(value); note != "" {
+					links[current].Note = &note
+				}
+			}
+		}
+		reading = ""
+	}
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				finish()
+				return links, nil
+			}
+			return nil, z.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			switch token.Data {
+			case "h1", "h3", "a", "dd":
+				finish()
+				reading = token.Data
+				attrs = map[string]string{}
+				for _, attr := range token.Attr {
+					attrs[strings.ToLower(attr.Key)] = attr.Val
+				}
+				if token.Data != "dd" {
+					current = -1
+				}
+			case "dl", "ul":
+				finish()
+				folder := ""
+				if pending != nil {
+					folder = *pending
+					pending = nil
+				}
+				folders = append(folders, folder)
+			case "dt", "li":
+				finish()
+			}
+		case html.EndTagToken:
+			switch name, _ := z.TagName(); string(name) {
+			case "h1", "h3", "a":
+				finish()
+			case "dl", "ul":
+				finish()
+				if len(folders) > 0 {
+					folders = folders[:len(folders)-1]
+				}
+			}
+		case html.TextToken:
+			if reading != "" {
+				text.Write(z.Raw())
+			}
+		}
+	}
+}
+
+type chromeNode struct {
+	Type     string       `json:"type"`
+	Name     string       `json:"name"`
+	URL      string       `json:"url"`
+	Children []chromeNode `json:"children"`
+}
+
+// Chrome's Bookmarks file, also used by Edge, Brave and Vivaldi
+// The bookmark bar and the other roots are not lists
+func parseChrome(r io.Reader) ([]Link, error) {
+	var file struct {
+		Roots map[string]json.RawMessage `json:"roots"`
+	}
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+	links := []Link{}
+	visit := func(node chromeNode, path []string) {
+		if node.Type == "url" {
+			links = append(links, importedLink(node.Name, node.URL, "", nil, strings.Join(path, " / "), false))
+		}
+	}
+	roots := []string{}
+	for name := range file.Roots {
+		roots = append(roots, name)
+	}
+	// The roots in the order shown by the browser
+	slices.SortFunc(roots, func(a, b string) int {
+		order := []string{"bookmark_bar", "other", "synced"}
+		i, j := slices.Index(order, a), slices.Index(order, b)
+		if i != j {
+			return i - j
+		}
+		return strings.Compare(a, b)
+	})
+	for _, name := range roots {
+		var root chromeNode
+		if err := json.Unmarshal(file.Roots[name], &root); err != nil {
+			continue
+		}
+		for _, child := range root.Children {
+			walkChrome(child, nil, visit)
+		}
+	}
+	return links, nil
+}
+
+// Folders below the roots add their name to the path
+func walkChrome(node chromeNode, path []string, visit func(chromeNode, []string)) {
+	if node.Type != "folder" {
+		visit(node, path)
+		return
+	}
+	path = append(slices.Clone(path), collapseSpaces(node.Name))
+	for _, child := range node.Children {
+		walkChrome(child, path, visit)
+	}
+}
+
+// What an import will do
+type ImportPlan struct {
+	File   string
+	Format string
+	Hash   string
+	// Links to upload, with their folders in ListNames
+	Links []Link
+	// Lists to create
+	NewLists []string
+	// Lists already in the base, by name
+	Lists      map[string]string
+	Total      int
+	Duplicates int
+	Invalid    int
+	Done       int
+	// Links uploaded by an earlier, interrupted run of the same import
+	Uploaded int
+}
+
+type importProgress struct {
+	Hash     string
+	Total    int
+	Uploaded int
+}
+
+func (c *Cache) getImportProgress() importProgress {
+	progress := importProgress{}
+	if data, _ := c.getData("ImportProgress"); data != nil {
+		_ = json.Unmarshal([]byte(*data), &progress)
+	}
+	return progress
+}
+
+func (c *Cache) setImportProgress(progress importProgress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return c.setData("ImportProgress", string(data))
+}
+
+// Parse a file and compare it with the cache
+// Links already saved, and repeated links within the file, are skipped;
+// the folders and tags of repeated links are merged
+func (a *Airtable) planImport(file string, format string) (*ImportPlan, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		if format, err = detectImportFormat(file, data); err != nil {
+			return nil, err
+		}
+	}
+	links, err := parseImport(format, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	plan := &ImportPlan{
+		File:   file,
+		Format: format,
+		Hash:   hex.EncodeToString(sum[:]),
+		Lists:  map[string]string{},
+		Total:  len(links),
+	}
+
+	lists, err := a.cache.getLists(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, list := range lists {
+		if _, ok := plan.Lists[*list.Name]; !ok {
+			plan.Lists[*list.Name] = *list.ID
+		}
+	}
+
+	seen := map[string]int{}
+	for _, link := range links {
+		if u, err := url.Parse(*link.URL); err != nil || !testURL(*link.URL) || (u.Scheme != "http" && u.Scheme != "https") {
+			plan.Invalid++
+			continue
+		}
+		key := normalizeURL(*link.URL)
+		if i, ok := seen[key]; ok {
+			first := &plan.Links[i]
+			first.Tags = unionStrings(first.Tags, link.Tags)
+			first.ListNames = unionStrings(first.ListNames, link.ListNames)
+			first.Done = first.Done || link.Done
+			if first.Note == nil {
+				first.Note = link.Note
+			}
+			plan.Duplicates++
+			continue
+		}
+		saved, err := a.cache.getLinksByURL(*link.URL)
+		if err != nil {
+			return nil, err
+		}
+		if len(saved) > 0 {
+			plan.Duplicates++
+			continue
+		}
+		seen[key] = len(plan.Links)
+		plan.Links = append(plan.Links, link)
+	}
+	for _, link := range plan.Links {
+		if link.Done {
+			plan.Done++
+		}
+		for _, name := range link.ListNames {
+			if _, ok := plan.Lists[name]; !ok && !slices.Contains(plan.NewLists, name) {
+				plan.NewLists = append(plan.NewLists, name)
+			}
+		}
+	}
+	if progress := a.cache.getImportProgress(); progress.Hash == plan.Hash {
+		plan.Uploaded = progress.Uploaded
+	}
+	return plan, nil
+}
+
+func unionStrings(a []string, b []string) []string {
+	for _, s := range b {
+		if !slices.Contains(a, s) {
+			a = append(a, s)
+		}
+	}
+	return a
+}
+
+func (p *ImportPlan) summary() string {
+	lines := []string{
+		fmt.Sprintf("%s: %s", importFormats[p.Format], p.File),
+		fmt.Sprintf("%d links found", p.Total),
+		fmt.Sprintf("%d to import (%d done)", len(p.Links), p.Done),
+		fmt.Sprintf("%d already saved or repeated", p.Duplicates),
+		fmt.Sprintf("%d skipped (not a web page)", p.Invalid),
+		fmt.Sprintf("%d new lists", len(p.NewLists)),
+	}
+	for _, name := range p.NewLists {
+		lines = append(lines, "  "+name)
+	}
+	if p.Uploaded > 0 {
+		lines = append(lines, fmt.Sprintf("Resuming: %d links uploaded before", p.Uploaded))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Create the new lists, then upload the links in batches
+// Returns the number of links created
+func (a *Airtable) runImport(plan *ImportPlan) (int, error) {
+	progress := a.cache.getImportProgress()
+	if progress.Hash != plan.Hash {
+		progress = importProgress{Hash: plan.Hash, Total: len(plan.Links)}
+	}
+
+	if len(plan.NewLists) > 0 {
+		records := make([]*Record, len(plan.NewLists))
+		for i, name := range plan.NewLists {
+			record := (&List{Name: stringPtr(name)}).toRecord()
+			records[i] = &record
+		}
+		if err := a.createRecords("Lists", &records); err != nil {
+			return 0, err
+		}
+		lists := make([]List, len(records))
+		for i, record := range records {
+			lists[i] = *record.toList()
+			plan.Lists[*lists[i].Name] = *lists[i].ID
+		}
+		if err := a.cache.saveLists(lists); err != nil {
+			return 0, err
+		}
+		logMessage("INFO", "Created %d lists", len(lists))
+	}
+
+	count := 0
+	for batch := range slices.Chunk(plan.Links, importBatchSize) {
+		records := make([]*Record, len(batch))
+		for i, link := range batch {
+			link.ListIDs = nil
+			for _, name := range link.ListNames {
+				link.ListIDs = append(link.ListIDs, plan.Lists[name])
+			}
+			record := link.toRecord()
+			records[i] = &record
+		}
+		if err := a.createRecords("Links", &records); err != nil {
+			return count, err
+		}
+		links := make([]Link, len(records))
+		for i, record := range records {
+			links[i] = *record.toLink()
+		}
+		if err := a.cache.saveLinks(links); err != nil {
+			return count, err
+		}
+		count += len(links)
+		progress.Uploaded += len(links)
+		_ = a.cache.setImportProgress(progress)
+	}
+	logMessage("INFO", "Imported %d links from %s", count, plan.File)
+	return count, nil
+}
+
+// Show what importing a file would do, and import it when the item is actioned
+func (a *Airtable) previewImport(file string, format string) {
+	wf := Workflow{}
+	if file == "" {
+		wf.warnEmpty("Select a bookmark file to import")
+		wf.output()
+		return
+	}
+	plan, err := a.planImport(file, format)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+		wf.output()
+		return
+	}
+	title := fmt.Sprintf("Import %d Links", len(plan.Links))
+	if plan.Uploaded > 0 {
+		title = fmt.Sprintf("Resume Import: %d Links Left", len(plan.Links))
+	}
+	item := Item{
+		Title:    title,
+		Subtitle: fmt.Sprintf("%s  ·  %d found  ·  %d already saved  ·  %d new lists", importFormats[plan.Format], plan.Total, plan.Duplicates, len(plan.NewLists)),
+		Icon:     &Icon{Path: stringPtr("media/add.png")},
+		Variables: map[string]string{
+			"file":   file,
+			"format": plan.Format,
+			"exec":   "import",
+		},
+	}
+	if len(plan.Links) == 0 {
+		item.Title = "Nothing to Import"
+		item.Valid = boolPtr(false)
+	}
+	wf.addItem(item)
+	for _, name := range plan.NewLists {
+		count := 0
+		for _, link := range plan.Links {
+			if slices.Contains(link.ListNames, name) {
+				count++
+			}
+		}
+		wf.addItem(Item{
+			Title:    name,
+			Subtitle: fmt.Sprintf("New list  ·  %d links", count),
+			Valid:    boolPtr(false),
+			Icon:     &Icon{Path: stringPtr("media/list.png")},
+		})
+	}
+	wf.output()
+}
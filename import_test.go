@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParsePocket(t *testing.T) {
+	data := `title,url,time_added,cursor,tags,status
+Go blog,https://go.dev/blog,1700000000,,go|blog,unread
+,https://example.com/read,1700000001,,,archive
+`
+	links, err := parseImport("pocket", strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("parsePocket() error = %v", err)
+	}
+	if len(links) != 2 {
+		t.Fatalf("parsePocket() returned %d links, want 2", len(links))
+	}
+	if *links[0].Name != "Go blog" || !slices.Equal(links[0].Tags, []string{"go", "blog"}) || links[0].Done {
+		t.Errorf("links[0] = %s %v done=%v", *links[0].Name, links[0].Tags, links[0].Done)
+	}
+	if *links[1].Name != "https://example.com/read" || !links[1].Done {
+		t.Errorf("links[1] = %s done=%v, want the URL as name and done", *links[1].Name, links[1].Done)
+	}
+}
+
+func TestParseRaindrop(t *testing.T) {
+	data := `id,title,note,excerpt,url,folder,tags,created,cover,highlights,favorite
+1,Go,"A note",,https://go.dev,Dev/Go,"go, lang",2024-01-01T00:00:00.000Z,,,false
+2,Other,,,https://other.com,Unsorted,,2024-01-02T00:00:00.000Z,,,false
+`
+	links, err := parseImport("raindrop", strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("parseRaindrop() error = %v", err)
+	}
+	if len(links) != 2 {
+		t.Fatalf("parseRaindrop() returned %d links, want 2", len(links))
+	}
+	if !slices.Equal(links[0].ListNames, []string{"Dev / Go"}) {
+		t.Errorf("links[0].ListNames = %v, want [Dev / Go]", links[0].ListNames)
+	}
+	if !slices.Equal(links[0].Tags, []string{"go", "lang"}) {
+		t.Errorf("links[0].Tags = %v, want [go lang]", links[0].Tags)
+	}
+	if links[0].Note == nil || *links[0].Note != "A note" {
+		t.Errorf("links[0].Note = %v, want A note", links[0].Note)
+	}
+	if links[1].ListNames != nil {
+		t.Errorf("links[1].ListNames = %v, want none for unsorted", links[1].ListNames)
+	}
+}
+
+func TestParseNetscape(t *testing.T) {
+	data := `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3 PERSONAL_TOOLBAR_FOLDER="true">Bookmarks bar</H3>
+    <DL><p>
+        <DT><A HREF="https://a.com" ADD_DATE="1700000000" TAGS="x,y">A &amp; B</A>
+        <DD>About A
+        <DT><H3>Dev</H3>
+        <DL><p>
+            <DT><A HREF="https://go.dev">Go</A>
+        </DL><p>
+    </DL><p>
+    <DT><A HREF="javascript:alert(1)">Bookmarklet</A>
+</DL><p>
+`
+	links, err := parseImport("netscape", strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("parseNetscape() error = %v", err)
+	}
+	if len(links) != 3 {
+		t.Fatalf("parseNetscape() returned %d links, want 3", len(links))
+	}
+	if *links[0].Name != "A & B" || links[0].ListNames != nil || !slices.Equal(links[0].Tags, []string{"x", "y"}) {
+		t.Errorf("links[0] = %s %v %v", *links[0].Name, links[0].ListNames, links[0].Tags)
+	}
+	if links[0].Note == nil || *links[0].Note != "About A" {
+		t.Errorf("links[0].Note = %v, want About A", links[0].Note)
+	}
+	if !slices.Equal(links[1].ListNames, []string{"Dev"}) || links[1].Note != nil {
+		t.Errorf("links[1] = %v note=%v, want list Dev and no note", links[1].ListNames, links[1].Note)
+	}
+}
+
+func TestParseNetscapePocket(t *testing.T) {
+	data := `<!DOCTYPE html>
+<html><body>
+<h1>Unread</h1>
+<ul>
+<li><a href="https://a.com" time_added="1700000000" tags="go">A</a></li>
+</ul>
+<h1>Read Archive</h1>
+<ul>
+<li><a href="https://b.com" time_added="1700000001" tags="">B</a></li>
+</ul>
+</body></html>
+`
+	links, err := parseImport("netscape", strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("parseNetscape() error = %v", err)
+	}
+	if len(links) != 2 || links[0].Done || !links[1].Done {
+		t.Fatalf("parseNetscape() = %+v, want A unread and B done", links)
+	}
+	if !slices.Equal(links[0].Tags, []string{"go"}) {
+		t.Errorf("links[0].Tags = %v, want [go]", links[0].Tags)
+	}
+}
+
+func TestParseChrome(t *testing.T) {
+	data := `{
+  "roots": {
+    "other": {"type": "folder", "name": "Other bookmarks", "children": [
+      {"type": "url", "name": "Other", "url": "https://other.com"}
+    ]},
+    "bookmark_bar": {"type": "folder", "name": "Bookmarks bar", "children": [
+      {"type": "url", "name": "Top", "url": "https://top.com"},
+      {"type": "folder", "name": "Dev", "children": [
+        {"type": "folder", "name": "Go", "children": [
+          {"type": "url", "name": "Go", "url": "https://go.dev"}
+        ]}
+      ]}
+    ]}
+  },
+  "version": 1
+}`
+	links, err := parseImport("chrome", strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("parseChrome() error = %v", err)
+	}
+	names := []string{}
+	for _, link := range links {
+		names = append(names, *link.Name+":"+strings.Join(link.ListNames, ","))
+	}
+	if want := []string{"Top:", "Go:Dev / Go", "Other:"}; !slices.Equal(names, want) {
+		t.Errorf("parseChrome() = %v, want %v", names, want)
+	}
+}
+
+func TestDetectImportFormat(t *testing.T) {
+	tests := []struct {
+		file string
+		data string
+		want string
+	}{
+		{"pocket.csv", "title,url,time_added,cursor,tags,status\n", "pocket"},
+		{"raindrop.csv", "id,title,note,excerpt,url,folder,tags\n", "raindrop"},
+		{"bookmarks.html", "<DL>", "netscape"},
+		{"Bookmarks", `{"roots": {}}`, "chrome"},
+	}
+	for _, tt := range tests {
+		got, err := detectImportFormat(tt.file, []byte(tt.data))
+		if err != nil || got != tt.want {
+			t.Errorf("detectImportFormat(%q) = %q, %v, want %q", tt.file, got, err, tt.want)
+		}
+	}
+	if _, err := detectImportFormat("notes.txt", []byte("hello")); err == nil {
+		t.Error("detectImportFormat(notes.txt) error = nil, want an error")
+	}
+}
+
+// Exported bookmarks can be imported again
+func TestImportExportRoundTrip(t *testing.T) {
+	airtable := testExportCache(t)
+	export, err := airtable.getExport(ExportFilter{})
+	if err != nil {
+		t.Fatalf("getExport() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if err = export.write("html", &buf); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	links, err := parseImport("netscape", &buf)
+	if err != nil {
+		t.Fatalf("parseNetscape() error = %v", err)
+	}
+	got := []string{}
+	for _, link := range links {
+		got = append(got, fmt.Sprintf("%s|%s|%s|%s", *link.Name, *link.URL, strings.Join(link.ListNames, ","), strings.Join(link.Tags, ",")))
+	}
+	want := []string{
+		"First|https://a.com|Go|go,web",
+		"Second & last|https://b.com/?a=1&b=2|Go|",
+		"Second & last|https://b.com/?a=1&b=2|Reading|",
+		"Loose|https://c.com||",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("round trip = %v, want %v", got, want)
+	}
+}
+
+// A fake Airtable API that creates records, and fails once after failAfter links
+func testImportServer(t *testing.T, failAfter int) (*httptest.Server, *[]string) {
+	created := []string{}
+	failed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Records []Record `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		table := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if table == "Links" && !failed && failAfter >= 0 && len(created) >= failAfter {
+			failed = true
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		response := Response{}
+		for _, record := range body.Records {
+			id := fmt.Sprintf("rec%s%011d", table[:3], len(created))
+			record.ID = &id
+			if table == "Links" {
+				created = append(created, (*record.Fields)["URL"].(string))
+			}
+			response.Records = append(response.Records, record)
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	return server, &created
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "pocket.csv")
+	rows := []string{"title,url,time_added,cursor,tags,status"}
+	for i := range 25 {
+		rows = append(rows, fmt.Sprintf("Page %d,https://example.com/%d,0,,,unread", i, i))
+	}
+	// Saved already, and repeated in the file
+	rows = append(rows, "Saved,https://saved.com/?utm_source=x,0,,,unread", "Again,https://example.com/3/,0,,,archive", "Not a page,javascript:void(0),0,,,unread")
+	if err := os.WriteFile(file, []byte(strings.Join(rows, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	server, created := testImportServer(t, 20)
+	defer server.Close()
+	airtable := testAirtableAt(t, server.URL)
+	_ = airtable.cache.saveLinks([]Link{{Name: stringPtr("Saved"), URL: stringPtr("https://saved.com"), ID: stringPtr("recSaved")}})
+
+	plan, err := airtable.planImport(file, "")
+	if err != nil {
+		t.Fatalf("planImport() error = %v", err)
+	}
+	if plan.Format != "pocket" || plan.Total != 28 || len(plan.Links) != 25 || plan.Duplicates != 2 || plan.Invalid != 1 || plan.Done != 1 {
+		t.Errorf("plan = %s total=%d links=%d duplicates=%d invalid=%d done=%d", plan.Format, plan.Total, len(plan.Links), plan.Duplicates, plan.Invalid, plan.Done)
+	}
+
+	// The upload fails after two batches
+	count, err := airtable.runImport(plan)
+	if err == nil || count != 20 {
+		t.Fatalf("runImport() = %d, %v, want 20 and an error", count, err)
+	}
+	plan, err = airtable.planImport(file, "")
+	if err != nil {
+		t.Fatalf("planImport() error = %v", err)
+	}
+	if len(plan.Links) != 5 || plan.Uploaded != 20 {
+		t.Errorf("resumed plan: %d links, %d uploaded, want 5 and 20", len(plan.Links), plan.Uploaded)
+	}
+	if count, err = airtable.runImport(plan); err != nil || count != 5 {
+		t.Fatalf("runImport() = %d, %v, want 5", count, err)
+	}
+	if len(*created) != 25 {
+		t.Errorf("created %d links, want 25", len(*created))
+	}
+	links, _ := airtable.cache.getLinks(nil, nil)
+	if len(links) != 26 {
+		t.Errorf("cache has %d links, want 26", len(links))
+	}
+}
+
+func TestImportLists(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "raindrop.csv")
+	data := `id,title,note,excerpt,url,folder,tags,created,cover,highlights,favorite
+1,Go,,,https://go.dev,Dev,go,,,,false
+2,Rust,,,https://rust-lang.org,Dev,,,,,false
+3,News,,,https://news.com,Reading,,,,,false
+`
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	server, _ := testImportServer(t, -1)
+	defer server.Close()
+	airtable := testAirtableAt(t, server.URL)
+	_ = airtable.cache.saveLists([]List{{Name: stringPtr("Reading"), ID: stringPtr("recReading")}})
+
+	plan, err := airtable.planImport(file, "")
+	if err != nil {
+		t.Fatalf("planImport() error = %v", err)
+	}
+	if !slices.Equal(plan.NewLists, []string{"Dev"}) {
+		t.Errorf("NewLists = %v, want [Dev]", plan.NewLists)
+	}
+	if _, err = airtable.runImport(plan); err != nil {
+		t.Fatalf("runImport() error = %v", err)
+	}
+	lists, _ := airtable.cache.getLists(nil)
+	counts := map[string]int{}
+	for _, list := range lists {
+		counts[*list.Name] = len(list.LinkIDs)
+	}
+	if counts["Dev"] != 2 || counts["Reading"] != 1 {
+		t.Errorf("links per list = %v, want Dev 2 and Reading 1", counts)
+	}
+}
@@ -11,17 +11,20 @@ import (
 
 // Handle user interactions through Alfred
 
-func (l *Link) format() Item {
+func (l *Link) view() View {
 	subtitle := ""
 	subParts := []string{}
 	largeParts := []string{
 		*l.Name,
 		"􀉣 " + *l.URL,
 	}
-	icon := Icon{Path: stringPtr("media/link.png")}
+	icon := "media/link.png"
 	if l.Done {
 		subtitle = "􀃲 "
-		icon.Path = stringPtr("media/link-done.png")
+		icon = "media/link-done.png"
+	}
+	if file := favicon(l.host(), l.Done); file != nil {
+		icon = *file
 	}
 	if len(l.Tags) > 0 {
 		tags := []string{}
@@ -47,82 +50,56 @@ func (l *Link) format() Item {
 
 	arg := fmt.Sprintf("[%s](%s)", *l.Name, *l.URL)
 
-	item := Item{
-		Title:        *l.Name,
-		Subtitle:     subtitle + strings.Join(subParts, "  ·  "),
-		Arg:          arg,
-		Type:         stringPtr("file:skipcheck"),
-		Match:        l.match(),
-		QuickLookURL: l.URL,
-		Action: struct {
-			Text *string `json:"text,omitempty"`
-			File *string `json:"file,omitempty"`
-			URL  *string `json:"url,omitempty"`
-		}{
-			Text: &arg,
-		},
-		Text: struct {
-			Copy      *string `json:"copy,omitempty"`
-			LargeType *string `json:"largetype,omitempty"`
-		}{
-			Copy:      l.URL,
-			LargeType: stringPtr(strings.Join(largeParts, "\n")),
-		},
-		Icon: &icon,
+	actions := []Action{{
+		Arg:   arg,
+		Valid: true,
 		Variables: map[string]string{
 			"URL": *l.URL,
 			"ID":  *l.ID,
 		},
-		Mods: &map[string]Mod{
-			"alt": {
-				Subtitle: "Edit record",
-				Icon:     &Icon{Path: stringPtr("media/edit.png")},
-				Variables: map[string]string{
-					"ID":   *l.ID,
-					"mode": "edit-link",
-				},
-			},
-			"shift": {
-				Subtitle:  "Send to link copier",
-				Arg:       arg,
-				Variables: map[string]string{"mod": "save"},
-			},
-			"alt+shift": {
-				Subtitle:  "Open record",
-				Variables: map[string]string{"URL": *l.RecordURL},
-			},
-			"ctrl": {
-				Subtitle: "Delete link",
-				Icon:     &Icon{Path: stringPtr("media/delete.png")},
-				Variables: map[string]string{
-					"ID":   *l.ID,
-					"exec": "delete-link",
-				},
-			},
-			"fn": {
-				Subtitle: "Rebuild cache",
-				Icon:     &Icon{Path: stringPtr("media/reload.png")},
-				Variables: map[string]string{
-					"exec": "force-sync",
-				},
-			},
-		},
+	}}
+	if !l.Done {
+		actions = append(actions, modAction("cmd", "Mark as done 􀃲 ", "media/checked.png", map[string]string{
+			"ID":   *l.ID,
+			"exec": "complete-link",
+		}))
 	}
+	send := modAction("shift", "Send to link copier", "", map[string]string{"mod": "save"})
+	send.Arg = arg
+	actions = append(actions,
+		modAction("alt", "Edit record", "media/edit.png", map[string]string{
+			"ID":   *l.ID,
+			"mode": "edit-link",
+		}),
+		modAction("ctrl", "Delete link", "media/delete.png", map[string]string{
+			"ID":   *l.ID,
+			"exec": "delete-link",
+		}),
+		send,
+		modAction("fn", "Rebuild cache", "media/reload.png", map[string]string{
+			"exec": "force-sync",
+		}),
+		modAction("cmd+shift", "Open archived copy", "media/note.png", map[string]string{
+			"ID":   *l.ID,
+			"mode": "show-archive",
+		}),
+		modAction("alt+shift", "Open record", "", map[string]string{"URL": *l.RecordURL}),
+	)
 
-	if !l.Done {
-		(*item.Mods)["cmd"] = Mod{
-			Subtitle: "Mark as done 􀃲 ",
-			Icon:     &Icon{Path: stringPtr("media/checked.png")},
-			Variables: map[string]string{
-				"ID":   *l.ID,
-				"exec": "complete-link",
-			},
-		}
+	return View{
+		Title:     *l.Name,
+		Subtitle:  subtitle + strings.Join(subParts, "  ·  "),
+		Icon:      icon,
+		URL:       *l.URL,
+		Copy:      *l.URL,
+		LargeType: strings.Join(largeParts, "\n"),
+		Match:     *l.match(),
+		Text:      arg,
+		Actions:   actions,
 	}
-	return item
 }
 
-func (l *List) format() Item {
+func (l *List) view() View {
 	subtitle := fmt.Sprintf("􀉣 %d/%d", *l.LinksDone, len(l.LinkIDs))
 	largeParts := []string{}
 	if l.Note != nil {
@@ -132,74 +109,53 @@ func (l *List) format() Item {
 	for _, linkName := range l.LinkNames {
 		largeParts = append(largeParts, "- "+linkName)
 	}
-	item := Item{
-		Title:    *l.Name,
-		Subtitle: subtitle,
-		Match:    l.match(),
-		Text: struct {
-			Copy      *string `json:"copy,omitempty"`
-			LargeType *string `json:"largetype,omitempty"`
-		}{
-			Copy:      l.RecordURL,
-			LargeType: stringPtr(strings.Join(largeParts, "\n")),
-		},
-		Icon: &Icon{Path: stringPtr("media/list.png")},
-		Variables: map[string]string{
-			"listID": *l.ID,
-			"mode":   "list-links",
-		},
-		Mods: &map[string]Mod{
-			"cmd": {
-				Subtitle: "Add link to list",
-				Icon:     &Icon{Path: stringPtr("media/add.png")},
-				Variables: map[string]string{
-					"mode":    "edit-link",
-					"listIDs": *l.ID,
-				},
-			},
-			"shift": {
-				Subtitle: "Send to link copier",
-				Icon:     &Icon{Path: stringPtr("media/clip.png")},
-				Variables: map[string]string{
-					"exec":     "list-to-lc",
-					"listID":   *l.ID,
-					"listName": *l.Name,
-				},
-			},
-			"ctrl": {
-				Subtitle: "Delete list",
-				Icon:     &Icon{Path: stringPtr("media/delete.png")},
-				Variables: map[string]string{
-					"exec":   "delete-list-links",
-					"listID": *l.ID,
-				},
-			},
-			"ctrl+alt": {
-				Subtitle: "Delete list but keep links",
-				Icon:     &Icon{Path: stringPtr("media/delete.png")},
-				Variables: map[string]string{
-					"exec":   "delete-list",
-					"listID": *l.ID,
-				},
-			},
-			"alt+shift": {
-				Subtitle: "Open record",
-				Arg:      *l.RecordURL,
-				Variables: map[string]string{
-					"URL": *l.RecordURL,
-				},
-			},
-			"fn": {
-				Subtitle: "Rebuild cache",
-				Icon:     &Icon{Path: stringPtr("media/reload.png")},
+	openRecord := modAction("alt+shift", "Open record", "", map[string]string{
+		"URL": *l.RecordURL,
+	})
+	openRecord.Arg = *l.RecordURL
+	return View{
+		Title:     *l.Name,
+		Subtitle:  subtitle,
+		Icon:      "media/list.png",
+		Copy:      *l.RecordURL,
+		LargeType: strings.Join(largeParts, "\n"),
+		Match:     *l.match(),
+		Actions: []Action{
+			{
+				Valid: true,
 				Variables: map[string]string{
-					"exec": "force-sync",
+					"listID":  *l.ID,
+					"groupBy": "",
+					"mode":    "list-links",
 				},
 			},
+			modAction("cmd", "Add link to list", "media/add.png", map[string]string{
+				"mode":    "edit-link",
+				"listIDs": *l.ID,
+			}),
+			modAction("alt", "Export list with a template", "media/save.png", map[string]string{
+				"mode":   "list-templates",
+				"listID": *l.ID,
+			}),
+			modAction("ctrl", "Delete list", "media/delete.png", map[string]string{
+				"exec":   "delete-list-links",
+				"listID": *l.ID,
+			}),
+			modAction("shift", "Send to link copier", "media/clip.png", map[string]string{
+				"exec":     "list-to-lc",
+				"listID":   *l.ID,
+				"listName": *l.Name,
+			}),
+			modAction("fn", "Rebuild cache", "media/reload.png", map[string]string{
+				"exec": "force-sync",
+			}),
+			modAction("ctrl+alt", "Delete list but keep links", "media/delete.png", map[string]string{
+				"exec":   "delete-list",
+				"listID": *l.ID,
+			}),
+			openRecord,
 		},
 	}
-
-	return item
 }
 
 // list all links or links in a list
@@ -213,7 +169,7 @@ func (a *Airtable) listLinks(list *List) {
 			wf.warnEmpty("No Links Found")
 		} else {
 			for _, link := range links {
-				wf.addItem(link.format())
+				wf.addView(link.view())
 			}
 		}
 		if list != nil {
@@ -229,6 +185,42 @@ func (a *Airtable) listLinks(list *List) {
 	wf.output()
 }
 
+// list the links of a tag, a category or a domain
+func (a *Airtable) listGroupLinks(by string, name string) {
+	wf := Workflow{}
+	links, err := a.cache.getGroupLinks(by, name)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+	} else {
+		if len(links) == 0 {
+			wf.warnEmpty("No Links Found")
+		} else {
+			for _, link := range links {
+				view := link.view()
+				// The actions of a link apply to it, not to its group
+				view.setVar("groupBy", "")
+				for _, action := range view.Actions[1:] {
+					if action.Variables != nil {
+						action.Variables["groupBy"] = ""
+					}
+				}
+				wf.addView(view)
+			}
+		}
+		wf.addItem(Item{
+			Title: "Go Back",
+			Icon:  &Icon{Path: stringPtr("media/back.png")},
+			Variables: map[string]string{
+				"field":   by,
+				"groupBy": "",
+				"group":   "",
+				"mode":    groupMode(by),
+			},
+		})
+	}
+	wf.output()
+}
+
 // list all lists
 func (a *Airtable) listLists() {
 	wf := Workflow{}
@@ -240,7 +232,7 @@ func (a *Airtable) listLists() {
 			wf.warnEmpty("No Lists Found")
 		} else {
 			for _, list := range lists {
-				wf.addItem(list.format())
+				wf.addView(list.view())
 			}
 		}
 	}
@@ -261,9 +253,9 @@ func (a *Airtable) editLink(input string) {
 	}
 
 	if variables["URL"] == "" {
-		if title, url := parseMDLink(os.Getenv("input")); url != nil {
-			variables["title"] = *title
-			variables["URL"] = *url
+		if md := wholeMDLink(os.Getenv("input")); md != nil {
+			variables["title"] = md.Title
+			variables["URL"] = md.URL
 		}
 	}
 
@@ -274,18 +266,27 @@ func (a *Airtable) editLink(input string) {
 		}
 	}
 
+	// Suggest a title and a note for a new link from the page's metadata
+	var meta *PageMeta
+	if link.ID == nil && variables["URL"] != "" {
+		meta = a.pageMeta(variables["URL"], &wf)
+		if meta != nil && meta.Title != nil && (variables["title"] == "" || variables["title"] == variables["URL"]) {
+			variables["title"] = *meta.Title
+		}
+	}
+
 	inputMd := false
 	if link.ID == nil && variables["URL"] == "" {
-		if title, url := parseMDLink(input); url != nil && testURL(*url) {
+		if md := wholeMDLink(input); md != nil {
 			inputMd = true
 			item := Item{
 				Title:        "Save the Link to Airtable",
-				QuickLookURL: url,
+				QuickLookURL: &md.URL,
 				Icon:         &Icon{Path: stringPtr("media/save.png")},
 			}
 			item.setVars(variables)
-			item.setVar("title", *title)
-			item.setVar("URL", *url)
+			item.setVar("title", md.Title)
+			item.setVar("URL", md.URL)
 			item.setVar("exec", "save-link")
 			item.setVar("mode", "")
 			altMod := Mod{
@@ -293,21 +294,36 @@ func (a *Airtable) editLink(input string) {
 				Icon:     &Icon{Path: stringPtr("media/edit.png")},
 			}
 			altMod.setVars(variables)
-			altMod.setVar("title", *title)
-			altMod.setVar("URL", *url)
+			altMod.setVar("title", md.Title)
+			altMod.setVar("URL", md.URL)
 			altMod.setVar("mode", "edit-link")
 			item.Mods = &map[string]Mod{"alt": altMod}
 			wf.addItem(item)
 			wf.addItem(Item{
-				Title: *url,
+				Title: md.URL,
 				Icon:  &Icon{Path: stringPtr("media/link.png")},
 				Valid: boolPtr(false),
 			})
 			wf.addItem(Item{
-				Title: *title,
+				Title: md.Title,
 				Icon:  &Icon{Path: stringPtr("media/title.png")},
 				Valid: boolPtr(false),
 			})
+		} else if links := extractLinks(input); len(links) > 1 {
+			wf.addItem(Item{
+				Title:    fmt.Sprintf("Add %d Links", len(links)),
+				Subtitle: "Choose a list for the links",
+				Icon:     &Icon{Path: stringPtr("media/add.png")},
+				Variables: map[string]string{
+					"text": input,
+					"mode": "bulk-add",
+				},
+			})
+			wf.output()
+			return
+		} else if q := parseQuickAdd(input); q != nil {
+			a.previewQuickAdd(q)
+			return
 		} else {
 			wf.addItem(Item{
 				Title:    "Save a Link to Airtable",
@@ -421,6 +437,17 @@ func (a *Airtable) editLink(input string) {
 			Icon:         &Icon{Path: stringPtr("media/note.png")},
 			Valid:        boolPtr(false),
 		})
+	} else if meta != nil && meta.Description != nil && variables["note"] == "" {
+		// Suggest the page description as note
+		item := Item{
+			Title:        *meta.Description,
+			Subtitle:     "Use page description as note",
+			AutoComplete: meta.Description,
+			Icon:         &Icon{Path: stringPtr("media/note.png")},
+		}
+		item.setVars(variables)
+		item.setVar("note", *meta.Description)
+		wf.addItem(item)
 	}
 
 	// Tags
@@ -449,13 +476,11 @@ func (a *Airtable) editLink(input string) {
 		// Add an existing tag
 		match = strings.ToLower(match)
 		tagsMap := make(map[string]bool)
-		if tags, _ := a.cache.getData("Tags"); tags != nil {
-			for tag := range strings.SplitSeq(*tags, ",") {
-				tagsMap[tag] = true
-			}
-			for _, tag := range currentTags {
-				tagsMap[tag] = false
-			}
+		for _, tag := range a.cache.getChoiceNames("Tags") {
+			tagsMap[tag] = true
+		}
+		for _, tag := range currentTags {
+			tagsMap[tag] = false
 		}
 		for tag := range tagsMap {
 			if match == "" || strings.HasPrefix(strings.ToLower(tag), match) {
@@ -532,22 +557,20 @@ func (a *Airtable) editLink(input string) {
 	categoryRe := regexp.MustCompile(`^/(\w*)$`)
 	if matches := categoryRe.FindStringSubmatch(input); matches != nil {
 		match := strings.ToLower(matches[1])
-		if categories, _ := a.cache.getData("Categories"); categories != nil {
-			// Set a category
-			for category := range strings.SplitSeq(*categories, ",") {
-				if category == currentCategory {
-					continue
-				}
-				if match == "" || strings.HasPrefix(strings.ToLower(category), match) {
-					item := Item{
-						Title:        "Set Category: " + category,
-						AutoComplete: stringPtr("/" + category),
-						Icon:         &Icon{Path: stringPtr("media/category.png")},
-					}
-					item.setVars(variables)
-					item.setVar("category", category)
-					wf.addItem(item, true)
+		// Set a category
+		for _, category := range a.cache.getChoiceNames("Category") {
+			if category == currentCategory {
+				continue
+			}
+			if match == "" || strings.HasPrefix(strings.ToLower(category), match) {
+				item := Item{
+					Title:        "Set Category: " + category,
+					AutoComplete: stringPtr("/" + category),
+					Icon:         &Icon{Path: stringPtr("media/category.png")},
 				}
+				item.setVars(variables)
+				item.setVar("category", category)
+				wf.addItem(item, true)
 			}
 		}
 	} else if currentCategory != "" {
@@ -664,10 +687,58 @@ func (a *Airtable) editLink(input string) {
 		wf.addItem(item, true)
 	}
 
+	// Warn when the URL is already saved in another link
+	checkURL := currentURL
+	if testURL(input) {
+		checkURL = input
+	}
+	for _, item := range a.duplicateItems(checkURL, link.ID) {
+		wf.addItem(item, true)
+	}
+
 	wf.setVar("mode", "edit-link")
 	wf.output()
 }
 
+// Warn that a URL is already saved, with an action to edit the existing link instead
+func (a *Airtable) duplicateItems(URL string, ID *string) []Item {
+	if URL == "" {
+		return nil
+	}
+	links, _ := a.cache.getLinksByURL(URL)
+	items := []Item{}
+	for _, link := range links {
+		if ID != nil && *link.ID == *ID {
+			continue
+		}
+		subParts := []string{"Edit the existing link instead"}
+		if link.Created != nil {
+			subParts = append(subParts, "saved on "+link.Created.Local().Format("2006-01-02"))
+		}
+		if len(link.ListNames) > 0 {
+			subParts = append(subParts, "􀈕 "+strings.Join(link.ListNames, ", "))
+		}
+		items = append(items, Item{
+			Title:        "Already Saved: " + *link.Name,
+			Subtitle:     strings.Join(subParts, "  ·  "),
+			QuickLookURL: link.URL,
+			Icon:         alertIcon(),
+			Variables: map[string]string{
+				"ID":       *link.ID,
+				"title":    "",
+				"URL":      "",
+				"note":     "",
+				"category": "",
+				"tags":     "",
+				"listIDs":  "",
+				"done":     "",
+				"mode":     "edit-link",
+			},
+		})
+	}
+	return items
+}
+
 func (a *Airtable) saveLink() error {
 	link := Link{}
 	if os.Getenv("ID") != "" {
@@ -687,6 +758,9 @@ func (a *Airtable) saveLink() error {
 	}
 	if link.Name == nil || *link.Name == "" {
 		link.Name = link.URL
+		if meta, _, err := a.cache.getPageMeta(*link.URL); err == nil && meta.Title != nil {
+			link.Name = meta.Title
+		}
 	}
 	if os.Getenv("note") != "" {
 		if os.Getenv("note") == "__NONE__" {
@@ -695,13 +769,17 @@ func (a *Airtable) saveLink() error {
 			link.Note = stringPtr(os.Getenv("note"))
 		}
 	}
+	if category := os.Getenv("newCategory"); category != "" {
+		if err := a.createChoice("Category", category, nil); err != nil {
+			return err
+		}
+		_ = os.Setenv("category", category)
+	}
 	if os.Getenv("category") != "" {
 		if os.Getenv("category") == "__NONE__" {
 			link.Category = nil
-		} else if categories, _ := a.cache.getData("Categories"); categories != nil {
-			if slices.Contains(strings.Split(*categories, ","), os.Getenv("category")) {
-				link.Category = stringPtr(os.Getenv("category"))
-			}
+		} else if slices.Contains(a.cache.getChoiceNames("Category"), os.Getenv("category")) {
+			link.Category = stringPtr(os.Getenv("category"))
 		}
 	}
 	if os.Getenv("tags") != "" {
@@ -718,6 +796,15 @@ func (a *Airtable) saveLink() error {
 			link.ListIDs = strings.Split(os.Getenv("listIDs"), ",")
 		}
 	}
+	if os.Getenv("newLists") != "" {
+		for name := range strings.SplitSeq(os.Getenv("newLists"), ",") {
+			list := List{Name: &name}
+			if err := a.createList(&list, nil); err != nil {
+				return err
+			}
+			link.ListIDs = append(link.ListIDs, *list.ID)
+		}
+	}
 	if os.Getenv("done") != "" {
 		link.Done = os.Getenv("done") == "true"
 	}
@@ -747,3 +834,462 @@ func (a *Airtable) saveLink() error {
 	err := <-errChan
 	return err
 }
+
+func choiceLabel(field string) string {
+	if field == "Tags" {
+		return "Tag"
+	}
+	return field
+}
+
+func choiceIcon(field string) *Icon {
+	if field == "Tags" {
+		return &Icon{Path: stringPtr("media/tag.png")}
+	}
+	return &Icon{Path: stringPtr("media/category.png")}
+}
+
+func (c *Choice) format(field string, group Group) Item {
+	label := choiceLabel(field)
+	subParts := []string{fmt.Sprintf("􀉣 %d/%d", group.Done, group.Done+group.ToDo)}
+	if c.Color != nil {
+		subParts = append(subParts, "􀎑 "+*c.Color)
+	}
+	if c.ID == nil {
+		subParts = append(subParts, "Not yet in Airtable")
+	}
+	editVars := func(action string) map[string]string {
+		return map[string]string{
+			"field":  field,
+			"tag":    c.Name,
+			"action": action,
+			"mode":   "edit-tag",
+		}
+	}
+	item := Item{
+		Title:    c.Name,
+		Subtitle: strings.Join(subParts, "  ·  "),
+		Match:    stringPtr(c.Name + " " + toPinyin(&c.Name)),
+		Icon:     choiceIcon(field),
+		Variables: map[string]string{
+			"groupBy": field,
+			"group":   c.Name,
+			"listID":  "",
+			"mode":    "list-links",
+		},
+		Mods: &map[string]Mod{
+			"alt": {
+				Subtitle:  fmt.Sprintf("Rename %s", strings.ToLower(label)),
+				Icon:      &Icon{Path: stringPtr("media/edit.png")},
+				Variables: editVars("rename"),
+			},
+			"shift": {
+				Subtitle:  fmt.Sprintf("Merge into another %s", strings.ToLower(label)),
+				Variables: editVars("merge"),
+			},
+			"cmd": {
+				Subtitle:  "Change color in this workflow only, Airtable keeps its own",
+				Variables: editVars("recolor"),
+			},
+			"ctrl": {
+				Subtitle: fmt.Sprintf("Delete %s from all links, the option stays in the field settings of Airtable", strings.ToLower(label)),
+				Icon:     &Icon{Path: stringPtr("media/delete.png")},
+				Variables: map[string]string{
+					"field": field,
+					"tag":   c.Name,
+					"exec":  "delete-tag",
+				},
+			},
+		},
+	}
+	return item
+}
+
+// list the options of the Tags or Category field with their number of links
+func (a *Airtable) listTags(field string, input string) {
+	wf := Workflow{}
+	label := choiceLabel(field)
+	choices, err := a.cache.getChoices(field)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+		wf.output()
+		return
+	}
+	groups, err := a.cache.getGroups(field)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+		wf.output()
+		return
+	}
+	groupsMap := map[string]Group{}
+	for _, group := range groups {
+		groupsMap[group.Name] = group
+	}
+	slices.SortStableFunc(choices, func(a, b Choice) int {
+		return (groupsMap[b.Name].Done + groupsMap[b.Name].ToDo) - (groupsMap[a.Name].Done + groupsMap[a.Name].ToDo)
+	})
+
+	exists := false
+	match := strings.ToLower(input)
+	for _, choice := range choices {
+		if strings.EqualFold(choice.Name, input) {
+			exists = true
+		}
+		item := choice.format(field, groupsMap[choice.Name])
+		if match == "" || strings.Contains(strings.ToLower(*item.Match), match) {
+			wf.addItem(item)
+		}
+	}
+	if input != "" && !exists {
+		wf.addItem(Item{
+			Title:    fmt.Sprintf("Create %s: %s", label, input),
+			Subtitle: "Kept in this workflow only, until a link uses it",
+			Icon:     &Icon{Path: stringPtr("media/tag-new.png")},
+			Variables: map[string]string{
+				"field": field,
+				"tag":   input,
+				"exec":  "create-tag",
+			},
+		})
+	} else if len(wf.Views) == 0 {
+		wf.warnEmpty(fmt.Sprintf("No %s Found", label))
+	}
+	wf.setVar("mode", "list-tags")
+	wf.output()
+}
+
+// rename or recolor an option of the Tags or Category field
+func (a *Airtable) editTag(field string, name string, action string, input string) {
+	wf := Workflow{}
+	label := choiceLabel(field)
+	vars := map[string]string{
+		"field": field,
+		"tag":   name,
+	}
+	choices, _ := a.cache.getChoices(field)
+
+	switch action {
+	case "rename":
+		if input == "" || input == name {
+			wf.addItem(Item{
+				Title:    fmt.Sprintf("Rename %s: %s", label, name),
+				Subtitle: "Type a new name, or the name of another option to merge into",
+				Valid:    boolPtr(false),
+				Icon:     choiceIcon(field),
+			})
+			break
+		}
+		title := fmt.Sprintf("Rename %s: %s → %s", label, name, input)
+		if slices.ContainsFunc(choices, func(c Choice) bool { return c.Name == input }) {
+			title = fmt.Sprintf("Merge %s: %s → %s", label, name, input)
+		}
+		item := Item{
+			Title:    title,
+			Subtitle: "All links will be updated, the old option stays in the field settings of Airtable",
+			Valid:    boolPtr(!strings.Contains(input, ",")),
+			Icon:     choiceIcon(field),
+		}
+		item.setVars(vars)
+		item.setVar("newName", input)
+		item.setVar("exec", "rename-tag")
+		item.setVar("mode", "")
+		wf.addItem(item)
+	case "recolor":
+		current := ""
+		for _, choice := range choices {
+			if choice.Name == name && choice.Color != nil {
+				current = *choice.Color
+			}
+		}
+		match := strings.ToLower(input)
+		for _, color := range choiceColors {
+			if match != "" && !strings.Contains(strings.ToLower(color), match) {
+				continue
+			}
+			item := Item{
+				Title: color,
+				Valid: boolPtr(color != current),
+				Icon:  choiceIcon(field),
+			}
+			item.Subtitle = "In this workflow only, Airtable keeps its own color"
+			if color == current {
+				item.Subtitle = "Current color"
+			}
+			item.setVars(vars)
+			item.setVar("color", color)
+			item.setVar("exec", "recolor-tag")
+			item.setVar("mode", "")
+			wf.addItem(item)
+		}
+		if len(wf.Views) == 0 {
+			wf.warnEmpty("No Color Found")
+		}
+	case "merge":
+		match := strings.ToLower(input)
+		for _, choice := range choices {
+			if choice.Name == name {
+				continue
+			}
+			if match != "" && !strings.Contains(strings.ToLower(choice.Name), match) {
+				continue
+			}
+			item := Item{
+				Title:    fmt.Sprintf("Merge into %s: %s", label, choice.Name),
+				Subtitle: fmt.Sprintf("Replace %s with %s in all links", name, choice.Name),
+				Icon:     choiceIcon(field),
+			}
+			item.setVars(vars)
+			item.setVar("newName", choice.Name)
+			item.setVar("exec", "rename-tag")
+			item.setVar("mode", "")
+			wf.addItem(item)
+		}
+		if len(wf.Views) == 0 {
+			wf.warnEmpty(fmt.Sprintf("No %s Found", label))
+		}
+	}
+
+	wf.addItem(Item{
+		Title: "Go Back",
+		Icon:  &Icon{Path: stringPtr("media/back.png")},
+		Variables: map[string]string{
+			"field":  field,
+			"mode":   "list-tags",
+			"action": "",
+		},
+	})
+	wf.setVar("mode", "edit-tag")
+	wf.output()
+}
+
+// The mode that lists the groups
+func groupMode(by string) string {
+	switch by {
+	case "Category":
+		return "list-categories"
+	case "Domain":
+		return "list-domains"
+	}
+	return "list-tags"
+}
+
+func (g *Group) format(by string) Item {
+	subtitle := fmt.Sprintf("􀉣 %d/%d", g.Done, g.Done+g.ToDo)
+	if g.LastAdded != nil {
+		subtitle += "  ·  􀐫 " + g.LastAdded.Local().Format("2006-01-02")
+	}
+	icon := &Icon{Path: stringPtr("media/link.png")}
+	if by == "Category" {
+		icon = choiceIcon(by)
+	}
+	vars := map[string]string{
+		"groupBy": by,
+		"group":   g.Name,
+	}
+	bulkMod := Mod{
+		Subtitle: "Tag, categorize or add all links to a list",
+		Icon:     &Icon{Path: stringPtr("media/edit.png")},
+	}
+	bulkMod.setVars(vars)
+	bulkMod.setVar("mode", "bulk-links")
+	item := Item{
+		Title:    g.Name,
+		Subtitle: subtitle,
+		Match:    stringPtr(g.Name + " " + toPinyin(&g.Name)),
+		Icon:     icon,
+		Mods: &map[string]Mod{
+			"alt": bulkMod,
+			"fn": {
+				Subtitle: "Rebuild cache",
+				Icon:     &Icon{Path: stringPtr("media/reload.png")},
+				Variables: map[string]string{
+					"exec": "force-sync",
+				},
+			},
+		},
+	}
+	item.setVars(vars)
+	item.setVar("listID", "")
+	item.setVar("mode", "list-links")
+	if g.ToDo > 0 {
+		cmdMod := Mod{
+			Subtitle: fmt.Sprintf("Mark all %d links as done 􀃲 ", g.ToDo),
+			Icon:     &Icon{Path: stringPtr("media/checked.png")},
+		}
+		cmdMod.setVars(vars)
+		cmdMod.setVar("bulkAction", "done")
+		cmdMod.setVar("exec", "bulk-update")
+		(*item.Mods)["cmd"] = cmdMod
+	}
+	return item
+}
+
+// list the categories or domains with their number of links
+func (a *Airtable) listGroups(by string) {
+	wf := Workflow{}
+	groups, err := a.cache.getGroups(by)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+	} else if len(groups) == 0 {
+		wf.warnEmpty("No Links Found")
+	} else {
+		for _, group := range groups {
+			wf.addItem(group.format(by))
+		}
+	}
+	wf.output()
+}
+
+// pick an action for many links at once
+// vars carry the selection: IDs, or groupBy and group
+func (a *Airtable) bulkLinks(links []Link, vars map[string]string, input string) {
+	wf := Workflow{}
+	n := len(links)
+	addAction := func(title string, subtitle string, icon string, action string, value string) {
+		item := Item{
+			Title:    title,
+			Subtitle: subtitle,
+			Icon:     &Icon{Path: stringPtr(icon)},
+		}
+		item.setVars(vars)
+		item.setVar("bulkAction", action)
+		item.setVar("value", value)
+		item.setVar("exec", "bulk-update")
+		item.setVar("mode", "")
+		wf.addItem(item)
+	}
+	addHint := func(title string, autocomplete string, icon string) {
+		wf.addItem(Item{
+			Title:        title,
+			AutoComplete: &autocomplete,
+			Valid:        boolPtr(false),
+			Icon:         &Icon{Path: stringPtr(icon)},
+		})
+	}
+	selected := fmt.Sprintf("%d links selected", n)
+	if name := vars["group"]; name != "" {
+		selected = fmt.Sprintf("%d links in %s", n, name)
+	}
+
+	// tags and lists of the selected links
+	tagsMap := map[string]bool{}
+	listsMap := map[string]bool{}
+	done := 0
+	for _, link := range links {
+		for _, tag := range link.Tags {
+			tagsMap[tag] = true
+		}
+		for _, listID := range link.ListIDs {
+			listsMap[listID] = true
+		}
+		if link.Done {
+			done++
+		}
+	}
+	lists, _ := a.cache.getLists(nil)
+
+	switch {
+	case n == 0:
+		wf.warnEmpty("No Links Selected")
+	case strings.HasPrefix(input, "#"):
+		match := strings.TrimPrefix(input, "#")
+		tags := a.cache.getChoiceNames("Tags")
+		if match != "" && !slices.Contains(tags, match) && !strings.Contains(match, ",") {
+			addAction("Create Tag: "+match, selected, "media/tag-new.png", "tag", match)
+		}
+		for _, tag := range tags {
+			if match == "" || strings.HasPrefix(strings.ToLower(tag), strings.ToLower(match)) {
+				addAction("Add Tag: "+tag, selected, "media/tag.png", "tag", tag)
+			}
+		}
+	case strings.HasPrefix(input, "-#"):
+		match := strings.ToLower(strings.TrimPrefix(input, "-#"))
+		for tag := range tagsMap {
+			if match == "" || strings.HasPrefix(strings.ToLower(tag), match) {
+				addAction("Remove Tag: "+tag, selected, "media/tag.png", "untag", tag)
+			}
+		}
+	case strings.HasPrefix(input, "/"):
+		match := strings.ToLower(strings.TrimPrefix(input, "/"))
+		for _, category := range a.cache.getChoiceNames("Category") {
+			if match == "" || strings.HasPrefix(strings.ToLower(category), match) {
+				addAction("Set Category: "+category, selected, "media/category.png", "category", category)
+			}
+		}
+		addAction("Remove Category", selected, "media/category.png", "category", "__NONE__")
+	case strings.HasPrefix(input, "@"):
+		match := strings.ToLower(strings.TrimPrefix(input, "@"))
+		for _, list := range lists {
+			if match == "" || strings.Contains(strings.ToLower(*list.match()), match) {
+				addAction("Add to List: "+*list.Name, selected, "media/list.png", "list", *list.ID)
+			}
+		}
+	case strings.HasPrefix(input, "-@"):
+		match := strings.ToLower(strings.TrimPrefix(input, "-@"))
+		for _, list := range lists {
+			if !listsMap[*list.ID] {
+				continue
+			}
+			if match == "" || strings.Contains(strings.ToLower(*list.match()), match) {
+				addAction("Remove from List: "+*list.Name, selected, "media/list.png", "unlist", *list.ID)
+			}
+		}
+	default:
+		if done < n {
+			addAction(fmt.Sprintf("Mark %d links as done", n-done), selected, "media/checked.png", "done", "")
+		}
+		if done > 0 {
+			addAction(fmt.Sprintf("Mark %d links as not done", done), selected, "media/unchecked.png", "undone", "")
+		}
+		addHint("Add Tag…", "#", "media/tag.png")
+		if len(tagsMap) > 0 {
+			addHint("Remove Tag…", "-#", "media/tag.png")
+		}
+		addHint("Set Category…", "/", "media/category.png")
+		addHint("Add to List…", "@", "media/list.png")
+		if len(listsMap) > 0 {
+			addHint("Remove from List…", "-@", "media/list.png")
+		}
+		addAction(fmt.Sprintf("Delete %d links", n), selected, "media/delete.png", "delete", "")
+	}
+	if len(wf.Views) == 0 {
+		wf.warnEmpty()
+	}
+
+	if by := vars["groupBy"]; by != "" {
+		wf.addItem(Item{
+			Title: "Go Back",
+			Icon:  &Icon{Path: stringPtr("media/back.png")},
+			Variables: map[string]string{
+				"groupBy": "",
+				"group":   "",
+				"mode":    groupMode(by),
+			},
+		})
+	}
+	wf.setVar("mode", "bulk-links")
+	wf.output()
+}
+
+// Summarize a bulk action for the notification
+func bulkSummary(action string, count int) string {
+	switch action {
+	case "done":
+		return fmt.Sprintf("%d links marked as done!", count)
+	case "undone":
+		return fmt.Sprintf("%d links marked as not done!", count)
+	case "tag":
+		return fmt.Sprintf("%d links tagged!", count)
+	case "untag":
+		return fmt.Sprintf("%d links untagged!", count)
+	case "category":
+		return fmt.Sprintf("%d links categorized!", count)
+	case "list":
+		return fmt.Sprintf("%d links added to list!", count)
+	case "unlist":
+		return fmt.Sprintf("%d links removed from list!", count)
+	case "delete":
+		return fmt.Sprintf("%d links deleted!", count)
+	}
+	return fmt.Sprintf("%d links updated!", count)
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Link copier files: a list as a markdown task list
+// The list and each link carry their record ID in an HTML comment,
+// so that an edited file can be synced back to the list
+//
+//	<!-- list: recXXXXXXXXXXXXXX -->
+//	- [ ] [Title](https://example.com) <!-- recXXXXXXXXXXXXXX -->
+//	- [x] [Done](https://example.org) <!-- recXXXXXXXXXXXXXX -->
+
+type LinkCopier struct {
+	ListID  *string
+	Entries []LinkCopierEntry
+}
+
+type LinkCopierEntry struct {
+	ID   *string
+	Name string
+	URL  string
+	Done bool
+	// Set by outlines, see outline.go
+	Note string
+	Tags []string
+}
+
+var (
+	lcListRe  = regexp.MustCompile(`^<!--\s*list:\s*(rec[0-9A-Za-z]{14})\s*-->$`)
+	lcIDRe    = regexp.MustCompile(`<!--\s*(rec[0-9A-Za-z]{14})\s*-->`)
+	lcCheckRe = regexp.MustCompile(`^(?:[-*+]|\d{1,9}[.)])\s+\[([ xX])\]\s`)
+)
+
+// Every link of the file, with the done state of its line
+// A record ID only applies to a line with a single link
+func parseLinkCopier(text string) LinkCopier {
+	lc := LinkCopier{}
+	for line := range strings.SplitSeq(text, "\n") {
+		line = strings.TrimSpace(line)
+		if m := lcListRe.FindStringSubmatch(line); m != nil {
+			lc.ListID = &m[1]
+			continue
+		}
+		done := false
+		if m := lcCheckRe.FindStringSubmatch(line); m != nil {
+			done = m[1] != " "
+		}
+		links := extractMDLinks(line)
+		for _, link := range links {
+			entry := LinkCopierEntry{Name: link.Title, URL: link.URL, Done: done}
+			if entry.Name == "" {
+				entry.Name = link.URL
+			}
+			if m := lcIDRe.FindStringSubmatch(link.Context); m != nil && len(links) == 1 {
+				entry.ID = &m[1]
+			}
+			lc.Entries = append(lc.Entries, entry)
+		}
+	}
+	return lc
+}
+
+func formatLinkCopier(listID string, links []Link) string {
+	lines := []string{fmt.Sprintf("<!-- list: %s -->", listID)}
+	for _, link := range links {
+		check := " "
+		if link.Done {
+			check = "x"
+		}
+		lines = append(lines, fmt.Sprintf("- [%s] [%s](%s) <!-- %s -->", check, *link.Name, *link.URL, *link.ID))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Sort the links of a list in the order set in Airtable; links missing from the order come last
+func sortByOrder(links []Link, order []string) {
+	slices.SortStableFunc(links, func(a, b Link) int {
+		i, j := slices.Index(order, *a.ID), slices.Index(order, *b.ID)
+		if i < 0 {
+			i = len(order)
+		}
+		if j < 0 {
+			j = len(order)
+		}
+		return i - j
+	})
+}
+
+// The changes that make a list match an edited link copier file
+type LinkCopierDiff struct {
+	// The links of the list in the order of the file; links to create have no ID
+	Links []Link
+	// Links that are new
+	Create []Link
+	// Links whose name, URL or done state changed, with the new values
+	Update []Link
+	// Saved links that join the list, and links that leave it
+	Add    []Link
+	Remove []Link
+	// Whether the links or the order of the list changed
+	Reorder bool
+}
+
+// Compare a file with the links of the list (in their current order) and all cached links
+// Lines without an ID are matched by URL with the links of the list not referred to by ID
+func diffLinkCopier(lc LinkCopier, listLinks []Link, cached map[string]Link) LinkCopierDiff {
+	diff := LinkCopierDiff{}
+	members := map[string]Link{}
+	for _, link := range listLinks {
+		members[*link.ID] = link
+	}
+	referenced := map[string]bool{}
+	for _, entry := range lc.Entries {
+		if entry.ID != nil {
+			referenced[*entry.ID] = true
+		}
+	}
+	byURL := map[string]string{}
+	for _, link := range listLinks {
+		if key := normalizeURL(*link.URL); !referenced[*link.ID] && byURL[key] == "" {
+			byURL[key] = *link.ID
+		}
+	}
+
+	used := map[string]bool{}
+	for _, entry := range lc.Entries {
+		var link *Link
+		if entry.ID != nil {
+			if l, ok := cached[*entry.ID]; ok {
+				link = &l
+			}
+		} else if id := byURL[normalizeURL(entry.URL)]; id != "" {
+			l := members[id]
+			link = &l
+		}
+		if link != nil && used[*link.ID] {
+			continue
+		}
+		if link == nil {
+			created := Link{Name: stringPtr(entry.Name), URL: stringPtr(entry.URL), Done: entry.Done}
+			diff.Create = append(diff.Create, created)
+			diff.Links = append(diff.Links, created)
+			continue
+		}
+		used[*link.ID] = true
+		if _, ok := members[*link.ID]; !ok {
+			diff.Add = append(diff.Add, *link)
+		}
+		if *link.Name != entry.Name || *link.URL != entry.URL || link.Done != entry.Done {
+			updated := *link
+			updated.Name = stringPtr(entry.Name)
+			updated.URL = stringPtr(entry.URL)
+			updated.Done = entry.Done
+			diff.Update = append(diff.Update, updated)
+		}
+		diff.Links = append(diff.Links, *link)
+	}
+	for _, link := range listLinks {
+		if !used[*link.ID] {
+			diff.Remove = append(diff.Remove, link)
+		}
+	}
+
+	diff.Reorder = len(diff.Links) != len(listLinks)
+	for i := 0; !diff.Reorder && i < len(diff.Links); i++ {
+		diff.Reorder = diff.Links[i].ID == nil || *diff.Links[i].ID != *listLinks[i].ID
+	}
+	return diff
+}
+
+func (d *LinkCopierDiff) empty() bool {
+	return len(d.Create) == 0 && len(d.Update) == 0 && !d.Reorder
+}
+
+func (d *LinkCopierDiff) summary() string {
+	done := 0
+	for _, link := range d.Update {
+		if link.Done {
+			done++
+		}
+	}
+	return fmt.Sprintf("%d created  ·  %d updated (%d done)  ·  %d added  ·  %d removed", len(d.Create), len(d.Update), done, len(d.Add), len(d.Remove))
+}
+
+// The IDs of the links in a list on Airtable, which may include links added since the last sync
+func (a *Airtable) fetchListLinkIDs(listID string) ([]string, error) {
+	records, err := a.fetchRecords("Lists", map[string]any{
+		"filterByFormula": fmt.Sprintf("RECORD_ID()='%s'", listID),
+		"fields":          []string{"Links"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("list %s %w", listID, errNotFound)
+	}
+	return records[0].toList().LinkIDs, nil
+}
+
+// Apply the changes made to a link copier file to its list
+// Removed lines only take links out of the list, the links are kept
+// The file is rewritten with the IDs of the new links
+func (a *Airtable) syncLinkCopier(file string) (*LinkCopierDiff, error) {
+	text, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	lc := parseLinkCopier(string(text))
+	if lc.ListID == nil {
+		return nil, fmt.Errorf("no list ID found in file %s", file)
+	}
+	listID := *lc.ListID
+	lists, err := a.cache.getLists(nil)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.ContainsFunc(lists, func(l List) bool { return *l.ID == listID }) {
+		return nil, fmt.Errorf("list %s not found", listID)
+	}
+
+	listLinks, err := a.cache.getLinks(&List{ID: &listID}, nil)
+	if err != nil {
+		return nil, err
+	}
+	order, err := a.cache.getLinkOrder(listID)
+	if err != nil {
+		return nil, err
+	}
+	sortByOrder(listLinks, order)
+	all, err := a.cache.getLinks(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	cached := map[string]Link{}
+	for _, link := range all {
+		cached[*link.ID] = link
+	}
+	diff := diffLinkCopier(lc, listLinks, cached)
+	if diff.empty() {
+		return &diff, nil
+	}
+
+	if len(diff.Create) > 0 {
+		records := make([]*Record, len(diff.Create))
+		for i, link := range diff.Create {
+			link.ListIDs = []string{listID}
+			record := link.toRecord()
+			records[i] = &record
+		}
+		if err = a.createRecords("Links", &records); err != nil {
+			return nil, err
+		}
+		created := make([]Link, len(records))
+		for i, record := range records {
+			created[i] = *record.toLink()
+		}
+		if err = a.cache.saveLinks(created); err != nil {
+			return nil, err
+		}
+		// Fill in the IDs of the new links, which come in the order of the file
+		next := 0
+		for i := range diff.Links {
+			if diff.Links[i].ID == nil {
+				diff.Links[i] = created[next]
+				next++
+			}
+		}
+		diff.Create = created
+	}
+
+	if diff.Reorder {
+		remote, err := a.fetchListLinkIDs(listID)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, len(diff.Links))
+		for i, link := range diff.Links {
+			ids[i] = *link.ID
+		}
+		// Keep the links added to the list elsewhere since the last sync, which the file could not show
+		for _, id := range remote {
+			if !slices.Contains(ids, id) && !slices.ContainsFunc(listLinks, func(l Link) bool { return *l.ID == id }) {
+				ids = append(ids, id)
+			}
+		}
+		records := []*Record{{ID: &listID, Fields: &map[string]any{"Links": ids}}}
+		if err = a.updateRecords("Lists", &records); err != nil {
+			return nil, err
+		}
+		if err = a.cache.saveLists([]List{*records[0].toList()}); err != nil {
+			return nil, err
+		}
+		// Airtable updates the Lists field of the links; do the same in the cache
+		changed := []Link{}
+		for _, link := range diff.Add {
+			link.ListIDs = append(slices.Clone(link.ListIDs), listID)
+			changed = append(changed, link)
+		}
+		for _, link := range diff.Remove {
+			link.ListIDs = slices.DeleteFunc(slices.Clone(link.ListIDs), func(id string) bool { return id == listID })
+			changed = append(changed, link)
+		}
+		if err = a.cache.saveLinks(changed); err != nil {
+			return nil, err
+		}
+	}
+
+	updates := map[string]Link{}
+	for _, link := range diff.Update {
+		updates[*link.ID] = link
+	}
+	_, err = a.updateLinks(diff.Update, func(link Link) map[string]any {
+		return map[string]any{"Name": *link.Name, "URL": *link.URL, "Done": link.Done}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, link := range diff.Links {
+		if updated, ok := updates[*link.ID]; ok {
+			diff.Links[i] = updated
+		}
+	}
+
+	logMessage("INFO", "Synced %s to list %s: %s", file, listID, diff.summary())
+	return &diff, os.WriteFile(file, []byte(formatLinkCopier(listID, diff.Links)), 0o644)
+}
+
+// The changes that append the links of a link copier file to an existing list
+type LinkCopierAppend struct {
+	// Links that are new, created in the list
+	Create []Link
+	// Saved links that join the list
+	Link []Link
+	// Lines already in the list, or repeated in the file
+	Skipped int
+}
+
+// Match the lines of a file with the saved links by normalized URL
+// The record IDs of the file are ignored, as it may come from another list
+func planLinkCopierAppend(lc LinkCopier, listLinks []Link, cached []Link) LinkCopierAppend {
+	plan := LinkCopierAppend{}
+	seen := map[string]bool{}
+	for _, link := range listLinks {
+		seen[normalizeURL(*link.URL)] = true
+	}
+	saved := map[string]Link{}
+	for _, link := range cached {
+		if key := normalizeURL(*link.URL); saved[key].ID == nil {
+			saved[key] = link
+		}
+	}
+	for _, entry := range lc.Entries {
+		key := normalizeURL(entry.URL)
+		if seen[key] {
+			plan.Skipped++
+			continue
+		}
+		seen[key] = true
+		if link, ok := saved[key]; ok {
+			plan.Link = append(plan.Link, link)
+		} else {
+			link := Link{Name: stringPtr(entry.Name), URL: stringPtr(entry.URL), Done: entry.Done, Tags: entry.Tags}
+			if entry.Note != "" {
+				link.Note = stringPtr(entry.Note)
+			}
+			plan.Create = append(plan.Create, link)
+		}
+	}
+	return plan
+}
+
+func (p *LinkCopierAppend) summary() string {
+	return fmt.Sprintf("%d added  ·  %d linked  ·  %d skipped", len(p.Create), len(p.Link), p.Skipped)
+}
+
+func readLinkCopier(file string) (*LinkCopier, error) {
+	text, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	lc := parseLinkCopier(string(text))
+	if len(lc.Entries) == 0 {
+		return nil, fmt.Errorf("no valid links found in file %s", file)
+	}
+	return &lc, nil
+}
+
+func (a *Airtable) planAppend(lc LinkCopier, listID string, cached []Link) (*LinkCopierAppend, error) {
+	listLinks, err := a.cache.getLinks(&List{ID: &listID}, nil)
+	if err != nil {
+		return nil, err
+	}
+	plan := planLinkCopierAppend(lc, listLinks, cached)
+	return &plan, nil
+}
+
+// Append the links of a link copier file to an existing list, after its current links
+// Saved links are added to the list instead of being created again
+func (a *Airtable) appendLinkCopier(file string, listID string) (*LinkCopierAppend, error) {
+	lists, err := a.cache.getLists(nil)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.ContainsFunc(lists, func(l List) bool { return *l.ID == listID }) {
+		return nil, fmt.Errorf("list %s not found", listID)
+	}
+	lc, err := readLinkCopier(file)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := a.appendEntries(listID, *lc)
+	if err != nil {
+		return nil, err
+	}
+	logMessage("INFO", "Appended %s to list %s: %s", file, listID, plan.summary())
+	return plan, nil
+}
+
+func (a *Airtable) appendEntries(listID string, lc LinkCopier) (*LinkCopierAppend, error) {
+	all, err := a.cache.getLinks(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := a.planAppend(lc, listID, all)
+	if err != nil {
+		return nil, err
+	}
+	if len(plan.Create) == 0 && len(plan.Link) == 0 {
+		return plan, nil
+	}
+
+	if len(plan.Create) > 0 {
+		records := make([]*Record, len(plan.Create))
+		for i, link := range plan.Create {
+			link.ListIDs = []string{listID}
+			record := link.toRecord()
+			records[i] = &record
+		}
+		if err = a.createRecords("Links", &records); err != nil {
+			return nil, err
+		}
+		for i, record := range records {
+			plan.Create[i] = *record.toLink()
+		}
+		if err = a.cache.saveLinks(plan.Create); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(plan.Link) > 0 {
+		// Append to the links of the list on Airtable, which may have changed since the last sync
+		ids, err := a.fetchListLinkIDs(listID)
+		if err != nil {
+			return nil, err
+		}
+		// Airtable may already have put the created links in the list
+		for _, link := range slices.Concat(plan.Link, plan.Create) {
+			if !slices.Contains(ids, *link.ID) {
+				ids = append(ids, *link.ID)
+			}
+		}
+		records := []*Record{{ID: &listID, Fields: &map[string]any{"Links": ids}}}
+		if err = a.updateRecords("Lists", &records); err != nil {
+			return nil, err
+		}
+		if err = a.cache.saveLists([]List{*records[0].toList()}); err != nil {
+			return nil, err
+		}
+		// Airtable updates the Lists field of the links; do the same in the cache
+		for i, link := range plan.Link {
+			link.ListIDs = append(slices.Clone(link.ListIDs), listID)
+			plan.Link[i] = link
+		}
+		if err = a.cache.saveLinks(plan.Link); err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+// Choose the list to append a link copier file to, with a preview of the changes to each list
+func (a *Airtable) chooseAppendList(file string, input string) {
+	wf := Workflow{}
+	lc, err := readLinkCopier(file)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+		wf.output()
+		return
+	}
+	lists, err := a.cache.getLists(nil)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+		wf.output()
+		return
+	}
+	all, err := a.cache.getLinks(nil, nil)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+		wf.output()
+		return
+	}
+	match := strings.ToLower(input)
+	for _, list := range lists {
+		if match != "" && !strings.Contains(strings.ToLower(*list.match()), match) {
+			continue
+		}
+		plan, err := a.planAppend(*lc, *list.ID, all)
+		if err != nil {
+			wf.warnEmpty("Error: " + err.Error())
+			wf.output()
+			return
+		}
+		item := Item{
+			Title:    "Append to " + *list.Name,
+			Subtitle: plan.summary(),
+			Icon:     &Icon{Path: stringPtr("media/list.png")},
+			Variables: map[string]string{
+				"file":   file,
+				"listID": *list.ID,
+				"exec":   "lc-append",
+			},
+		}
+		if len(plan.Create) == 0 && len(plan.Link) == 0 {
+			item.Valid = boolPtr(false)
+		}
+		wf.addItem(item)
+	}
+	if len(wf.Views) == 0 {
+		wf.warnEmpty("No Lists Found")
+	}
+	wf.output()
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseLinkCopier(t *testing.T) {
+	text := `<!-- list: recAAAAAAAAAAAAAA -->
+- [ ] [Open](https://a.com) <!-- recBBBBBBBBBBBBBB -->
+- [x] [Done [1]](https://b.com/x_(y)) <!-- recCCCCCCCCCCCCCC -->
+- [Old style](https://c.com)
+[No bullet](https://d.com)
+1. [E](https://e.com) and https://f.com <!-- recDDDDDDDDDDDDDD -->
+Some notes
+- [ ] [Not a link](notes)
+`
+	lc := parseLinkCopier(text)
+	if lc.ListID == nil || *lc.ListID != "recAAAAAAAAAAAAAA" {
+		t.Errorf("ListID = %v, want recAAAAAAAAAAAAAA", lc.ListID)
+	}
+	got := []string{}
+	for _, e := range lc.Entries {
+		id := ""
+		if e.ID != nil {
+			id = *e.ID
+		}
+		got = append(got, fmt.Sprintf("%s|%s|%v|%s", e.Name, e.URL, e.Done, id))
+	}
+	want := []string{
+		"Open|https://a.com|false|recBBBBBBBBBBBBBB",
+		"Done [1]|https://b.com/x_(y)|true|recCCCCCCCCCCCCCC",
+		"Old style|https://c.com|false|",
+		"No bullet|https://d.com|false|",
+		"E|https://e.com|false|",
+		"https://f.com|https://f.com|false|",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseLinkCopier() = %v, want %v", got, want)
+	}
+
+	links := []Link{
+		{ID: stringPtr("recBBBBBBBBBBBBBB"), Name: stringPtr("Open"), URL: stringPtr("https://a.com")},
+		{ID: stringPtr("recCCCCCCCCCCCCCC"), Name: stringPtr("Done [1]"), URL: stringPtr("https://b.com/x_(y)"), Done: true},
+	}
+	if got := formatLinkCopier("recAAAAAAAAAAAAAA", links); !strings.HasPrefix(text, got) {
+		t.Errorf("formatLinkCopier() = %q, want a prefix of the parsed text", got)
+	}
+}
+
+func TestDiffLinkCopier(t *testing.T) {
+	link := func(id, name, url string, done bool) Link {
+		return Link{ID: stringPtr(id), Name: stringPtr(name), URL: stringPtr(url), Done: done}
+	}
+	listLinks := []Link{
+		link("recA", "A", "https://a.com", false),
+		link("recB", "B", "https://b.com", false),
+		link("recC", "C", "https://c.com", false),
+	}
+	cached := map[string]Link{}
+	for _, l := range append(slices.Clone(listLinks), link("recD", "D", "https://d.com", false)) {
+		cached[*l.ID] = l
+	}
+	lc := LinkCopier{Entries: []LinkCopierEntry{
+		{ID: stringPtr("recB"), Name: "B", URL: "https://b.com", Done: true},
+		{Name: "New", URL: "https://new.com"},
+		{Name: "A again", URL: "https://www.a.com/"},
+		{ID: stringPtr("recD"), Name: "D", URL: "https://d.com"},
+		{ID: stringPtr("recB"), Name: "B", URL: "https://b.com"},
+	}}
+	diff := diffLinkCopier(lc, listLinks, cached)
+	ids := func(links []Link) []string {
+		out := []string{}
+		for _, l := range links {
+			if l.ID == nil {
+				out = append(out, "new:"+*l.Name)
+			} else {
+				out = append(out, *l.ID)
+			}
+		}
+		return out
+	}
+	if want := []string{"recB", "new:New", "recA", "recD"}; !slices.Equal(ids(diff.Links), want) {
+		t.Errorf("Links = %v, want %v", ids(diff.Links), want)
+	}
+	if want := []string{"new:New"}; !slices.Equal(ids(diff.Create), want) {
+		t.Errorf("Create = %v, want %v", ids(diff.Create), want)
+	}
+	if want := []string{"recB", "recA"}; !slices.Equal(ids(diff.Update), want) {
+		t.Errorf("Update = %v, want %v", ids(diff.Update), want)
+	}
+	if want := []string{"recD"}; !slices.Equal(ids(diff.Add), want) {
+		t.Errorf("Add = %v, want %v", ids(diff.Add), want)
+	}
+	if want := []string{"recC"}; !slices.Equal(ids(diff.Remove), want) {
+		t.Errorf("Remove = %v, want %v", ids(diff.Remove), want)
+	}
+	if !diff.Reorder {
+		t.Error("Reorder = false, want true")
+	}
+
+	// An unchanged file has no changes
+	lc = LinkCopier{}
+	for _, l := range listLinks {
+		lc.Entries = append(lc.Entries, LinkCopierEntry{ID: l.ID, Name: *l.Name, URL: *l.URL})
+	}
+	if diff = diffLinkCopier(lc, listLinks, cached); !diff.empty() {
+		t.Errorf("diffLinkCopier() of an unchanged file = %s", diff.summary())
+	}
+}
+
+func TestSyncLinkCopier(t *testing.T) {
+	fake := &fakeAirtable{}
+	fake.set("Links", "recA0000000000000", map[string]any{"Name": "A", "URL": "https://a.com", "Done": false})
+	fake.set("Links", "recB0000000000000", map[string]any{"Name": "B", "URL": "https://b.com", "Done": false})
+	fake.set("Lists", "recL0000000000000", map[string]any{"Name": "Reading", "Links": []any{"recA0000000000000", "recB0000000000000"}})
+	airtable := newTestAirtable(t, fake)
+	listID := "recL0000000000000"
+	_ = airtable.cache.saveLists([]List{{ID: &listID, Name: stringPtr("Reading"), LinkIDs: []string{"recA0000000000000", "recB0000000000000"}}})
+	_ = airtable.cache.saveLinks([]Link{
+		{ID: stringPtr("recA0000000000000"), Name: stringPtr("A"), URL: stringPtr("https://a.com"), ListIDs: []string{listID}},
+		{ID: stringPtr("recB0000000000000"), Name: stringPtr("B"), URL: stringPtr("https://b.com"), ListIDs: []string{listID}},
+	})
+
+	// The link copier files are written to the working directory
+	t.Chdir(t.TempDir())
+	file, err := airtable.listToLinkCopier(&List{ID: &listID, Name: stringPtr("Reading")})
+	if err != nil {
+		t.Fatalf("listToLinkCopier() error = %v", err)
+	}
+	text, _ := os.ReadFile(*file)
+	if want := "<!-- list: recL0000000000000 -->\n- [ ] [A](https://a.com) <!-- recA0000000000000 -->\n- [ ] [B](https://b.com) <!-- recB0000000000000 -->\n"; string(text) != want {
+		t.Fatalf("listToLinkCopier() wrote %q, want %q", text, want)
+	}
+
+	// R is added to the list elsewhere after the last sync
+	fake.set("Links", "recR0000000000000", map[string]any{"Name": "R", "URL": "https://r.com"})
+	fake.set("Lists", listID, map[string]any{"Links": []any{"recA0000000000000", "recB0000000000000", "recR0000000000000"}})
+
+	// Mark B done and move it up, drop A, add C
+	edited := "<!-- list: recL0000000000000 -->\n- [x] [B](https://b.com) <!-- recB0000000000000 -->\n- [ ] [C](https://c.com)\n"
+	if err = os.WriteFile(*file, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := airtable.syncLinkCopier(*file)
+	if err != nil {
+		t.Fatalf("syncLinkCopier() error = %v", err)
+	}
+	if got, want := diff.summary(), "1 created  ·  1 updated (1 done)  ·  0 added  ·  1 removed"; got != want {
+		t.Errorf("summary() = %q, want %q", got, want)
+	}
+	if got := fake.records["Lists"][listID]["Links"]; fmt.Sprint(got) != "[recB0000000000000 recLin00000000001 recR0000000000000]" {
+		t.Errorf("list links = %v, want B, C then R", got)
+	}
+	if done := fake.records["Links"]["recB0000000000000"]["Done"]; done != true {
+		t.Errorf("B done = %v, want true", done)
+	}
+	if _, ok := fake.records["Links"]["recA0000000000000"]; !ok {
+		t.Error("A was deleted, want it only removed from the list")
+	}
+
+	text, _ = os.ReadFile(*file)
+	if want := "<!-- list: recL0000000000000 -->\n- [x] [B](https://b.com) <!-- recB0000000000000 -->\n- [ ] [C](https://c.com) <!-- recLin00000000001 -->\n"; string(text) != want {
+		t.Errorf("synced file = %q, want %q", text, want)
+	}
+	links, _ := airtable.cache.getLinks(&List{ID: &listID}, nil)
+	if len(links) != 2 {
+		t.Errorf("cache has %d links in the list, want 2", len(links))
+	}
+	// Syncing again changes nothing
+	if diff, err = airtable.syncLinkCopier(*file); err != nil || !diff.empty() {
+		t.Errorf("second syncLinkCopier() = %s, %v, want no changes", diff.summary(), err)
+	}
+}
+
+func TestAppendLinkCopier(t *testing.T) {
+	fake := &fakeAirtable{}
+	fake.set("Links", "recA0000000000000", map[string]any{"Name": "A", "URL": "https://a.com"})
+	fake.set("Links", "recD0000000000000", map[string]any{"Name": "D", "URL": "https://d.com"})
+	fake.set("Lists", "recL0000000000000", map[string]any{"Name": "Reading", "Links": []any{"recA0000000000000"}})
+	airtable := newTestAirtable(t, fake)
+	listID := "recL0000000000000"
+	_ = airtable.cache.saveLists([]List{{ID: &listID, Name: stringPtr("Reading"), LinkIDs: []string{"recA0000000000000"}}})
+	_ = airtable.cache.saveLinks([]Link{
+		{ID: stringPtr("recA0000000000000"), Name: stringPtr("A"), URL: stringPtr("https://a.com"), ListIDs: []string{listID}},
+		{ID: stringPtr("recD0000000000000"), Name: stringPtr("D"), URL: stringPtr("https://d.com")},
+	})
+
+	// R is added to the list elsewhere after the last sync
+	fake.set("Links", "recR0000000000000", map[string]any{"Name": "R", "URL": "https://r.com"})
+	fake.set("Lists", listID, map[string]any{"Links": []any{"recA0000000000000", "recR0000000000000"}})
+
+	// IDs of another list are ignored
+	file := t.TempDir() + "/Other.md"
+	text := "<!-- list: recOOOOOOOOOOOOOO -->\n- [ ] [A](https://www.a.com/) <!-- recXXXXXXXXXXXXXX -->\n- [ ] [D](http://d.com)\n- [x] [E](https://e.com)\n- [E again](https://e.com/)\n"
+	if err := os.WriteFile(file, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := airtable.appendLinkCopier(file, listID)
+	if err != nil {
+		t.Fatalf("appendLinkCopier() error = %v", err)
+	}
+	if got, want := plan.summary(), "1 added  ·  1 linked  ·  2 skipped"; got != want {
+		t.Errorf("summary() = %q, want %q", got, want)
+	}
+	if got := fake.records["Lists"][listID]["Links"]; fmt.Sprint(got) != "[recA0000000000000 recR0000000000000 recD0000000000000 recLin00000000001]" {
+		t.Errorf("list links = %v, want A, R, D then E", got)
+	}
+	if done := fake.records["Links"]["recLin00000000001"]["Done"]; done != true {
+		t.Errorf("E done = %v, want true", done)
+	}
+	links, _ := airtable.cache.getLinks(&List{ID: &listID}, nil)
+	if len(links) != 3 {
+		t.Errorf("cache has %d links in the list, want 3", len(links))
+	}
+
+	// Appending again adds nothing
+	if plan, err = airtable.appendLinkCopier(file, listID); err != nil || plan.summary() != "0 added  ·  0 linked  ·  4 skipped" {
+		t.Errorf("second appendLinkCopier() = %s, %v, want everything skipped", plan.summary(), err)
+	}
+	if _, err = airtable.appendLinkCopier(file, "recMissing"); err == nil {
+		t.Error("appendLinkCopier() to a missing list error = nil")
+	}
+}
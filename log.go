@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Leveled structured logs, configured with environment variables:
+//
+//	LOG_LEVEL      debug, info (default), warn or error
+//	LOG_FORMAT     text (default) or json
+//	LOG_MAX_SIZE   size in bytes of the log file before it is rotated (default 1 MB)
+//	LOG_BACKUPS    number of rotated files kept (default 3)
+//
+// Every mode writes to airtable.log in the workflow cache directory,
+// and to stderr as well when the Alfred debugger is open
+
+const (
+	logFileName    = "airtable.log"
+	logMaxSize     = 1 << 20
+	logBackupCount = 3
+)
+
+// Until setupLogging is called, e.g. in tests, logs go to stderr
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+func logDir() string {
+	if dir := os.Getenv("alfred_workflow_cache"); dir != "" {
+		return dir
+	}
+	return os.Getenv("alfred_workflow_data")
+}
+
+func logFile() string {
+	return path.Join(logDir(), logFileName)
+}
+
+func logLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+func envInt(name string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n >= 0 {
+		return n
+	}
+	return fallback
+}
+
+func setupLogging() error {
+	if err := os.MkdirAll(logDir(), 0o755); err != nil {
+		return err
+	}
+	var w io.Writer = &rotatingFile{
+		file:    logFile(),
+		maxSize: int64(envInt("LOG_MAX_SIZE", logMaxSize)),
+		backups: envInt("LOG_BACKUPS", logBackupCount),
+	}
+	if os.Getenv("alfred_debug") == "1" {
+		w = io.MultiWriter(w, os.Stderr)
+	}
+	options := &slog.HandlerOptions{Level: logLevel()}
+	var handler slog.Handler = slog.NewTextHandler(w, options)
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "json") {
+		handler = slog.NewJSONHandler(w, options)
+	}
+	// Background runs log with the mode that started them
+	mode := os.Getenv("mode")
+	if mode == "" {
+		mode = os.Getenv("exec")
+	}
+	logger = slog.New(handler).With("pid", os.Getpid(), "mode", mode)
+	// Also for the log package
+	slog.SetDefault(logger)
+	return nil
+}
+
+// Log a formatted message at a level: DEBUG, INFO, WARN or ERROR
+func logMessage(level string, format string, a ...any) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		l = slog.LevelInfo
+	}
+	logger.Log(context.Background(), l, fmt.Sprintf(format, a...))
+}
+
+// A log file that is renamed to file.1 (and file.1 to file.2...) once it grows past maxSize
+// The size is checked on each write, so that processes writing to the same file rotate it once
+type rotatingFile struct {
+	mu      sync.Mutex
+	file    string
+	maxSize int64
+	backups int
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if info, err := os.Stat(r.file); err == nil && r.maxSize > 0 && info.Size()+int64(len(p)) > r.maxSize {
+		r.rotate()
+	}
+	f, err := os.OpenFile(r.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return f.Write(p)
+}
+
+func (r *rotatingFile) rotate() {
+	if r.backups == 0 {
+		_ = os.Remove(r.file)
+		return
+	}
+	for i := r.backups - 1; i > 0; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", r.file, i), fmt.Sprintf("%s.%d", r.file, i+1))
+	}
+	_ = os.Rename(r.file, r.file+".1")
+}
+
+// An Airtable API request, logged with its ID, table, record count and latency once it ends
+type apiCall struct {
+	id     string
+	method string
+	table  string
+	start  time.Time
+}
+
+func newAPICall(req *http.Request, table string) *apiCall {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	call := &apiCall{id: hex.EncodeToString(b), method: req.Method, table: table, start: time.Now()}
+	req.Header.Set("X-Request-Id", call.id)
+	return call
+}
+
+func (c *apiCall) end(status int, records int, err error) {
+	attrs := []any{
+		"request", c.id,
+		"method", c.method,
+		"table", c.table,
+		"status", status,
+		"records", records,
+		"latency", time.Since(c.start).Round(time.Millisecond),
+	}
+	if err != nil {
+		logger.Error("API call failed", append(attrs, "error", err)...)
+		return
+	}
+	logger.Info("API call", attrs...)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestRotatingFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	r := &rotatingFile{file: file, maxSize: 10, backups: 2}
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	want := map[string]string{"": "four\nfive\n", ".1": "three\n", ".2": "one\ntwo\n"}
+	for suffix, text := range want {
+		if got, _ := os.ReadFile(file + suffix); string(got) != text {
+			t.Errorf("test.log%s = %q, want %q", suffix, got, text)
+		}
+	}
+	if _, err := os.Stat(file + ".3"); !os.IsNotExist(err) {
+		t.Error("test.log.3 exists, want 2 backups")
+	}
+}
+
+func TestSetupLogging(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("alfred_workflow_cache", dir)
+	t.Setenv("alfred_debug", "")
+	t.Setenv("LOG_FORMAT", "json")
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("mode", "sync")
+	saved, savedDefault := logger, slog.Default()
+	defer func() { logger = saved; slog.SetDefault(savedDefault) }()
+	if err := setupLogging(); err != nil {
+		t.Fatalf("setupLogging() error = %v", err)
+	}
+	logMessage("INFO", "hidden")
+	logMessage("ERROR", "Failed to fetch %s", "links")
+
+	t.Setenv("LOG_LEVEL", "")
+	_ = setupLogging()
+	fake := &fakeAirtable{}
+	server := fake.serve(t)
+	defer server.Close()
+	airtable := &Airtable{baseURL: server.URL, baseID: "app", auth: &Auth{Token: &oauth2.Token{AccessToken: "token"}}}
+	records := []*Record{{Fields: &map[string]any{"Name": "A"}}, {Fields: &map[string]any{"Name": "B"}}}
+	if err := airtable.createRecords("Links", &records); err != nil {
+		t.Fatal(err)
+	}
+
+	text, _ := os.ReadFile(filepath.Join(dir, "airtable.log"))
+	lines := strings.Split(strings.TrimSpace(string(text)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("log = %s, want 3 lines", text)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["level"] != "ERROR" || entry["msg"] != "Failed to fetch links" || entry["mode"] != "sync" {
+		t.Errorf("log entry = %v", entry)
+	}
+	entry = nil
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["msg"] != "API call" || entry["table"] != "Links" || entry["records"] != 2.0 || entry["method"] != "POST" || len(entry["request"].(string)) != 8 || entry["latency"] == nil {
+		t.Errorf("API call entry = %v", entry)
+	}
+}
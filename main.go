@@ -4,25 +4,88 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"path"
+	"slices"
 	"strings"
 )
 
-func syncInBackground(force ...bool) {
+// Run the binary again in the background with extra environment variables
+// It logs to the log file itself; its stderr only gets what the logger does not catch, such as panics
+func runInBackground(env ...string) {
 	cmd := exec.Command(os.Args[0])
-	logFile := path.Join(os.Getenv("alfred_workflow_cache"), "airtable.log")
-	if f, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err == nil {
+	if f, err := os.OpenFile(logFile(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err == nil {
 		cmd.Stderr = f
 	}
+	cmd.Env = backgroundEnv(env...)
+	_ = cmd.Start()
+}
+
+// The environment of a background job: without the selection of a rofi session,
+// which would replace the mode of the job with the one of the selected row, nor its renderer
+func backgroundEnv(env ...string) []string {
+	inherited := slices.DeleteFunc(os.Environ(), func(v string) bool {
+		return strings.HasPrefix(v, "ROFI_") || strings.HasPrefix(v, "renderer=")
+	})
+	return append(inherited, append(env, "alfred_debug=0")...)
+}
+
+func syncInBackground(force ...bool) {
 	if len(force) > 0 && force[0] {
-		cmd.Env = append(os.Environ(), "mode=force-sync")
+		runInBackground("mode=force-sync")
 	} else {
-		cmd.Env = append(os.Environ(), "mode=sync")
+		runInBackground("mode=sync")
 	}
-	_ = cmd.Start()
+}
+
+// The links selected for a bulk action, with the variables that select them:
+// IDs, URLs and markdown links from the IDs variable or the arguments, or else a group (groupBy and group)
+func (a *Airtable) getSelection(args ...string) ([]Link, map[string]string, error) {
+	targets := append([]string{os.Getenv("IDs")}, args...)
+	// Explicit links take precedence over the group they were picked from
+	if groupBy := os.Getenv("groupBy"); groupBy != "" && strings.TrimSpace(strings.Join(targets, "")) == "" {
+		vars := map[string]string{"groupBy": groupBy, "group": os.Getenv("group")}
+		links, err := a.cache.getGroupLinks(groupBy, os.Getenv("group"))
+		return links, vars, err
+	}
+	links, err := a.resolveLinks(targets...)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]string, len(links))
+	for i, link := range links {
+		ids[i] = *link.ID
+	}
+	return links, map[string]string{"IDs": strings.Join(ids, ",")}, nil
+}
+
+// The links of a single-link action: the ID variable, the IDs variable or the arguments
+// An ID missing from the cache, e.g. of a link created since the last sync, is used as is
+func (a *Airtable) actionLinks() ([]Link, error) {
+	links, err := a.resolveLinks(append([]string{os.Getenv("ID"), os.Getenv("IDs")}, os.Args[1:]...)...)
+	if id := os.Getenv("ID"); id != "" && !slices.ContainsFunc(links, func(l Link) bool { return *l.ID == id }) {
+		links, err = append(links, Link{ID: &id}), nil
+	}
+	return links, err
+}
+
+// The field whose options are managed: Tags (default) or Category
+func choiceField() string {
+	if field := os.Getenv("field"); field != "" {
+		return field
+	}
+	return "Tags"
 }
 
 func main() {
+	applyRofiSelection()
+	mode := os.Getenv("mode")
+	if mode == "" {
+		mode = os.Getenv("exec")
+	}
+	// The doctor runs without signing in, so that it works when the sign-in is broken
+	if mode == "doctor" || mode == "doctor-fix" || (mode == "" && len(os.Args) > 1 && os.Args[1] == "doctor") {
+		os.Exit(runDoctor(mode))
+	}
+
 	cacheDir := os.Getenv("alfred_workflow_data")
 	if cacheDir == "" {
 		fmt.Fprintln(os.Stderr, "Error: alfred_workflow_data is not set")
@@ -31,28 +94,39 @@ func main() {
 	if _, err := os.Stat(cacheDir); os.IsNotExist(err) {
 		_ = os.Mkdir(cacheDir, 0o755)
 	}
-
-	airtable := &Airtable{
-		baseURL: "https://api.airtable.com/v0",
-		baseID:  os.Getenv("BASE_ID"),
-		dbPath:  path.Join(cacheDir, "airtable.db"),
+	if err := setupLogging(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
 	}
-	if err := airtable.init(); err != nil {
+
+	airtable := newAirtable(cacheDir)
+	// The native messaging host must not wait for a sign-in in the browser, it refreshes the token when saving,
+	// and its manifests need no sign-in
+	nativeHost := mode == "native-host" || (mode == "" && len(os.Args) > 1 && os.Args[1] == "native-host")
+	if err := airtable.init(nativeHost); err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 		os.Exit(1)
 	}
 
-	mode := os.Getenv("mode")
-	if mode == "" {
-		mode = os.Getenv("exec")
+	if mode == "" && len(os.Args) > 1 {
+		code := runCLI(airtable, os.Args[1:], os.Stdout, os.Stderr)
+		airtable.cache.db.Close()
+		os.Exit(code)
 	}
 	switch mode {
 	case "sync":
 		_ = airtable.syncData()
 	case "force-sync":
 		_ = airtable.syncData(true)
+	case "fetch-metadata":
+		airtable.fetchMetadata(os.Getenv("URL"))
+	case "fetch-favicons":
+		fetchFavicons(strings.Split(os.Getenv("hosts"), ","))
 	case "list-links":
 		syncInBackground()
+		if groupBy := os.Getenv("groupBy"); groupBy != "" && os.Getenv("listID") == "" {
+			airtable.listGroupLinks(groupBy, os.Getenv("group"))
+			break
+		}
 		var list *List
 		if listID := os.Getenv("listID"); listID != "" {
 			list = &List{ID: &listID}
@@ -75,19 +149,31 @@ func main() {
 			notify("Link saved!", os.Getenv("title"))
 			_ = airtable.syncData(true)
 		}
-	case "delete-link":
-		var link *Link
-		if linkID := os.Getenv("ID"); linkID != "" {
-			link = &Link{ID: &linkID}
+	case "bulk-add":
+		input := ""
+		if len(os.Args) > 1 {
+			input = strings.Trim(os.Args[1], " ")
+		}
+		airtable.bulkAdd(os.Getenv("text"), input)
+	case "save-links":
+		if count, err := airtable.saveBulkLinks(os.Getenv("text"), os.Getenv("listID"), os.Getenv("newList")); err != nil {
+			notify(err.Error())
 		} else {
-			fmt.Fprintln(os.Stderr, "Error: ID is required")
+			notify("Links saved!", fmt.Sprintf("%d links", count))
+		}
+	case "delete-link":
+		links, err := airtable.actionLinks()
+		if err != nil {
+			notify(err.Error())
+			fmt.Fprintln(os.Stderr, "Error:", err)
 			os.Exit(1)
 		}
-		if err := airtable.deleteLink(link); err != nil {
+		if count, err := airtable.bulkUpdate(links, "delete", ""); err != nil {
 			notify(err.Error())
-		} else {
+		} else if count == 1 {
 			notify("Link deleted!")
-			_ = airtable.syncData(true)
+		} else {
+			notify(bulkSummary("delete", count))
 		}
 	case "delete-list":
 		var list *List
@@ -118,19 +204,225 @@ func main() {
 			_ = airtable.syncData(true)
 		}
 	case "complete-link":
-		var link *Link
-		if linkID := os.Getenv("ID"); os.Getenv("ID") != "" {
-			link = &Link{ID: &linkID}
+		links, err := airtable.actionLinks()
+		if err != nil {
+			notify(err.Error())
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if count, err := airtable.bulkUpdate(links, "done", ""); err != nil {
+			notify(err.Error())
+		} else if count == 1 {
+			notify("Link marked as done!")
+		} else {
+			notify(bulkSummary("done", count))
+		}
+	case "list-tags":
+		syncInBackground()
+		input := ""
+		if len(os.Args) > 1 {
+			input = strings.Trim(os.Args[1], " ")
+		}
+		airtable.listTags(choiceField(), input)
+	case "edit-tag":
+		input := ""
+		if len(os.Args) > 1 {
+			input = strings.Trim(os.Args[1], " ")
+		}
+		airtable.editTag(choiceField(), os.Getenv("tag"), os.Getenv("action"), input)
+	case "create-tag":
+		if err := airtable.createChoice(choiceField(), os.Getenv("tag"), nil); err != nil {
+			notify(err.Error())
+		} else {
+			notify(choiceLabel(choiceField())+" created!", os.Getenv("tag"))
+		}
+	case "rename-tag":
+		if count, err := airtable.renameChoice(choiceField(), os.Getenv("tag"), os.Getenv("newName")); err != nil {
+			notify(err.Error())
+		} else {
+			notify(choiceLabel(choiceField())+" renamed!", fmt.Sprintf("%s → %s (%d links)", os.Getenv("tag"), os.Getenv("newName"), count))
+		}
+	case "recolor-tag":
+		if err := airtable.recolorChoice(choiceField(), os.Getenv("tag"), os.Getenv("color")); err != nil {
+			notify(err.Error())
+		} else {
+			notify(choiceLabel(choiceField())+" recolored!", os.Getenv("tag"))
+		}
+	case "delete-tag":
+		if count, err := airtable.deleteChoice(choiceField(), os.Getenv("tag")); err != nil {
+			notify(err.Error())
 		} else {
-			fmt.Fprintln(os.Stderr, "Error: ID is required")
+			notify(choiceLabel(choiceField())+" deleted!", fmt.Sprintf("%s (%d links)", os.Getenv("tag"), count))
+		}
+	case "list-categories":
+		syncInBackground()
+		airtable.listGroups("Category")
+	case "list-domains":
+		syncInBackground()
+		airtable.listGroups("Domain")
+	case "edit-group":
+		// The group actions of list-categories and list-domains open the tag or list picker of the bulk actions
+		input := ""
+		if len(os.Args) > 1 {
+			input = strings.Trim(os.Args[1], " ")
+		}
+		prefix := map[string]string{"tag": "#", "list": "@"}[os.Getenv("action")]
+		groupBy, group := os.Getenv("groupBy"), os.Getenv("group")
+		links, _ := airtable.cache.getGroupLinks(groupBy, group)
+		airtable.bulkLinks(links, map[string]string{"groupBy": groupBy, "group": group}, prefix+input)
+	case "complete-group", "tag-group", "list-group":
+		action, value := "done", ""
+		switch mode {
+		case "tag-group":
+			action, value = "tag", os.Getenv("tag")
+		case "list-group":
+			action, value = "list", os.Getenv("listID")
+		}
+		links, err := airtable.cache.getGroupLinks(os.Getenv("groupBy"), os.Getenv("group"))
+		if err != nil {
+			notify(err.Error())
+		} else if count, err := airtable.bulkUpdate(links, action, value); err != nil {
+			notify(err.Error())
+		} else {
+			notify(bulkSummary(action, count), os.Getenv("group"))
+		}
+	case "bulk-links":
+		input := ""
+		if len(os.Args) > 1 {
+			input = strings.Trim(os.Args[1], " ")
+		}
+		links, vars, _ := airtable.getSelection()
+		airtable.bulkLinks(links, vars, input)
+	case "bulk-update":
+		links, _, err := airtable.getSelection(os.Args[1:]...)
+		if err != nil {
+			notify(err.Error())
+			break
+		}
+		action := os.Getenv("bulkAction")
+		if count, err := airtable.bulkUpdate(links, action, os.Getenv("value")); err != nil {
+			notify(err.Error())
+		} else {
+			notify(bulkSummary(action, count))
+		}
+	case "find-duplicates":
+		airtable.listDuplicates()
+	case "list-duplicate-group":
+		airtable.listDuplicateGroup(strings.Split(os.Getenv("IDs"), ","))
+	case "merge-links":
+		keepID := os.Getenv("keepID")
+		if keepID == "" {
+			fmt.Fprintln(os.Stderr, "Error: keepID is required")
 			os.Exit(1)
 		}
-		link.Done = true
-		if err := airtable.updateLink(link); err != nil {
+		if link, err := airtable.mergeDuplicates(keepID, strings.Split(os.Getenv("IDs"), ",")); err != nil {
 			notify(err.Error())
 		} else {
-			notify("Link marked as done!")
-			_ = airtable.syncData(true)
+			notify("Links merged!", *link.Name)
+		}
+	case "check-links":
+		count, err := airtable.checkLinks(os.Getenv("force") == "true")
+		if err != nil {
+			notify(err.Error())
+			break
+		}
+		health, _ := airtable.cache.getLinkHealth()
+		broken, redirected := healthSummary(health)
+		notify("Links checked!", fmt.Sprintf("%d checked, %d broken, %d redirected", count, broken, redirected))
+	case "list-link-health":
+		airtable.listLinkHealth()
+	case "update-url":
+		if err := airtable.updateURL(os.Getenv("ID"), os.Getenv("URL")); err != nil {
+			notify(err.Error())
+		} else {
+			notify("URL updated!", os.Getenv("URL"))
+		}
+	case "archive-links":
+		if count, err := airtable.archiveLinks(os.Getenv("force") == "true"); err != nil {
+			notify(err.Error())
+		} else {
+			notify("Links archived!", fmt.Sprintf("%d pages archived", count))
+		}
+	case "archive-link":
+		if err := airtable.archiveLink(os.Getenv("ID")); err != nil {
+			notify(err.Error())
+		} else {
+			notify("Page archived!")
+		}
+	case "show-archive":
+		airtable.showArchive(os.Getenv("ID"))
+	case "search-archive":
+		input := ""
+		if len(os.Args) > 1 {
+			input = strings.Trim(os.Args[1], " ")
+		}
+		airtable.searchArchive(input)
+	case "export":
+		format, file := os.Getenv("format"), os.Getenv("file")
+		if len(os.Args) > 1 {
+			format = os.Args[1]
+		}
+		if len(os.Args) > 2 {
+			file = os.Args[2]
+		}
+		if format == "" {
+			format = "html"
+		}
+		file, count, err := airtable.exportLinks(format, file, exportFilterFromEnv())
+		if err != nil {
+			notify(err.Error())
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if file != "-" {
+			notify("Links exported!", fmt.Sprintf("%d links to %s", count, file))
+			fmt.Print(file)
+		}
+	case "preview-import":
+		file := os.Getenv("file")
+		if len(os.Args) > 1 {
+			file = strings.TrimSpace(os.Args[1])
+		}
+		airtable.previewImport(file, os.Getenv("format"))
+	case "import":
+		file := os.Getenv("file")
+		if len(os.Args) > 1 {
+			file = os.Args[1]
+		}
+		plan, err := airtable.planImport(file, os.Getenv("format"))
+		if err != nil {
+			notify(err.Error())
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if os.Getenv("dryRun") == "true" {
+			fmt.Println(plan.summary())
+			break
+		}
+		count, err := airtable.runImport(plan)
+		if err != nil {
+			notify(err.Error(), fmt.Sprintf("%d links imported, run the import again to continue", count))
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		notify("Links imported!", fmt.Sprintf("%d links, %d already saved", count, plan.Duplicates))
+	case "list-templates":
+		airtable.listTemplates(os.Getenv("listID"))
+	case "export-list":
+		listID, name := os.Getenv("listID"), os.Getenv("template")
+		if listID == "" || name == "" {
+			fmt.Fprintln(os.Stderr, "Error: listID and template are required")
+			os.Exit(1)
+		}
+		file, err := airtable.exportList(listID, name, os.Getenv("file"))
+		if err != nil {
+			notify(err.Error())
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if file != "-" {
+			notify("List exported!", file)
+			fmt.Print(file)
 		}
 	case "list-to-lc":
 		var list *List
@@ -162,6 +454,73 @@ func main() {
 		} else {
 			notify("List created!", *list.Name)
 		}
+	case "lc-append-list":
+		input := ""
+		if len(os.Args) > 1 {
+			input = os.Args[1]
+		}
+		airtable.chooseAppendList(os.Getenv("file"), input)
+	case "lc-append":
+		file, listID := os.Getenv("file"), os.Getenv("listID")
+		if file == "" || listID == "" {
+			fmt.Fprintln(os.Stderr, "Error: file and listID are required")
+			os.Exit(1)
+		}
+		plan, err := airtable.appendLinkCopier(file, listID)
+		if err != nil {
+			notify(err.Error())
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		notify("Links appended!", plan.summary())
+	case "preview-outline":
+		file := os.Getenv("file")
+		if len(os.Args) > 1 {
+			file = strings.TrimSpace(os.Args[1])
+		}
+		airtable.previewOutline(file, os.Getenv("tags") == "true")
+	case "import-outline":
+		file := os.Getenv("file")
+		if len(os.Args) > 1 {
+			file = os.Args[1]
+		}
+		plans, err := airtable.importOutline(file, os.Getenv("tags") == "true")
+		if err != nil {
+			notify(err.Error())
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		notify("Outline imported!", outlineSummary(plans))
+	case "serve":
+		if err := airtable.serve("", os.Stderr); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	case "native-host":
+		// A sync that has to sign in would open the browser: refresh the token first, and skip the sync when signed out
+		if err := airtable.refreshAuth(); err == nil {
+			syncInBackground()
+		}
+		if err := airtable.nativeHost(os.Stdin, os.Stdout); err != nil {
+			logMessage("ERROR", "Native messaging host: %v", err)
+			os.Exit(1)
+		}
+	case "lc-sync":
+		if len(os.Args) < 2 {
+			fmt.Fprintln(os.Stderr, "Error: file path is required")
+			os.Exit(1)
+		}
+		diff, err := airtable.syncLinkCopier(os.Args[1])
+		if err != nil {
+			notify(err.Error())
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if diff.empty() {
+			notify("List is up to date")
+		} else {
+			notify("List synced!", diff.summary())
+		}
 	}
 	airtable.cache.db.Close()
 }
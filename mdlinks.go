@@ -0,0 +1,433 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Extract links from markdown, following the CommonMark rules for inline links:
+// inline links with balanced parentheses and optional titles, reference links,
+// <autolinks>, and bare URLs as in GitHub Flavored Markdown
+// Links in code spans and images are not links
+
+type MDLink struct {
+	Title string
+	URL   string
+	// inline, reference, autolink or bare
+	Kind string
+	// The line around the link, without the link and the list marker
+	Context string
+	// The position of the link in the text
+	Start int
+	End   int
+}
+
+var (
+	mdDefinitionRe = regexp.MustCompile(`^ {0,3}\[((?:[^\[\]\\]|\\.)+)\]:[ \t]*(<[^<>\n]*>|\S+)(?:[ \t]+("(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|\((?:[^()\\]|\\.)*\)))?[ \t]*$`)
+	mdAutolinkRe   = regexp.MustCompile(`^<([A-Za-z][A-Za-z0-9+.\-]{1,31}:[^\s<>]*)>`)
+	mdBareURLRe    = regexp.MustCompile(`^(?:[Hh][Tt][Tt][Pp][Ss]?://|www\.)[^\s<]+`)
+	mdListMarkerRe = regexp.MustCompile(`^(?:[-*+]|\d{1,9}[.)])(?:\s+|$)(?:\[[ xX]\](?:\s+|$))?`)
+	mdEscapeRe     = regexp.MustCompile(`\\([!-/:-@\[-` + "`" + `{-~])`)
+)
+
+// Remove backslash escapes and decode entities
+func mdUnescape(s string) string {
+	return html.UnescapeString(mdEscapeRe.ReplaceAllString(s, "$1"))
+}
+
+// Reference labels match case-insensitively, with whitespace collapsed
+func mdLabel(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// Every link in a text with an absolute URL, in order
+func extractMDLinks(text string) []MDLink {
+	p := mdParser{text: text, definitions: map[string]string{}, memo: &mdMemo{inner: map[[2]int][]MDLink{}}}
+	p.findDefinitions()
+	p.scan(0, len(text))
+	links := []MDLink{}
+	for _, link := range p.links {
+		if testURL(link.URL) {
+			link.Context = p.context(link.Start, link.End)
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// The link that makes up the whole text, apart from a list marker
+// Bare URLs are not returned, as they often come with words for quick add
+func wholeMDLink(text string) *MDLink {
+	links := extractMDLinks(text)
+	if len(links) != 1 || links[0].Kind == "bare" || links[0].Context != "" {
+		return nil
+	}
+	return &links[0]
+}
+
+type mdParser struct {
+	text        string
+	definitions map[string]string
+	// Lines of link reference definitions, which are skipped
+	skip  [][2]int
+	links []MDLink
+	// Shared with the parsers of the text of links, so that nested brackets are scanned once
+	memo *mdMemo
+}
+
+type mdMemo struct {
+	// The position of the bracket closing the one at each position, or -1
+	closes []int
+	// The links between two positions
+	inner map[[2]int][]MDLink
+}
+
+func (p *mdParser) findDefinitions() {
+	start := 0
+	for start <= len(p.text) {
+		end := strings.IndexByte(p.text[start:], '\n')
+		if end < 0 {
+			end = len(p.text)
+		} else {
+			end += start
+		}
+		if m := mdDefinitionRe.FindStringSubmatch(p.text[start:end]); m != nil {
+			label := mdLabel(m[1])
+			if _, ok := p.definitions[label]; !ok && label != "" {
+				p.definitions[label] = mdUnescape(strings.TrimSuffix(strings.TrimPrefix(m[2], "<"), ">"))
+			}
+			p.skip = append(p.skip, [2]int{start, end})
+		}
+		start = end + 1
+	}
+}
+
+func (p *mdParser) scan(start int, end int) {
+	i := start
+	for i < end {
+		if next := p.skipped(i); next > i {
+			i = next
+			continue
+		}
+		switch c := p.text[i]; {
+		case c == '\\':
+			i += 2
+		case c == '`':
+			i = p.codeSpan(i, end)
+		case c == '<':
+			if m := mdAutolinkRe.FindStringSubmatch(p.text[i:end]); m != nil {
+				p.links = append(p.links, MDLink{Title: m[1], URL: m[1], Kind: "autolink", Start: i, End: i + len(m[0])})
+				i += len(m[0])
+			} else {
+				i++
+			}
+		case c == '!' && i+1 < end && p.text[i+1] == '[':
+			// Skip images, but not the links in their description
+			if _, _, next, ok := p.link(i+1, end); ok {
+				p.scan(i+2, p.closeBracket(i+1, end))
+				i = next
+			} else {
+				i++
+			}
+		case c == '[':
+			close, URL, next, ok := p.link(i, end)
+			if !ok {
+				i++
+				continue
+			}
+			// Links cannot contain other links
+			if slices.ContainsFunc(p.linksIn(i+1, p.closeBracket(i, end)), func(l MDLink) bool { return l.Kind != "bare" }) {
+				i++
+				continue
+			}
+			kind := "inline"
+			if next <= len(p.text) && p.text[next-1] == ']' {
+				kind = "reference"
+			}
+			p.links = append(p.links, MDLink{Title: mdLinkText(p.text[i+1 : close]), URL: URL, Kind: kind, Start: i, End: next})
+			i = next
+		case (c == 'h' || c == 'H' || c == 'w') && (i == 0 || strings.ContainsRune(" \t\n*_~(", rune(p.text[i-1]))):
+			if n := p.bareURL(i, end); n > 0 {
+				URL := p.text[i : i+n]
+				link := URL
+				if strings.HasPrefix(URL, "www.") {
+					link = "http://" + URL
+				}
+				p.links = append(p.links, MDLink{Title: URL, URL: link, Kind: "bare", Start: i, End: i + n})
+				i += n
+			} else {
+				i++
+			}
+		default:
+			i++
+		}
+	}
+}
+
+// The links between start and end, such as in the text of a link
+func (p *mdParser) linksIn(start int, end int) []MDLink {
+	key := [2]int{start, end}
+	if links, ok := p.memo.inner[key]; ok {
+		return links
+	}
+	inner := mdParser{text: p.text, definitions: p.definitions, memo: p.memo}
+	inner.scan(start, end)
+	p.memo.inner[key] = inner.links
+	return inner.links
+}
+
+// The end of the definition line at i, or i
+func (p *mdParser) skipped(i int) int {
+	for _, r := range p.skip {
+		if i >= r[0] && i < r[1] {
+			return r[1]
+		}
+	}
+	return i
+}
+
+// Skip a code span opened by the backticks at i
+func (p *mdParser) codeSpan(i int, end int) int {
+	n := 0
+	for i+n < end && p.text[i+n] == '`' {
+		n++
+	}
+	fence := p.text[i : i+n]
+	for j := i + n; j < end; {
+		k := strings.Index(p.text[j:end], fence)
+		if k < 0 {
+			break
+		}
+		k += j
+		m := 0
+		for k+m < end && p.text[k+m] == '`' {
+			m++
+		}
+		if m == n {
+			return k + n
+		}
+		j = k + m
+	}
+	return i + n
+}
+
+// The position of the bracket closing the one at i, or end
+func (p *mdParser) closeBracket(i int, end int) int {
+	if p.memo.closes == nil {
+		p.matchBrackets()
+	}
+	if close := p.memo.closes[i]; close >= 0 && close < end {
+		return close
+	}
+	return end
+}
+
+// Match the brackets of the text in one pass, outside code spans and paragraphs
+func (p *mdParser) matchBrackets() {
+	closes := make([]int, len(p.text))
+	for i := range closes {
+		closes[i] = -1
+	}
+	open := []int{}
+	for j := 0; j < len(p.text); j++ {
+		switch p.text[j] {
+		case '\\':
+			j++
+		case '`':
+			j = p.codeSpan(j, len(p.text)) - 1
+		case '\n':
+			// A blank line ends the paragraph
+			if j+1 < len(p.text) && p.text[j+1] == '\n' {
+				open = open[:0]
+			}
+		case '[':
+			open = append(open, j)
+		case ']':
+			if len(open) > 0 {
+				closes[open[len(open)-1]] = j
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	p.memo.closes = closes
+}
+
+// Parse a link starting with the bracket at i
+// Returns the end of its text, its destination and the position after it
+func (p *mdParser) link(i int, end int) (int, string, int, bool) {
+	close := p.closeBracket(i, end)
+	if close >= end {
+		return 0, "", 0, false
+	}
+	raw := p.text[i+1 : close]
+	j := close + 1
+	if j < end && p.text[j] == '(' {
+		if URL, next, ok := p.destination(j, end); ok {
+			return close, URL, next, true
+		}
+	}
+	label := raw
+	if j < end && p.text[j] == '[' {
+		if k := p.closeBracket(j, end); k < end {
+			if k > j+1 {
+				label = p.text[j+1 : k]
+			}
+			if URL, ok := p.definition(label); ok {
+				return close, URL, k + 1, true
+			}
+			return 0, "", 0, false
+		}
+	}
+	if URL, ok := p.definition(label); ok {
+		return close, URL, j, true
+	}
+	return 0, "", 0, false
+}
+
+// The destination defined for a reference label, which has at most 999 characters
+func (p *mdParser) definition(label string) (string, bool) {
+	if len(label) > 999 || len(p.definitions) == 0 {
+		return "", false
+	}
+	URL, ok := p.definitions[mdLabel(label)]
+	return URL, ok
+}
+
+// Parse an inline destination and title starting with the parenthesis at i
+func (p *mdParser) destination(i int, end int) (string, int, bool) {
+	j := skipSpaces(p.text, i+1, end)
+	var URL string
+	if j < end && p.text[j] == '<' {
+		k := j + 1
+		for k < end && p.text[k] != '>' {
+			if p.text[k] == '\n' || p.text[k] == '<' {
+				return "", 0, false
+			}
+			if p.text[k] == '\\' {
+				k++
+			}
+			k++
+		}
+		if k >= end {
+			return "", 0, false
+		}
+		URL = p.text[j+1 : k]
+		j = k + 1
+	} else {
+		depth := 0
+		k := j
+	dest:
+		for k < end {
+			switch c := p.text[k]; {
+			case c == '\\' && k+1 < end:
+				k += 2
+				continue
+			case c <= ' ' || c == 0x7f:
+				break dest
+			case c == '(':
+				// Like other parsers, allow 32 levels of nested parentheses
+				if depth++; depth > 32 {
+					return "", 0, false
+				}
+			case c == ')':
+				if depth == 0 {
+					break dest
+				}
+				depth--
+			}
+			k++
+		}
+		if depth != 0 {
+			return "", 0, false
+		}
+		URL = p.text[j:k]
+		j = k
+	}
+	spaced := j
+	j = skipSpaces(p.text, j, end)
+	if j < end && j > spaced && strings.ContainsRune(`"'(`, rune(p.text[j])) {
+		closer := p.text[j]
+		if closer == '(' {
+			closer = ')'
+		}
+		k := j + 1
+		for k < end && p.text[k] != closer {
+			if p.text[k] == '\\' {
+				k++
+			}
+			k++
+		}
+		if k >= end {
+			return "", 0, false
+		}
+		j = skipSpaces(p.text, k+1, end)
+	}
+	if j >= end || p.text[j] != ')' {
+		return "", 0, false
+	}
+	return mdUnescape(URL), j + 1, true
+}
+
+// Spaces, tabs and at most one line ending
+func skipSpaces(s string, i int, end int) int {
+	newline := false
+	for i < end {
+		switch s[i] {
+		case ' ', '\t':
+		case '\n':
+			if newline {
+				return i
+			}
+			newline = true
+		default:
+			return i
+		}
+		i++
+	}
+	return i
+}
+
+var mdImageRe = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+
+// The plain text of a link: images are replaced by their description
+func mdLinkText(raw string) string {
+	text := mdImageRe.ReplaceAllString(raw, "$1")
+	return strings.Join(strings.Fields(mdUnescape(text)), " ")
+}
+
+// The length of a bare URL at i, without trailing punctuation and unbalanced parentheses
+func (p *mdParser) bareURL(i int, end int) int {
+	m := mdBareURLRe.FindString(p.text[i:end])
+	if m == "" {
+		return 0
+	}
+	for len(m) > 0 {
+		last := m[len(m)-1]
+		if strings.IndexByte("?!.,:*_~'\"", last) >= 0 {
+			m = m[:len(m)-1]
+			continue
+		}
+		if last == ')' && strings.Count(m, ")") > strings.Count(m, "(") {
+			m = m[:len(m)-1]
+			continue
+		}
+		break
+	}
+	if !strings.Contains(strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(m), "https://"), "http://"), ".") {
+		return 0
+	}
+	return len(m)
+}
+
+// The line of a link without the link itself and the list marker
+func (p *mdParser) context(start int, end int) string {
+	lineStart := strings.LastIndexByte(p.text[:start], '\n') + 1
+	lineEnd := len(p.text)
+	if k := strings.IndexByte(p.text[end:], '\n'); k >= 0 {
+		lineEnd = end + k
+	}
+	before := mdListMarkerRe.ReplaceAllString(strings.TrimLeft(p.text[lineStart:start], " \t"), "")
+	return strings.Join(strings.Fields(before+" "+p.text[end:lineEnd]), " ")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtractMDLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"inline", "[Go](https://go.dev)", []string{"inline|Go|https://go.dev|"}},
+		{"parentheses in URL", "- [Rust](https://en.wikipedia.org/wiki/Rust_(programming_language)) is fast", []string{"inline|Rust|https://en.wikipedia.org/wiki/Rust_(programming_language)|is fast"}},
+		{"brackets in title", "* [The [best] guide](https://a.com)", []string{"inline|The [best] guide|https://a.com|"}},
+		{"numbered bullet", "12. [A](https://a.com \"Title\")", []string{"inline|A|https://a.com|"}},
+		{"checkbox", "- [x] [A](<https://a.com/with space>) <!-- note -->", []string{"inline|A|https://a.com/with space|<!-- note -->"}},
+		{"several per line", "[A](https://a.com) and [B](https://b.com)", []string{"inline|A|https://a.com|and [B](https://b.com)", "inline|B|https://b.com|[A](https://a.com) and"}},
+		{"autolink", "See <https://a.com/x?y=1>.", []string{"autolink|https://a.com/x?y=1|https://a.com/x?y=1|See ."}},
+		{"bare URLs", "Read https://a.com/page, then (www.b.com/x).", []string{"bare|https://a.com/page|https://a.com/page|Read , then (www.b.com/x).", "bare|www.b.com/x|http://www.b.com/x|Read https://a.com/page, then ( )."}},
+		{"reference", "[Go][go], [Rust][] and [Zig].\n\n[go]: https://go.dev\n[rust]: <https://rust-lang.org> \"Rust\"\n[ZIG]: https://ziglang.org", []string{"reference|Go|https://go.dev|, [Rust][] and [Zig].", "reference|Rust|https://rust-lang.org|[Go][go], and [Zig].", "reference|Zig|https://ziglang.org|[Go][go], [Rust][] and ."}},
+		{"escapes and entities", `[a \] b](https://a.com/\_x?a=1&amp;b=2)`, []string{"inline|a ] b|https://a.com/_x?a=1&b=2|"}},
+		{"image in link", "[![logo](https://a.com/logo.png) Home](https://a.com)", []string{"inline|logo Home|https://a.com|"}},
+		{"images are not links", "![logo](https://a.com/logo.png)", nil},
+		{"code spans", "`[A](https://a.com)` and ``https://b.com``", nil},
+		{"relative links", "[notes](notes.md) [top](#top)", nil},
+		// Not a link, but the URL is a bare URL
+		{"unbalanced", "[A](https://a.com/(x) [B](https://b.com)", []string{"bare|https://a.com/(x)|https://a.com/(x)|[A]( [B](https://b.com)", "inline|B|https://b.com|[A](https://a.com/(x)"}},
+		{"link in link text", "[see [A](https://a.com)](https://b.com)", []string{"inline|A|https://a.com|[see ](https://b.com)", "bare|https://b.com|https://b.com|[see [A](https://a.com)]( )"}},
+		{"URL as text", "[https://a.com](https://a.com)", []string{"inline|https://a.com|https://a.com|"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, link := range extractMDLinks(tt.text) {
+				got = append(got, fmt.Sprintf("%s|%s|%s|%s", link.Kind, link.Title, link.URL, link.Context))
+				if link.Start < 0 || link.End > len(tt.text) || link.Start >= link.End {
+					t.Errorf("link %s at %d-%d", link.URL, link.Start, link.End)
+				}
+			}
+			if !slices.Equal(got, tt.want) && (len(got) > 0 || len(tt.want) > 0) {
+				t.Errorf("extractMDLinks(%q)\n got %q\nwant %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// Nested brackets are scanned once, not once per enclosing level
+func TestExtractMDLinksNested(t *testing.T) {
+	texts := []string{
+		strings.Repeat("[", 25) + "a](https://a.com)" + strings.Repeat("](https://b.com)", 24),
+		strings.Repeat("[", 300) + "a](https://a.com)" + strings.Repeat("](https://b.com)", 299),
+		strings.Repeat("[", 5000) + strings.Repeat("]", 5000),
+		strings.Repeat("[a](", 5000),
+	}
+	for _, text := range texts {
+		start := time.Now()
+		links := extractMDLinks(text)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("extractMDLinks(%q...) took %v", text[:10], elapsed)
+		}
+		if text == texts[0] && (len(links) == 0 || links[0].URL != "https://a.com") {
+			t.Errorf("extractMDLinks(%q...) = %+v, want the innermost link first", text[:10], links)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// A native messaging host for a browser extension: the browser runs the binary
+// and exchanges JSON messages with it, each preceded by its length as a 32-bit integer
+// in native byte order, over stdin and stdout
+// https://developer.chrome.com/docs/extensions/develop/concepts/native-messaging
+// https://developer.mozilla.org/en-US/docs/Mozilla/Add-ons/WebExtensions/Native_messaging
+//
+// Requests, with an optional id that is sent back with the response:
+//
+//	{"type": "save", "url": ..., "title": ..., "note": ..., "tags": [...], "category": ..., "lists": [...]}
+//	{"type": "lookup", "url": ...}
+//	{"type": "tags", "prefix": ...}
+
+const (
+	nativeHostName = "com.twio142.alfred_airtable"
+	// Chrome refuses larger messages from the host, and sends at most 64 MiB
+	nativeMaxResponse = 1 << 20
+	nativeMaxRequest  = 64 << 20
+	nativeMaxTags     = 20
+)
+
+type NativeRequest struct {
+	ID       any      `json:"id,omitempty"`
+	Type     string   `json:"type"`
+	URL      string   `json:"url,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Note     string   `json:"note,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Category string   `json:"category,omitempty"`
+	Lists    []string `json:"lists,omitempty"`
+	Prefix   string   `json:"prefix,omitempty"`
+}
+
+type NativeList struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type NativeResponse struct {
+	ID      any          `json:"id,omitempty"`
+	OK      bool         `json:"ok"`
+	Error   string       `json:"error,omitempty"`
+	Saved   bool         `json:"saved,omitempty"`
+	Created bool         `json:"created,omitempty"`
+	Link    *Link        `json:"link,omitempty"`
+	Lists   []NativeList `json:"lists,omitempty"`
+	Tags    []string     `json:"tags,omitempty"`
+}
+
+func readNativeMessage(r io.Reader, v any) error {
+	var size uint32
+	if err := binary.Read(r, binary.NativeEndian, &size); err != nil {
+		return err
+	}
+	if size > nativeMaxRequest {
+		return fmt.Errorf("message too large: %d bytes", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeNativeMessage(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(data) > nativeMaxResponse {
+		return fmt.Errorf("message too large: %d bytes", len(data))
+	}
+	if err = binary.Write(w, binary.NativeEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Answer messages until the browser closes stdin
+func (a *Airtable) nativeHost(r io.Reader, w io.Writer) error {
+	for {
+		var req NativeRequest
+		err := readNativeMessage(r, &req)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if err != nil && !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+			return err
+		}
+		resp := &NativeResponse{}
+		if err == nil {
+			resp, err = a.handleNativeRequest(req)
+		}
+		if err != nil {
+			logMessage("WARN", "Native message %s failed: %v", req.Type, err)
+			resp = &NativeResponse{Error: err.Error()}
+		} else {
+			resp.OK = true
+		}
+		resp.ID = req.ID
+		if err = writeNativeMessage(w, resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (a *Airtable) handleNativeRequest(req NativeRequest) (*NativeResponse, error) {
+	switch req.Type {
+	case "save":
+		return a.nativeSave(req)
+	case "lookup":
+		return a.nativeLookup(req.URL)
+	case "tags":
+		return &NativeResponse{Tags: completeTags(a.cache.getChoiceNames("Tags"), req.Prefix)}, nil
+	}
+	return nil, fmt.Errorf("unknown message type: %q", req.Type)
+}
+
+// Whether a page is saved, with its link and lists
+func (a *Airtable) nativeLookup(URL string) (*NativeResponse, error) {
+	if !testURL(URL) {
+		return nil, fmt.Errorf("invalid URL: %s", URL)
+	}
+	link, err := a.cache.getLinkByURL(URL)
+	if err != nil || link == nil {
+		return &NativeResponse{}, nil
+	}
+	lists, err := a.cache.getLists(nil)
+	if err != nil {
+		return nil, err
+	}
+	resp := &NativeResponse{Saved: true, Link: link, Lists: []NativeList{}}
+	for _, list := range lists {
+		if slices.Contains(link.ListIDs, *list.ID) {
+			resp.Lists = append(resp.Lists, NativeList{ID: *list.ID, Name: *list.Name})
+		}
+	}
+	return resp, nil
+}
+
+// Save a page; a saved page gets the new tags and lists, and the selected text is added to its note
+func (a *Airtable) nativeSave(req NativeRequest) (*NativeResponse, error) {
+	if !testURL(req.URL) {
+		return nil, fmt.Errorf("invalid URL: %s", req.URL)
+	}
+	if err := a.refreshAuth(); err != nil {
+		return nil, err
+	}
+	note := strings.TrimSpace(req.Note)
+	var category *string
+	if req.Category != "" {
+		if !slices.Contains(a.cache.getChoiceNames("Category"), req.Category) {
+			return nil, fmt.Errorf("unknown category: %s", req.Category)
+		}
+		category = &req.Category
+	}
+
+	saved, _ := a.cache.getLinkByURL(req.URL)
+	if saved == nil {
+		link := Link{URL: &req.URL, Name: nonEmpty(req.Title), Note: nonEmpty(note), Category: category, Tags: req.Tags, ListIDs: req.Lists}
+		if err := a.addLink(&link); err != nil {
+			return nil, err
+		}
+		a.addTagChoices(req.Tags)
+		resp, err := a.nativeLookup(*link.URL)
+		if err == nil {
+			resp.Created = true
+		}
+		return resp, err
+	}
+
+	link := *saved
+	if note != "" && (link.Note == nil || !strings.Contains(*link.Note, note)) {
+		if link.Note != nil && *link.Note != "" {
+			note = *link.Note + "\n\n" + note
+		}
+		link.Note = &note
+	}
+	if category != nil {
+		link.Category = category
+	}
+	link.Tags = unionStrings(slices.Clone(link.Tags), req.Tags)
+	link.ListIDs = unionStrings(slices.Clone(link.ListIDs), req.Lists)
+	if err := a.updateLink(&link); err != nil {
+		return nil, err
+	}
+	if err := a.cache.saveLinks([]Link{link}); err != nil {
+		return nil, err
+	}
+	a.addTagChoices(req.Tags)
+	return a.nativeLookup(*link.URL)
+}
+
+// Cache the tags that Airtable created with typecast
+func (a *Airtable) addTagChoices(tags []string) {
+	names := a.cache.getChoiceNames("Tags")
+	for _, tag := range tags {
+		if !slices.Contains(names, tag) {
+			_ = a.cache.addChoice("Tags", Choice{Name: tag})
+		}
+	}
+}
+
+// The tags starting with a prefix, then those containing it, ignoring case
+func completeTags(tags []string, prefix string) []string {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	starts, contains := []string{}, []string{}
+	for _, tag := range tags {
+		lower := strings.ToLower(tag)
+		if strings.HasPrefix(lower, prefix) {
+			starts = append(starts, tag)
+		} else if strings.Contains(lower, prefix) {
+			contains = append(contains, tag)
+		}
+	}
+	completions := append(starts, contains...)
+	return completions[:min(len(completions), nativeMaxTags)]
+}
+
+// The manifest a browser reads to find the host
+type NativeManifest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Path        string `json:"path"`
+	Type        string `json:"type"`
+	// Chrome and other Chromium browsers allow extension origins, Firefox extension IDs
+	AllowedOrigins    []string `json:"allowed_origins,omitempty"`
+	AllowedExtensions []string `json:"allowed_extensions,omitempty"`
+}
+
+// The directories of the manifests of each browser, relative to the home directory
+var nativeManifestDirs = map[string]map[string]string{
+	"darwin": {
+		"chrome":   "Library/Application Support/Google/Chrome/NativeMessagingHosts",
+		"chromium": "Library/Application Support/Chromium/NativeMessagingHosts",
+		"brave":    "Library/Application Support/BraveSoftware/Brave-Browser/NativeMessagingHosts",
+		"edge":     "Library/Application Support/Microsoft Edge/NativeMessagingHosts",
+		"firefox":  "Library/Application Support/Mozilla/NativeMessagingHosts",
+	},
+	"linux": {
+		"chrome":   ".config/google-chrome/NativeMessagingHosts",
+		"chromium": ".config/chromium/NativeMessagingHosts",
+		"brave":    ".config/BraveSoftware/Brave-Browser/NativeMessagingHosts",
+		"edge":     ".config/microsoft-edge/NativeMessagingHosts",
+		"firefox":  ".mozilla/native-messaging-hosts",
+	},
+}
+
+func nativeManifest(browser string, path string, extensions []string) (NativeManifest, error) {
+	manifest := NativeManifest{
+		Name:        nativeHostName,
+		Description: "Save links to Airtable",
+		Path:        path,
+		Type:        "stdio",
+	}
+	if len(extensions) == 0 {
+		return manifest, fmt.Errorf("an extension ID is required")
+	}
+	switch browser {
+	case "firefox":
+		manifest.AllowedExtensions = extensions
+	case "chrome", "chromium", "brave", "edge":
+		for _, id := range extensions {
+			if !strings.HasPrefix(id, "chrome-extension://") {
+				id = "chrome-extension://" + id
+			}
+			manifest.AllowedOrigins = append(manifest.AllowedOrigins, strings.TrimSuffix(id, "/")+"/")
+		}
+	default:
+		return manifest, fmt.Errorf("unknown browser: %s", browser)
+	}
+	return manifest, nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// The browser starts the host without the environment of the workflow,
+// so the manifest points to a script that sets it, then runs the binary in native-host mode
+func nativeHostScript(binary string) string {
+	b := &strings.Builder{}
+	b.WriteString("#!/bin/sh\n")
+	// The OAuth client refreshes the token once it expires
+	for _, name := range []string{"alfred_workflow_data", "alfred_workflow_cache", "BASE_ID", "CLIENT_ID", "REDIRECT_URI", "MAX_AGE", "LOG_LEVEL", "LOG_FORMAT"} {
+		if value := os.Getenv(name); value != "" {
+			fmt.Fprintf(b, "export %s=%s\n", name, shellQuote(value))
+		}
+	}
+	b.WriteString("export mode=native-host\n")
+	fmt.Fprintf(b, "exec %s \"$@\"\n", shellQuote(binary))
+	return b.String()
+}
+
+// Write the script and the manifest of the host for a browser; returns the path of the manifest
+func installNativeHost(browser string, extensions []string, dir string) (string, error) {
+	binary, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	script := filepath.Join(os.Getenv("alfred_workflow_data"), "native-host.sh")
+	manifest, err := nativeManifest(browser, script, extensions)
+	if err != nil {
+		return "", err
+	}
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		relative, ok := nativeManifestDirs[runtime.GOOS][browser]
+		if !ok {
+			return "", fmt.Errorf("unknown manifest directory of %s on %s, set it with --dir", browser, runtime.GOOS)
+		}
+		dir = filepath.Join(home, relative)
+	}
+	if err = os.WriteFile(script, []byte(nativeHostScript(binary)), 0o755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, nativeHostName+".json")
+	if err = os.WriteFile(file, append(data, '\n'), 0o644); err != nil {
+		return "", err
+	}
+	logMessage("INFO", "Installed the native messaging host for %s: %s", browser, file)
+	return file, nil
+}
+
+func (a *Airtable) cliNativeHost(args []string, w io.Writer) error {
+	sub := ""
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+	if sub != "manifest" && sub != "install" {
+		return usagef("unknown native-host command: %q", sub)
+	}
+	fs := newFlagSet("native-host " + sub)
+	browser := fs.String("browser", "chrome", "")
+	dir := fs.String("dir", "", "")
+	var extensions stringList
+	fs.Var(&extensions, "extension", "")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usagef("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+	if len(extensions) == 0 {
+		return usagef("an extension ID is required")
+	}
+	if sub == "install" {
+		file, err := installNativeHost(*browser, extensions, *dir)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, file)
+		return nil
+	}
+	manifest, err := nativeManifest(*browser, filepath.Join(os.Getenv("alfred_workflow_data"), "native-host.sh"), extensions)
+	if err != nil {
+		return usageError{err.Error()}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(manifest)
+}
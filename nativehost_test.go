@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNativeMessage(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := writeNativeMessage(buf, map[string]string{"type": "tags"}); err != nil {
+		t.Fatal(err)
+	}
+	if size := binary.NativeEndian.Uint32(buf.Bytes()[:4]); int(size) != buf.Len()-4 {
+		t.Errorf("length prefix = %d, want %d", size, buf.Len()-4)
+	}
+	var req NativeRequest
+	if err := readNativeMessage(buf, &req); err != nil || req.Type != "tags" {
+		t.Errorf("readNativeMessage() = %+v, %v", req, err)
+	}
+}
+
+func TestNativeHost(t *testing.T) {
+	fake := &fakeAirtable{}
+	fake.set("Links", "recA0000000000000", map[string]any{"Name": "A", "URL": "https://a.com", "Note": "First", "Tags": []any{"go"}, "Done": false})
+	airtable := newTestAirtable(t, fake)
+	airtable.cache.lastSyncedAt = time.Now()
+	listID := "recL0000000000000"
+	_ = airtable.cache.saveLists([]List{{ID: &listID, Name: stringPtr("Reading"), LinkIDs: []string{"recA0000000000000"}}})
+	_ = airtable.cache.saveLinks([]Link{{ID: stringPtr("recA0000000000000"), Name: stringPtr("A"), URL: stringPtr("https://a.com"), Note: stringPtr("First"), Tags: []string{"go"}, ListIDs: []string{listID}}})
+	_ = airtable.cache.saveChoices("Tags", []Choice{{Name: "go"}, {Name: "golang"}, {Name: "Django"}, {Name: "rust"}})
+
+	in := &bytes.Buffer{}
+	for _, req := range []NativeRequest{
+		{ID: 1, Type: "lookup", URL: "https://b.com"},
+		{ID: 2, Type: "save", URL: "https://b.com", Title: "B", Note: "Selected", Tags: []string{"new"}, Lists: []string{listID}},
+		{ID: 3, Type: "save", URL: "https://A.com/", Note: "More", Tags: []string{"rust"}},
+		{ID: 4, Type: "lookup", URL: "https://a.com"},
+		{ID: 5, Type: "tags", Prefix: "GO"},
+		{ID: 6, Type: "delete"},
+	} {
+		_ = writeNativeMessage(in, req)
+	}
+	_ = binary.Write(in, binary.NativeEndian, uint32(1))
+	in.WriteString("{")
+	out := &bytes.Buffer{}
+	if err := airtable.nativeHost(in, out); err != nil {
+		t.Fatalf("nativeHost() error = %v", err)
+	}
+	responses := []NativeResponse{}
+	for out.Len() > 0 {
+		var resp NativeResponse
+		if err := readNativeMessage(out, &resp); err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, resp)
+	}
+	if len(responses) != 7 {
+		t.Fatalf("got %d responses, want 7", len(responses))
+	}
+
+	if r := responses[0]; !r.OK || r.Saved || r.ID != float64(1) {
+		t.Errorf("lookup of an unsaved page = %+v", r)
+	}
+	if r := responses[1]; !r.OK || !r.Created || r.Link == nil || *r.Link.Name != "B" || *r.Link.Note != "Selected" || len(r.Lists) != 1 || r.Lists[0].Name != "Reading" {
+		t.Errorf("save of a new page = %+v", r)
+	}
+	if !slices.Contains(airtable.cache.getChoiceNames("Tags"), "new") {
+		t.Error("the new tag is not cached")
+	}
+	if r := responses[2]; !r.OK || r.Created || r.Link == nil || *r.Link.Note != "First\n\nMore" || !slices.Equal(r.Link.Tags, []string{"go", "rust"}) {
+		t.Errorf("save of a saved page = %+v", r)
+	}
+	if r := responses[3]; !r.Saved || *r.Link.ID != "recA0000000000000" || len(r.Lists) != 1 {
+		t.Errorf("lookup of a saved page = %+v", r)
+	}
+	if r := responses[4]; !slices.Equal(r.Tags, []string{"go", "golang", "Django"}) {
+		t.Errorf("tags = %v, want [go golang Django]", r.Tags)
+	}
+	if r := responses[5]; r.OK || !strings.Contains(r.Error, "unknown message type") {
+		t.Errorf("unknown type = %+v", r)
+	}
+	if r := responses[6]; r.OK || r.Error == "" {
+		t.Errorf("invalid JSON = %+v", r)
+	}
+}
+
+func TestNativeManifest(t *testing.T) {
+	chrome, err := nativeManifest("chrome", "/data/native-host.sh", []string{"abcdef", "chrome-extension://ghijkl/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"chrome-extension://abcdef/", "chrome-extension://ghijkl/"}; !slices.Equal(chrome.AllowedOrigins, want) || chrome.AllowedExtensions != nil {
+		t.Errorf("chrome manifest = %+v", chrome)
+	}
+	firefox, err := nativeManifest("firefox", "/data/native-host.sh", []string{"airtable@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(firefox.AllowedExtensions, []string{"airtable@example.com"}) || firefox.AllowedOrigins != nil || firefox.Type != "stdio" {
+		t.Errorf("firefox manifest = %+v", firefox)
+	}
+	if _, err = nativeManifest("safari", "/data/native-host.sh", []string{"id"}); err == nil {
+		t.Error("safari manifest: want an error")
+	}
+
+	t.Setenv("alfred_workflow_data", "/data/it's here")
+	t.Setenv("BASE_ID", "app")
+	t.Setenv("CLIENT_ID", "client")
+	t.Setenv("REDIRECT_URI", "http://localhost:8080/callback")
+	script := nativeHostScript("/bin/airtable")
+	for _, line := range []string{`export alfred_workflow_data='/data/it'\''s here'`, "export CLIENT_ID='client'", "export REDIRECT_URI='http://localhost:8080/callback'", "export mode=native-host", `exec '/bin/airtable' "$@"`} {
+		if !strings.Contains(script, line+"\n") {
+			t.Errorf("script does not contain %q:\n%s", line, script)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Normalize URLs so that the same page saved with different
+// tracking parameters, fragments, "www." or trailing slashes is recognized
+
+type URLRules struct {
+	// Query parameters to remove; a trailing "*" matches a prefix
+	StripParams        []string `json:"stripParams"`
+	StripWWW           bool     `json:"stripWWW"`
+	StripFragment      bool     `json:"stripFragment"`
+	StripTrailingSlash bool     `json:"stripTrailingSlash"`
+	// Treat http and https as the same
+	IgnoreScheme bool                  `json:"ignoreScheme"`
+	Domains      map[string]DomainRule `json:"domains"`
+}
+
+type DomainRule struct {
+	// Other hosts of the same site, e.g. m.youtube.com
+	Aliases []string `json:"aliases,omitempty"`
+	// Only keep these query parameters
+	KeepParams []string `json:"keepParams,omitempty"`
+	// Short link hosts whose path is the value of a query parameter,
+	// e.g. youtu.be/ID is youtube.com/watch?v=ID
+	ShortHosts []string `json:"shortHosts,omitempty"`
+	ShortPath  string   `json:"shortPath,omitempty"`
+	ShortParam string   `json:"shortParam,omitempty"`
+}
+
+var defaultURLRules = URLRules{
+	StripParams: []string{
+		"utm_*", "fbclid", "gclid", "dclid", "msclkid", "yclid", "mc_cid", "mc_eid",
+		"_hsenc", "_hsmi", "igshid", "ref_src", "ref_url", "spm", "share_source", "from_source",
+	},
+	StripWWW:           true,
+	StripFragment:      true,
+	StripTrailingSlash: true,
+	IgnoreScheme:       true,
+	Domains: map[string]DomainRule{
+		"youtube.com": {
+			Aliases:    []string{"m.youtube.com", "music.youtube.com"},
+			KeepParams: []string{"v", "list"},
+			ShortHosts: []string{"youtu.be"},
+			ShortPath:  "/watch",
+			ShortParam: "v",
+		},
+		"twitter.com": {
+			Aliases:    []string{"x.com", "mobile.twitter.com", "mobile.x.com"},
+			KeepParams: []string{},
+		},
+		"bilibili.com": {
+			Aliases:    []string{"m.bilibili.com"},
+			KeepParams: []string{"p"},
+		},
+	},
+}
+
+var (
+	urlRules     *URLRules
+	urlRulesOnce sync.Once
+)
+
+// The rules are read from url_rules.json in the workflow data directory,
+// falling back to the defaults for the settings it leaves out
+func getURLRules() *URLRules {
+	urlRulesOnce.Do(func() {
+		rules := defaultURLRules
+		file := path.Join(os.Getenv("alfred_workflow_data"), "url_rules.json")
+		if data, err := os.ReadFile(file); err == nil {
+			if err := json.Unmarshal(data, &rules); err != nil {
+				logMessage("ERROR", "Invalid URL rules in %s: %s", file, err)
+				rules = defaultURLRules
+			}
+		}
+		urlRules = &rules
+	})
+	return urlRules
+}
+
+// A hash of the rules, to know when the normalized URLs must be recomputed
+func (r *URLRules) hash() string {
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+func (r *URLRules) stripParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range r.StripParams {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize a URL for comparison
+// Returns the URL unchanged if it cannot be parsed
+func (r *URLRules) normalize(URL string) string {
+	u, err := url.Parse(strings.TrimSpace(URL))
+	if err != nil || u.Host == "" {
+		return URL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if r.IgnoreScheme && u.Scheme == "http" {
+		u.Scheme = "https"
+	}
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	if r.StripWWW {
+		host = strings.TrimPrefix(host, "www.")
+	}
+	u.User = nil
+	query := u.Query()
+
+	// Domain rules
+	var rule *DomainRule
+	for domain, d := range r.Domains {
+		if host == domain || slices.Contains(d.Aliases, host) {
+			host = domain
+			rule = &d
+			break
+		}
+		if slices.Contains(d.ShortHosts, host) && d.ShortParam != "" {
+			if id := strings.Trim(u.Path, "/"); id != "" {
+				query.Set(d.ShortParam, id)
+				u.Path = d.ShortPath
+			}
+			host = domain
+			rule = &d
+			break
+		}
+	}
+	u.Host = host
+
+	for name := range query {
+		if r.stripParam(name) || (rule != nil && rule.KeepParams != nil && !slices.Contains(rule.KeepParams, name)) {
+			query.Del(name)
+		}
+	}
+	// Encode sorts the parameters by key
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+
+	if r.StripFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	if r.StripTrailingSlash {
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = ""
+	}
+	return u.String()
+}
+
+func normalizeURL(URL string) string {
+	return getURLRules().normalize(URL)
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/post", "https://example.com/post"},
+		{"http://www.Example.com/post/?utm_source=x&utm_medium=y#comments", "https://example.com/post"},
+		{"https://example.com/search?q=go&fbclid=abc&page=2", "https://example.com/search?page=2&q=go"},
+		{"https://example.com/", "https://example.com"},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=42s", "https://youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://youtu.be/dQw4w9WgXcQ?si=abc", "https://youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://m.youtube.com/watch?v=dQw4w9WgXcQ", "https://youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://x.com/user/status/1?s=20", "https://twitter.com/user/status/1"},
+		{"https://example.com:443/a", "https://example.com/a"},
+		{"not a url", "not a url"},
+	}
+	rules := defaultURLRules
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := rules.normalize(tt.url); got != tt.want {
+				t.Errorf("normalize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -356,3 +356,19 @@ func (a *Airtable) getAuth() error {
 	logMessage("INFO", "Got auth")
 	return nil
 }
+
+// Refresh the token of a process that outlives it, such as the server,
+// or that started without signing in
+func (a *Airtable) refreshAuth() error {
+	if a.auth == nil {
+		a.auth = &Auth{Token: &oauth2.Token{}}
+		a.auth.read(a.cache)
+	}
+	if a.auth.Valid() {
+		return nil
+	}
+	if !a.auth.refreshValid() {
+		return fmt.Errorf("signed out of Airtable, sign in again")
+	}
+	return a.getAuth()
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Markdown reading lists organized under headings
+// Each heading becomes a list, or a tag of the links of a single list,
+// and the lines nested under a link become its note
+//
+//	## Go
+//	- [Tour](https://go.dev/tour) - the basics
+//	  - Start with methods
+//	## Rust
+//	- [The Book](https://doc.rust-lang.org/book)
+
+type OutlineSection struct {
+	Name    string
+	Entries []LinkCopierEntry
+}
+
+var (
+	outlineHeadingRe = regexp.MustCompile(`^ {0,3}#{1,6}[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+	outlineFenceRe   = regexp.MustCompile("^ {0,3}(?:```|~~~)")
+)
+
+// Separators between a link and its description
+const outlineSeparators = " \t-–—:|"
+
+// The links of a text under each heading, in order
+// Links before the first heading are in a section without a name
+func parseOutline(text string) []OutlineSection {
+	sections := []OutlineSection{{}}
+	// The link taking the nested lines as its note, and the indent of its line
+	var note *LinkCopierEntry
+	indent, noteIndent := 0, -1
+	fence := false
+	for line := range strings.SplitSeq(strings.ReplaceAll(text, "\t", "    "), "\n") {
+		if outlineFenceRe.MatchString(line) {
+			fence = !fence
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if fence || trimmed == "" {
+			continue
+		}
+		lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+		if note != nil && lineIndent > indent {
+			if noteIndent < 0 {
+				noteIndent = lineIndent
+			}
+			text := strings.TrimRight(line[min(lineIndent, noteIndent):], " ")
+			if note.Note != "" {
+				text = note.Note + "\n" + text
+			}
+			note.Note = text
+			continue
+		}
+		note = nil
+		if m := outlineHeadingRe.FindStringSubmatch(line); m != nil {
+			sections = append(sections, OutlineSection{Name: headingText(m[1])})
+			continue
+		}
+
+		links := extractMDLinks(trimmed)
+		if len(links) == 0 {
+			continue
+		}
+		done := false
+		if m := lcCheckRe.FindStringSubmatch(trimmed); m != nil {
+			done = m[1] != " "
+		}
+		section := &sections[len(sections)-1]
+		for _, link := range links {
+			entry := LinkCopierEntry{Name: link.Title, URL: link.URL, Done: done}
+			if entry.Name == "" {
+				entry.Name = link.URL
+			}
+			if len(links) == 1 {
+				// The rest of the line describes the link
+				entry.Note = strings.Trim(lcIDRe.ReplaceAllString(link.Context, ""), outlineSeparators)
+			}
+			section.Entries = append(section.Entries, entry)
+		}
+		note = &section.Entries[len(section.Entries)-1]
+		indent, noteIndent = lineIndent, -1
+	}
+	return sections
+}
+
+// The text of a heading, with its links replaced by their text
+func headingText(s string) string {
+	text := ""
+	end := 0
+	for _, link := range extractMDLinks(s) {
+		if link.Kind != "bare" {
+			text += s[end:link.Start] + link.Title
+			end = link.End
+		}
+	}
+	return collapseSpaces(text + s[end:])
+}
+
+// The lists to save an outline to, in order: a list per heading, or a single list
+// named after the file with a tag per heading
+// Sections with the same name are merged, and links before the first heading
+// go to the list named after the file
+func outlineLists(sections []OutlineSection, name string, tags bool) []OutlineSection {
+	lists := []OutlineSection{}
+	for _, section := range sections {
+		listName := section.Name
+		entries := section.Entries
+		if tags {
+			listName = ""
+			entries = slices.Clone(entries)
+			if tag := strings.TrimSpace(strings.ReplaceAll(section.Name, ",", "")); tag != "" {
+				for i := range entries {
+					entries[i].Tags = []string{tag}
+				}
+			}
+		}
+		if listName == "" {
+			listName = name
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		if i := slices.IndexFunc(lists, func(l OutlineSection) bool { return strings.EqualFold(l.Name, listName) }); i >= 0 {
+			lists[i].Entries = append(lists[i].Entries, entries...)
+		} else {
+			lists = append(lists, OutlineSection{Name: listName, Entries: entries})
+		}
+	}
+	return lists
+}
+
+// What importing an outline does to a list
+type OutlinePlan struct {
+	OutlineSection
+	// The ID of the list, once it exists
+	ListID *string
+	New    bool
+	LinkCopierAppend
+}
+
+func (a *Airtable) planOutline(file string, tags bool) ([]OutlinePlan, error) {
+	text, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	sections := outlineLists(parseOutline(string(text)), name, tags)
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("no valid links found in file %s", file)
+	}
+	lists, err := a.cache.getLists(nil)
+	if err != nil {
+		return nil, err
+	}
+	all, err := a.cache.getLinks(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	plans := []OutlinePlan{}
+	for _, section := range sections {
+		plan := OutlinePlan{OutlineSection: section}
+		lc := LinkCopier{Entries: section.Entries}
+		if i := slices.IndexFunc(lists, func(l List) bool { return strings.EqualFold(*l.Name, section.Name) }); i >= 0 {
+			plan.ListID = lists[i].ID
+			appended, err := a.planAppend(lc, *plan.ListID, all)
+			if err != nil {
+				return nil, err
+			}
+			plan.LinkCopierAppend = *appended
+		} else {
+			plan.New = true
+			plan.LinkCopierAppend = planLinkCopierAppend(lc, nil, all)
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+func outlineSummary(plans []OutlinePlan) string {
+	total := LinkCopierAppend{}
+	newLists := 0
+	for _, plan := range plans {
+		if plan.New {
+			newLists++
+		}
+		total.Create = append(total.Create, plan.Create...)
+		total.Link = append(total.Link, plan.Link...)
+		total.Skipped += plan.Skipped
+	}
+	return fmt.Sprintf("%d new lists  ·  %s", newLists, total.summary())
+}
+
+// Create the lists of an outline and append the links to them
+// A link under several headings is created once and added to each list
+func (a *Airtable) importOutline(file string, tags bool) ([]OutlinePlan, error) {
+	plans, err := a.planOutline(file, tags)
+	if err != nil {
+		return nil, err
+	}
+	records := []*Record{}
+	for _, plan := range plans {
+		if plan.ListID == nil {
+			records = append(records, &Record{Fields: &map[string]any{"Name": plan.Name}})
+		}
+	}
+	if len(records) > 0 {
+		if err = a.createRecords("Lists", &records); err != nil {
+			return nil, err
+		}
+		lists := make([]List, len(records))
+		for i, record := range records {
+			lists[i] = *record.toList()
+		}
+		if err = a.cache.saveLists(lists); err != nil {
+			return nil, err
+		}
+		next := 0
+		for i := range plans {
+			if plans[i].ListID == nil {
+				plans[i].ListID = lists[next].ID
+				next++
+			}
+		}
+	}
+	for i, plan := range plans {
+		appended, err := a.appendEntries(*plan.ListID, LinkCopier{Entries: plan.Entries})
+		if err != nil {
+			return nil, err
+		}
+		plans[i].LinkCopierAppend = *appended
+	}
+	if tags {
+		if err = a.tagOutlineLinks(plans); err != nil {
+			return nil, err
+		}
+	}
+	logMessage("INFO", "Imported outline %s: %s", file, outlineSummary(plans))
+	return plans, nil
+}
+
+// Add the heading tags to the links of an outline that were saved before,
+// and to links under several headings, which are created with the tags of the first
+func (a *Airtable) tagOutlineLinks(plans []OutlinePlan) error {
+	tags := map[string][]string{}
+	for _, plan := range plans {
+		for _, entry := range plan.Entries {
+			key := normalizeURL(entry.URL)
+			tags[key] = unionStrings(tags[key], entry.Tags)
+		}
+	}
+	all, err := a.cache.getLinks(nil, nil)
+	if err != nil {
+		return err
+	}
+	// The entries were matched with the first saved link of each URL
+	seen := map[string]bool{}
+	_, err = a.updateLinks(all, func(link Link) map[string]any {
+		key := normalizeURL(*link.URL)
+		if seen[key] || len(tags[key]) == 0 {
+			return nil
+		}
+		seen[key] = true
+		merged := unionStrings(slices.Clone(link.Tags), tags[key])
+		if len(merged) == len(link.Tags) {
+			return nil
+		}
+		return map[string]any{"Tags": merged}
+	})
+	return err
+}
+
+// Preview the lists and links of an outline before importing it
+// cmd switches between a list and a tag per heading
+func (a *Airtable) previewOutline(file string, tags bool) {
+	wf := Workflow{}
+	plans, err := a.planOutline(file, tags)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+		wf.output()
+		return
+	}
+	title := fmt.Sprintf("Import %d Lists", len(plans))
+	switchTitle := "Tag links by heading instead"
+	if tags {
+		title = "Import Links Tagged by Heading"
+		switchTitle = "Make a list of each heading instead"
+	}
+	wf.addItem(Item{
+		Title:    title,
+		Subtitle: outlineSummary(plans),
+		Icon:     &Icon{Path: stringPtr("media/add.png")},
+		Variables: map[string]string{
+			"file": file,
+			"tags": fmt.Sprint(tags),
+			"exec": "import-outline",
+		},
+		Mods: &map[string]Mod{
+			"cmd": {
+				Subtitle: switchTitle,
+				Icon:     &Icon{Path: stringPtr("media/list.png")},
+				Variables: map[string]string{
+					"file": file,
+					"tags": fmt.Sprint(!tags),
+					"mode": "preview-outline",
+				},
+			},
+		},
+	})
+	for _, plan := range plans {
+		status := "Existing list"
+		if plan.New {
+			status = "New list"
+		}
+		wf.addItem(Item{
+			Title:    plan.Name,
+			Subtitle: fmt.Sprintf("%s  ·  %s", status, plan.summary()),
+			Icon:     &Icon{Path: stringPtr("media/list.png")},
+			Valid:    boolPtr(false),
+		})
+		for _, entry := range plan.Entries {
+			subtitle := []string{entry.URL}
+			if len(entry.Tags) > 0 {
+				subtitle = append(subtitle, "#"+strings.Join(entry.Tags, " #"))
+			}
+			if entry.Note != "" {
+				subtitle = append(subtitle, collapseSpaces(entry.Note))
+			}
+			wf.addItem(Item{
+				Title:        "    " + entry.Name,
+				Subtitle:     strings.Join(subtitle, "  ·  "),
+				QuickLookURL: stringPtr(entry.URL),
+				Icon:         &Icon{Path: stringPtr("media/link.png")},
+				Valid:        boolPtr(false),
+			})
+		}
+	}
+	wf.output()
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testOutline = `[Intro](https://intro.com)
+
+## [Go](https://go.dev) resources
+- [Tour](https://go.dev/tour) - the basics
+  - Start with methods
+    - then interfaces
+- [x] [Effective Go](https://go.dev/doc/effective_go)
+
+Some text about https://go.dev/blog and [Blog](https://go.dev/blog)
+
+` + "```" + `
+- [Not a link](https://code.com)
+` + "```" + `
+
+### Rust, mostly
+1. [The Book](https://doc.rust-lang.org/book) <!-- recXXXXXXXXXXXXXX -->
+	* Chapters 1–8
+
+## Go Resources
+- [Tour again](https://go.dev/tour/)
+`
+
+func TestParseOutline(t *testing.T) {
+	got := []string{}
+	for _, section := range parseOutline(testOutline) {
+		for _, e := range section.Entries {
+			got = append(got, fmt.Sprintf("%s|%s|%s|%v|%q", section.Name, e.Name, e.URL, e.Done, e.Note))
+		}
+	}
+	want := []string{
+		`|Intro|https://intro.com|false|""`,
+		`Go resources|Tour|https://go.dev/tour|false|"the basics\n- Start with methods\n  - then interfaces"`,
+		`Go resources|Effective Go|https://go.dev/doc/effective_go|true|""`,
+		`Go resources|https://go.dev/blog|https://go.dev/blog|false|""`,
+		`Go resources|Blog|https://go.dev/blog|false|""`,
+		`Rust, mostly|The Book|https://doc.rust-lang.org/book|false|"* Chapters 1–8"`,
+		`Go Resources|Tour again|https://go.dev/tour/|false|""`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseOutline()\n got %v\nwant %v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	lists := outlineLists(parseOutline(testOutline), "Notes", false)
+	names := []string{}
+	for _, list := range lists {
+		names = append(names, fmt.Sprintf("%s:%d", list.Name, len(list.Entries)))
+	}
+	if want := "Notes:1,Go resources:5,Rust, mostly:1"; strings.Join(names, ",") != want {
+		t.Errorf("outlineLists() = %v, want %s", names, want)
+	}
+	lists = outlineLists(parseOutline(testOutline), "Notes", true)
+	if len(lists) != 1 || lists[0].Name != "Notes" || len(lists[0].Entries) != 7 {
+		t.Fatalf("outlineLists() with tags = %+v, want a single list", lists)
+	}
+	tags := []string{}
+	for _, e := range lists[0].Entries {
+		tags = append(tags, strings.Join(e.Tags, ","))
+	}
+	if want := []string{"", "Go resources", "Go resources", "Go resources", "Go resources", "Rust mostly", "Go Resources"}; !slices.Equal(tags, want) {
+		t.Errorf("tags = %q, want %q", tags, want)
+	}
+}
+
+func TestImportOutline(t *testing.T) {
+	fake := &fakeAirtable{}
+	fake.set("Links", "recA0000000000000", map[string]any{"Name": "Tour", "URL": "https://go.dev/tour"})
+	fake.set("Lists", "recL0000000000000", map[string]any{"Name": "Notes"})
+	airtable := newTestAirtable(t, fake)
+	_ = airtable.cache.saveLists([]List{{ID: stringPtr("recL0000000000000"), Name: stringPtr("Notes")}})
+	_ = airtable.cache.saveLinks([]Link{{ID: stringPtr("recA0000000000000"), Name: stringPtr("Tour"), URL: stringPtr("https://go.dev/tour")}})
+
+	file := filepath.Join(t.TempDir(), "Notes.md")
+	if err := os.WriteFile(file, []byte(testOutline), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	plans, err := airtable.planOutline(file, false)
+	if err != nil {
+		t.Fatalf("planOutline() error = %v", err)
+	}
+	if got, want := outlineSummary(plans), "2 new lists  ·  4 added  ·  1 linked  ·  2 skipped"; got != want {
+		t.Errorf("planOutline() = %q, want %q", got, want)
+	}
+	if len(fake.records["Lists"]) != 1 {
+		t.Error("planOutline() created lists")
+	}
+
+	plans, err = airtable.importOutline(file, false)
+	if err != nil {
+		t.Fatalf("importOutline() error = %v", err)
+	}
+	if got, want := outlineSummary(plans), "2 new lists  ·  4 added  ·  1 linked  ·  2 skipped"; got != want {
+		t.Errorf("importOutline() = %q, want %q", got, want)
+	}
+	lists, _ := airtable.cache.getLists(nil)
+	for _, list := range lists {
+		links, _ := airtable.cache.getLinks(&List{ID: list.ID}, nil)
+		names := []string{}
+		for _, link := range links {
+			names = append(names, *link.Name)
+		}
+		slices.Sort(names)
+		got := strings.Join(names, ",")
+		want := map[string]string{
+			"Notes":        "Intro",
+			"Go resources": "Effective Go,Tour,https://go.dev/blog",
+			"Rust, mostly": "The Book",
+		}[*list.Name]
+		if got != want {
+			t.Errorf("list %s has %s, want %s", *list.Name, got, want)
+		}
+	}
+	for _, link := range fake.records["Links"] {
+		if link["Name"] == "The Book" && link["Note"] != "* Chapters 1–8" {
+			t.Errorf("note of The Book = %q", link["Note"])
+		}
+	}
+
+	// Importing again adds nothing
+	if plans, err = airtable.planOutline(file, false); err != nil || outlineSummary(plans) != "0 new lists  ·  0 added  ·  0 linked  ·  7 skipped" {
+		t.Errorf("planOutline() after the import = %s, %v", outlineSummary(plans), err)
+	}
+}
+
+func TestImportOutlineTags(t *testing.T) {
+	fake := &fakeAirtable{}
+	fake.set("Links", "recA0000000000000", map[string]any{"Name": "Tour", "URL": "https://go.dev/tour", "Tags": []any{"go"}})
+	airtable := newTestAirtable(t, fake)
+	_ = airtable.cache.saveLinks([]Link{{ID: stringPtr("recA0000000000000"), Name: stringPtr("Tour"), URL: stringPtr("https://go.dev/tour"), Tags: []string{"go"}}})
+
+	file := filepath.Join(t.TempDir(), "Notes.md")
+	if err := os.WriteFile(file, []byte(testOutline), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := airtable.importOutline(file, true); err != nil {
+		t.Fatalf("importOutline() error = %v", err)
+	}
+	// The saved link gets the tags of both of its headings
+	if got := fake.records["Links"]["recA0000000000000"]["Tags"]; fmt.Sprint(got) != "[go Go resources Go Resources]" {
+		t.Errorf("tags of the saved link = %v, want [go Go resources Go Resources]", got)
+	}
+	for _, link := range fake.records["Links"] {
+		if link["Name"] == "The Book" && fmt.Sprint(link["Tags"]) != "[Rust mostly]" {
+			t.Errorf("tags of The Book = %v, want [Rust mostly]", link["Tags"])
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Save a link with one line of input, e.g.
+//
+//	https://example.com Great article #rust #async /article @reading !done "some note"
+//
+// The URL may also be given as a markdown link, whose text becomes the title.
+// Categories and lists with spaces can be quoted: /"Long Read" @"To Read"
+type QuickAdd struct {
+	URL      string
+	Title    string
+	Note     string
+	Category string
+	Tags     []string
+	Lists    []string
+	Done     bool
+}
+
+// Split the input into words, keeping quoted parts (with their prefix) together
+func splitQuickAdd(input string) []string {
+	words := []string{}
+	var word strings.Builder
+	quoted := false
+	for _, r := range input {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			word.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+		default:
+			word.WriteRune(r)
+		}
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		return s[1 : len(s)-1]
+	}
+	return strings.TrimPrefix(s, `"`)
+}
+
+// Parse a line of quick-add input
+// Returns nil if there is no valid URL in it
+func parseQuickAdd(input string) *QuickAdd {
+	q := QuickAdd{}
+	titleWords := []string{}
+
+	// A markdown link gives both the URL and the title
+	input = strings.TrimSpace(input)
+	if links := extractMDLinks(input); len(links) > 0 && links[0].Kind != "bare" {
+		if prefix := input[:links[0].Start]; mdListMarkerRe.ReplaceAllString(prefix, "") == "" {
+			q.URL, q.Title = links[0].URL, links[0].Title
+			input = input[links[0].End:]
+		}
+	}
+
+	for _, word := range splitQuickAdd(input) {
+		switch {
+		case q.URL == "" && testURL(word):
+			q.URL = word
+		case len(word) > 1 && word[0] == '#':
+			if tag := word[1:]; !slices.Contains(q.Tags, tag) {
+				q.Tags = append(q.Tags, tag)
+			}
+		case len(word) > 1 && word[0] == '/':
+			q.Category = unquote(word[1:])
+		case len(word) > 1 && word[0] == '@':
+			if list := unquote(word[1:]); !slices.Contains(q.Lists, list) {
+				q.Lists = append(q.Lists, list)
+			}
+		case word == "!done":
+			q.Done = true
+		case len(word) > 1 && word[0] == '"':
+			q.Note = strings.TrimSpace(q.Note + " " + unquote(word))
+		default:
+			titleWords = append(titleWords, word)
+		}
+	}
+	if q.URL == "" {
+		return nil
+	}
+	if len(titleWords) > 0 {
+		q.Title = strings.TrimSpace(q.Title + " " + strings.Join(titleWords, " "))
+	}
+	return &q
+}
+
+// Show what a quick-add input will save
+func (a *Airtable) previewQuickAdd(q *QuickAdd) {
+	wf := Workflow{}
+	variables := map[string]string{
+		"ID":          "",
+		"URL":         q.URL,
+		"title":       q.Title,
+		"note":        q.Note,
+		"tags":        strings.Join(q.Tags, ","),
+		"category":    "",
+		"listIDs":     "",
+		"newLists":    "",
+		"newCategory": "",
+		"done":        fmt.Sprintf("%t", q.Done),
+	}
+	if q.Title == "" {
+		if meta := a.pageMeta(q.URL, &wf); meta != nil && meta.Title != nil {
+			variables["title"] = *meta.Title
+		}
+	}
+	title := variables["title"]
+	if title == "" {
+		title = q.URL
+	}
+
+	subParts := []string{}
+	warnings := []string{}
+	created := []string{}
+	if len(q.Tags) > 0 {
+		tags := []string{}
+		for _, tag := range q.Tags {
+			tags = append(tags, "􀆃"+tag)
+		}
+		subParts = append(subParts, strings.Join(tags, " "))
+	}
+
+	// Match the category and lists with the cached ones
+	var newCategory string
+	if q.Category != "" {
+		i := slices.IndexFunc(a.cache.getChoiceNames("Category"), func(c string) bool { return strings.EqualFold(c, q.Category) })
+		if i >= 0 {
+			variables["category"] = a.cache.getChoiceNames("Category")[i]
+			subParts = append(subParts, "􀈭 "+variables["category"])
+		} else {
+			newCategory = q.Category
+			warnings = append(warnings, "Unknown category: "+q.Category)
+			created = append(created, "/"+q.Category)
+		}
+	}
+	listIDs := []string{}
+	listNames := []string{}
+	newLists := []string{}
+	if len(q.Lists) > 0 {
+		lists, _ := a.cache.getLists(nil)
+		for _, name := range q.Lists {
+			i := slices.IndexFunc(lists, func(l List) bool { return strings.EqualFold(*l.Name, name) })
+			if i >= 0 {
+				listIDs = append(listIDs, *lists[i].ID)
+				listNames = append(listNames, *lists[i].Name)
+			} else {
+				newLists = append(newLists, name)
+				warnings = append(warnings, "Unknown list: "+name)
+				created = append(created, "@"+name)
+			}
+		}
+	}
+	if len(listNames) > 0 {
+		subParts = append(subParts, "􀈕 "+strings.Join(listNames, ", "))
+	}
+	variables["listIDs"] = strings.Join(listIDs, ",")
+	if q.Done {
+		subParts = append(subParts, "􀃲 Done")
+	}
+	if q.Note != "" {
+		subParts = append(subParts, "􀓕 "+q.Note)
+	}
+
+	item := Item{
+		Title:        "Save: " + title,
+		Subtitle:     strings.Join(subParts, "  ·  "),
+		QuickLookURL: &q.URL,
+		Icon:         &Icon{Path: stringPtr("media/save.png")},
+	}
+	item.setVars(variables)
+	item.setVar("exec", "save-link")
+	item.setVar("mode", "")
+
+	altMod := Mod{
+		Subtitle: "Edit record",
+		Icon:     &Icon{Path: stringPtr("media/edit.png")},
+	}
+	altMod.setVars(variables)
+	altMod.setVar("mode", "edit-link")
+	mods := map[string]Mod{"alt": altMod}
+	if len(created) > 0 {
+		cmdMod := Mod{
+			Subtitle: "Save and create " + strings.Join(created, " "),
+			Icon:     &Icon{Path: stringPtr("media/add.png")},
+		}
+		cmdMod.setVars(variables)
+		cmdMod.setVar("newCategory", newCategory)
+		cmdMod.setVar("newLists", strings.Join(newLists, ","))
+		cmdMod.setVar("exec", "save-link")
+		cmdMod.setVar("mode", "")
+		mods["cmd"] = cmdMod
+	}
+	item.Mods = &mods
+	wf.addItem(item)
+	for _, item := range a.duplicateItems(q.URL, nil) {
+		wf.addItem(item)
+	}
+
+	for _, warning := range warnings {
+		wf.addItem(Item{
+			Title:    warning,
+			Subtitle: "It will be skipped, hold ⌘ to create it when saving",
+			Valid:    boolPtr(false),
+			Icon:     alertIcon(),
+		})
+	}
+	wf.output()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQuickAdd(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  *QuickAdd
+	}{
+		{
+			"full",
+			`https://example.com Great article #rust #async /article @reading !done "some note"`,
+			&QuickAdd{
+				URL:      "https://example.com",
+				Title:    "Great article",
+				Note:     "some note",
+				Category: "article",
+				Tags:     []string{"rust", "async"},
+				Lists:    []string{"reading"},
+				Done:     true,
+			},
+		},
+		{
+			"markdown link",
+			`[Go Blog](https://go.dev/blog) #go @"To Read"`,
+			&QuickAdd{
+				URL:   "https://go.dev/blog",
+				Title: "Go Blog",
+				Tags:  []string{"go"},
+				Lists: []string{"To Read"},
+			},
+		},
+		{
+			"markdown link with parentheses",
+			"* [Rust](https://en.wikipedia.org/wiki/Rust_(programming_language)) #lang",
+			&QuickAdd{
+				URL:   "https://en.wikipedia.org/wiki/Rust_(programming_language)",
+				Title: "Rust",
+				Tags:  []string{"lang"},
+			},
+		},
+		{
+			"bare URL",
+			"https://example.com",
+			&QuickAdd{URL: "https://example.com"},
+		},
+		{"no URL", "just some words #tag", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseQuickAdd(tt.input)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseQuickAdd() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
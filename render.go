@@ -0,0 +1,475 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Every mode builds a Workflow: views with a primary action and the secondary actions
+// of their modifiers. Links and lists are built as views, other rows as Alfred items turned into views;
+// every renderer reads the views, Alfred's items are rendered from them.
+// A renderer prints the workflow for a front end, chosen with the renderer variable:
+// alfred (Script Filter JSON, the default), table, jsonl, raycast or rofi (script mode)
+
+type Renderer interface {
+	render(w io.Writer, wf *Workflow) error
+}
+
+var renderers = map[string]Renderer{
+	"alfred":  alfredRenderer{},
+	"table":   tableRenderer{},
+	"jsonl":   jsonlRenderer{},
+	"raycast": raycastRenderer{},
+	"rofi":    rofiRenderer{},
+}
+
+func currentRenderer() (Renderer, error) {
+	name := os.Getenv("renderer")
+	if name == "" {
+		name = "alfred"
+	}
+	r, ok := renderers[name]
+	if !ok {
+		return alfredRenderer{}, fmt.Errorf("unknown renderer: %s", name)
+	}
+	return r, nil
+}
+
+// The primary action of an item (without Mod) or the secondary action of a modifier
+type Action struct {
+	Mod       string            `json:"mod,omitempty"`
+	Subtitle  string            `json:"subtitle,omitempty"`
+	Arg       string            `json:"arg,omitempty"`
+	Valid     bool              `json:"valid"`
+	Icon      string            `json:"icon,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// A secondary action, valid like the primary one
+func modAction(mod string, subtitle string, icon string, variables map[string]string) Action {
+	return Action{Mod: mod, Subtitle: subtitle, Icon: icon, Valid: true, Variables: variables}
+}
+
+// The modifiers in the order of the secondary actions; others come after them, sorted
+var modOrder = []string{"cmd", "alt", "ctrl", "shift", "fn", "cmd+shift", "alt+shift", "ctrl+alt"}
+
+func compareMods(a, b string) int {
+	i, j := slices.Index(modOrder, a), slices.Index(modOrder, b)
+	if i < 0 {
+		i = len(modOrder)
+	}
+	if j < 0 {
+		j = len(modOrder)
+	}
+	if i != j {
+		return i - j
+	}
+	return strings.Compare(a, b)
+}
+
+// The actions of a view as Alfred runs them: the variables of the workflow apply to every action,
+// a secondary action without variables or arg keeps those of the primary action
+func (w *Workflow) actions(view View) []Action {
+	variables := func(vars map[string]string) map[string]string {
+		merged := maps.Clone(w.Variables)
+		if merged == nil {
+			merged = map[string]string{}
+		}
+		maps.Copy(merged, vars)
+		return merged
+	}
+	primary := view.Actions[0]
+	primary.Variables = variables(primary.Variables)
+	actions := []Action{primary}
+	for _, action := range slices.SortedFunc(slices.Values(view.Actions[1:]), func(a, b Action) int { return compareMods(a.Mod, b.Mod) }) {
+		if action.Arg == "" {
+			action.Arg = primary.Arg
+		}
+		if action.Variables == nil {
+			action.Variables = primary.Variables
+		} else {
+			action.Variables = variables(action.Variables)
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// What a front end shows of a row and what it can do with it, whatever the front end
+type View struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+	Icon     string `json:"icon,omitempty"`
+	// The page of the row, to preview
+	URL       string `json:"url,omitempty"`
+	Copy      string `json:"copy,omitempty"`
+	LargeType string `json:"largeType,omitempty"`
+	Match     string `json:"match,omitempty"`
+	// The text the row stands for, to act on (Alfred's Universal Actions)
+	Text         string  `json:"text,omitempty"`
+	AutoComplete *string `json:"autocomplete,omitempty"`
+	// The primary action, then the secondary actions of the modifiers
+	Actions []Action `json:"actions"`
+}
+
+func (v *View) setVar(name string, value string) {
+	if v.Actions[0].Variables == nil {
+		v.Actions[0].Variables = make(map[string]string)
+	}
+	v.Actions[0].Variables[name] = value
+}
+
+// Replace the secondary action of the same modifier, or add it
+func (v *View) setAction(action Action) {
+	if i := slices.IndexFunc(v.Actions[1:], func(a Action) bool { return a.Mod == action.Mod }); i >= 0 {
+		v.Actions[i+1] = action
+	} else {
+		v.Actions = append(v.Actions, action)
+	}
+}
+
+func (v *View) removeAction(mod string) {
+	v.Actions = slices.DeleteFunc(v.Actions, func(a Action) bool { return a.Mod != "" && a.Mod == mod })
+}
+
+// The Alfred item of a view; a row with a text is a file for Universal Actions
+// Secondary actions without variables keep those of the primary action
+func (v View) item() Item {
+	primary := v.Actions[0]
+	item := Item{
+		Title:        v.Title,
+		Subtitle:     v.Subtitle,
+		Arg:          primary.Arg,
+		AutoComplete: v.AutoComplete,
+		Variables:    primary.Variables,
+	}
+	if !primary.Valid {
+		item.Valid = boolPtr(false)
+	}
+	if v.Match != "" {
+		item.Match = stringPtr(v.Match)
+	}
+	if v.Icon != "" {
+		item.Icon = &Icon{Path: stringPtr(v.Icon)}
+	}
+	if v.URL != "" {
+		item.QuickLookURL = stringPtr(v.URL)
+	}
+	if v.Text != "" {
+		item.Type = stringPtr("file:skipcheck")
+		item.Action.Text = stringPtr(v.Text)
+	}
+	if v.Copy != "" {
+		item.Text.Copy = stringPtr(v.Copy)
+	}
+	if v.LargeType != "" {
+		item.Text.LargeType = stringPtr(v.LargeType)
+	}
+	if len(v.Actions) == 1 {
+		return item
+	}
+	mods := map[string]Mod{}
+	for _, action := range v.Actions[1:] {
+		mod := Mod{Subtitle: action.Subtitle, Arg: action.Arg, Variables: action.Variables}
+		if action.Valid != primary.Valid {
+			mod.Valid = boolPtr(action.Valid)
+		}
+		if action.Icon != "" {
+			mod.Icon = &Icon{Path: stringPtr(action.Icon)}
+		}
+		mods[action.Mod] = mod
+	}
+	item.Mods = &mods
+	return item
+}
+
+// The view of an item built for Alfred, with a modifier valid like the item unless it says otherwise
+func itemView(item Item) View {
+	view := View{Title: item.Title, Subtitle: item.Subtitle, AutoComplete: item.AutoComplete}
+	if item.Icon != nil && item.Icon.Path != nil {
+		view.Icon = *item.Icon.Path
+	}
+	if item.QuickLookURL != nil {
+		view.URL = *item.QuickLookURL
+	}
+	if item.Text.Copy != nil {
+		view.Copy = *item.Text.Copy
+	}
+	if item.Text.LargeType != nil {
+		view.LargeType = *item.Text.LargeType
+	}
+	if item.Match != nil {
+		view.Match = *item.Match
+	}
+	if item.Action.Text != nil {
+		view.Text = *item.Action.Text
+	}
+	primary := Action{Arg: item.Arg, Valid: item.Valid == nil || *item.Valid, Variables: item.Variables}
+	view.Actions = []Action{primary}
+	if item.Mods == nil {
+		return view
+	}
+	for _, key := range slices.SortedFunc(maps.Keys(*item.Mods), compareMods) {
+		mod := (*item.Mods)[key]
+		action := Action{Mod: key, Subtitle: mod.Subtitle, Arg: mod.Arg, Valid: primary.Valid, Variables: mod.Variables}
+		if mod.Icon != nil && mod.Icon.Path != nil {
+			action.Icon = *mod.Icon.Path
+		}
+		if mod.Valid != nil {
+			action.Valid = *mod.Valid
+		}
+		view.Actions = append(view.Actions, action)
+	}
+	return view
+}
+
+// Script Filter JSON: the items of the views
+type alfredOutput struct {
+	Items     []Item            `json:"items,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Rerun     *float64          `json:"rerun,omitempty"`
+}
+
+type alfredRenderer struct{}
+
+func (alfredRenderer) render(w io.Writer, wf *Workflow) error {
+	out := alfredOutput{Variables: wf.Variables, Rerun: wf.Rerun}
+	for _, view := range wf.Views {
+		out.Items = append(out.Items, view.item())
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// Views as rows of a table, each followed by its secondary actions
+type tableRenderer struct{}
+
+func (tableRenderer) render(w io.Writer, wf *Workflow) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, view := range wf.Views {
+		if view.Subtitle == "" {
+			fmt.Fprintln(tw, view.Title)
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\n", view.Title, view.Subtitle)
+		}
+		for _, action := range wf.actions(view)[1:] {
+			fmt.Fprintf(tw, "  [%s]\t%s\n", action.Mod, action.Subtitle)
+		}
+	}
+	return tw.Flush()
+}
+
+// A view per line, with the list of its actions
+type jsonlRenderer struct{}
+
+type jsonlItem struct {
+	Title    string   `json:"title"`
+	Subtitle string   `json:"subtitle,omitempty"`
+	URL      string   `json:"url,omitempty"`
+	Icon     string   `json:"icon,omitempty"`
+	Actions  []Action `json:"actions"`
+}
+
+func (jsonlRenderer) render(w io.Writer, wf *Workflow) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, view := range wf.Views {
+		line := jsonlItem{Title: view.Title, Subtitle: view.Subtitle, URL: view.URL, Icon: view.Icon, Actions: wf.actions(view)}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSON for a Raycast extension to show as a List: the primary action runs on Enter and the secondary
+// actions are in the action panel, with the keyboard shortcut of their modifier
+// Running an action means running the binary again with its variables, and its arg as the query
+// https://developers.raycast.com/api-reference/user-interface/list
+type raycastRenderer struct{}
+
+type raycastItem struct {
+	Title    string          `json:"title"`
+	Subtitle string          `json:"subtitle,omitempty"`
+	Icon     string          `json:"icon,omitempty"`
+	Keywords []string        `json:"keywords,omitempty"`
+	URL      string          `json:"url,omitempty"`
+	Copy     string          `json:"copy,omitempty"`
+	Detail   string          `json:"detail,omitempty"`
+	Actions  []raycastAction `json:"actions"`
+}
+
+type raycastAction struct {
+	Title     string            `json:"title"`
+	Icon      string            `json:"icon,omitempty"`
+	Shortcut  *raycastShortcut  `json:"shortcut,omitempty"`
+	Arg       string            `json:"arg,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+type raycastShortcut struct {
+	Modifiers []string `json:"modifiers"`
+	Key       string   `json:"key"`
+}
+
+// The shortcut of a modifier with Enter; Raycast has no fn modifier
+func raycastShortcutOf(mod string) *raycastShortcut {
+	modifiers := []string{}
+	for key := range strings.SplitSeq(mod, "+") {
+		switch key {
+		case "cmd", "ctrl", "shift":
+			modifiers = append(modifiers, key)
+		case "alt":
+			modifiers = append(modifiers, "opt")
+		default:
+			return nil
+		}
+	}
+	return &raycastShortcut{Modifiers: modifiers, Key: "return"}
+}
+
+func (raycastRenderer) render(w io.Writer, wf *Workflow) error {
+	items := []raycastItem{}
+	for _, view := range wf.Views {
+		item := raycastItem{Title: view.Title, Subtitle: view.Subtitle, Icon: view.Icon, URL: view.URL, Copy: view.Copy, Detail: view.LargeType, Actions: []raycastAction{}}
+		if view.Match != "" {
+			item.Keywords = strings.Fields(view.Match)
+		}
+		// Raycast has no disabled actions: invalid ones are left out
+		for _, action := range wf.actions(view) {
+			if !action.Valid {
+				continue
+			}
+			a := raycastAction{Title: action.Subtitle, Icon: action.Icon, Arg: action.Arg, Variables: action.Variables}
+			if action.Mod == "" {
+				a.Title = "Select"
+			} else {
+				a.Shortcut = raycastShortcutOf(action.Mod)
+			}
+			item.Actions = append(item.Actions, a)
+		}
+		items = append(items, item)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(map[string]any{"items": items})
+}
+
+// rofi script mode: rofi runs the binary again with the selected row (ROFI_RETV and ROFI_INFO)
+// The secondary actions are bound to kb-custom-N (Alt+N by default), in the order of modOrder,
+// and the variables set so far are kept in ROFI_DATA
+// https://davatorium.github.io/rofi/current/rofi-script.5/
+type rofiRenderer struct{}
+
+// The variables of the rofi session, restored by applyRofiSelection
+var rofiState map[string]string
+
+func rofiKey(mod string) int {
+	if i := slices.Index(modOrder, mod); i >= 0 {
+		return i + 1
+	}
+	return 0
+}
+
+func (rofiRenderer) render(w io.Writer, wf *Workflow) error {
+	state := maps.Clone(rofiState)
+	if state == nil {
+		state = map[string]string{}
+	}
+	maps.Copy(state, wf.Variables)
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "\x00prompt\x1fAirtable\n\x00use-hot-keys\x1ftrue\n\x00markup-rows\x1ftrue\n\x00data\x1f%s\n", data)
+	keys := []string{}
+	for _, view := range wf.Views {
+		for _, action := range view.Actions[1:] {
+			if key := rofiKey(action.Mod); key > 0 && !slices.Contains(keys, action.Mod) {
+				keys = append(keys, action.Mod)
+			}
+		}
+	}
+	if len(keys) > 0 {
+		slices.SortFunc(keys, compareMods)
+		hints := make([]string, len(keys))
+		for i, mod := range keys {
+			hints[i] = fmt.Sprintf("Alt+%d %s", rofiKey(mod)%10, mod)
+		}
+		fmt.Fprintf(b, "\x00message\x1f%s\n", html.EscapeString(strings.Join(hints, "  ·  ")))
+	}
+	for _, view := range wf.Views {
+		actions := wf.actions(view)
+		info, err := json.Marshal(actions)
+		if err != nil {
+			return err
+		}
+		text := html.EscapeString(view.Title)
+		if view.Subtitle != "" {
+			text += " <small>" + html.EscapeString(view.Subtitle) + "</small>"
+		}
+		fmt.Fprintf(b, "%s\x00info\x1f%s", strings.ReplaceAll(text, "\n", " "), info)
+		if view.Icon != "" {
+			fmt.Fprintf(b, "\x1ficon\x1f%s", view.Icon)
+		}
+		if !actions[0].Valid {
+			b.WriteString("\x1fnonselectable\x1ftrue")
+		}
+		b.WriteString("\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// When rofi runs the binary again, apply the selected action like Alfred does:
+// set its variables and pass its arg as the query, or pass the text entered
+func applyRofiSelection() {
+	retv, err := strconv.Atoi(os.Getenv("ROFI_RETV"))
+	if err != nil {
+		return
+	}
+	state := map[string]string{}
+	_ = json.Unmarshal([]byte(os.Getenv("ROFI_DATA")), &state)
+	input := ""
+	switch {
+	case retv == 1 || retv >= 10:
+		var actions []Action
+		_ = json.Unmarshal([]byte(os.Getenv("ROFI_INFO")), &actions)
+		mod := ""
+		if retv >= 10 {
+			mod = fmt.Sprintf("kb-custom-%d", retv-9)
+			if retv-10 < len(modOrder) {
+				mod = modOrder[retv-10]
+			}
+		}
+		i := slices.IndexFunc(actions, func(a Action) bool { return a.Mod == mod })
+		if i >= 0 && actions[i].Valid {
+			maps.Copy(state, actions[i].Variables)
+			// Actions that run a command end the session
+			if _, ok := actions[i].Variables["mode"]; !ok && actions[i].Variables["exec"] != "" {
+				state["mode"] = ""
+			}
+			input = actions[i].Arg
+		}
+	case retv == 2 && len(os.Args) > 1:
+		input = os.Args[1]
+	}
+	for key, value := range state {
+		_ = os.Setenv(key, value)
+	}
+	rofiState = state
+	os.Args = append(os.Args[:1], input)
+}
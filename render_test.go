@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testRenderWorkflow() *Workflow {
+	wf := &Workflow{}
+	wf.setVar("listID", "recL")
+	edit := modAction("alt", "Edit record", "", map[string]string{"mode": "edit-link", "ID": "recA"})
+	open := modAction("cmd", "Open", "", nil)
+	open.Valid = false
+	wf.addView(View{
+		Title:    "Go",
+		Subtitle: "https://go.dev",
+		Icon:     "media/link.png",
+		URL:      "https://go.dev",
+		Actions: []Action{
+			{Arg: "recA", Valid: true, Variables: map[string]string{"ID": "recA", "mode": "edit-link"}},
+			modAction("shift", "Copy", "", nil),
+			edit,
+			open,
+		},
+	})
+	// Other rows are built as Alfred items
+	wf.addItem(Item{Title: "No Links Found", Valid: boolPtr(false)})
+	return wf
+}
+
+func TestWorkflowActions(t *testing.T) {
+	wf := testRenderWorkflow()
+	actions := wf.actions(wf.Views[0])
+	mods := []string{}
+	for _, action := range actions {
+		mods = append(mods, action.Mod)
+	}
+	if got := strings.Join(mods, ","); got != ",cmd,alt,shift" {
+		t.Errorf("actions() = %s, want the primary action, then cmd, alt and shift", got)
+	}
+	if a := actions[0]; !a.Valid || a.Arg != "recA" || a.Variables["listID"] != "recL" || a.Variables["mode"] != "edit-link" {
+		t.Errorf("primary action = %+v", a)
+	}
+	if actions[1].Valid {
+		t.Error("cmd action is valid, want invalid")
+	}
+	// Modifiers without variables keep those of the item
+	if a := actions[3]; a.Arg != "recA" || a.Variables["ID"] != "recA" || a.Variables["listID"] != "recL" {
+		t.Errorf("shift action = %+v", a)
+	}
+	if wf.actions(wf.Views[1])[0].Valid {
+		t.Error("invalid item has a valid action")
+	}
+}
+
+func TestRenderers(t *testing.T) {
+	wf := testRenderWorkflow()
+	render := func(name string) string {
+		var b bytes.Buffer
+		if err := renderers[name].render(&b, wf); err != nil {
+			t.Fatalf("%s render() error = %v", name, err)
+		}
+		return b.String()
+	}
+
+	var alfred alfredOutput
+	if err := json.Unmarshal([]byte(render("alfred")), &alfred); err != nil || len(alfred.Items) != 2 || alfred.Variables["listID"] != "recL" {
+		t.Errorf("alfred render() = %+v, %v", alfred, err)
+	}
+
+	want := "Go         https://go.dev\n  [cmd]    Open\n  [alt]    Edit record\n  [shift]  Copy\nNo Links Found\n"
+	if got := render("table"); got != want {
+		t.Errorf("table render() = %q, want %q", got, want)
+	}
+
+	lines := strings.Split(strings.TrimSpace(render("jsonl")), "\n")
+	var item jsonlItem
+	if err := json.Unmarshal([]byte(lines[0]), &item); err != nil || len(lines) != 2 {
+		t.Fatalf("jsonl render() = %v, %v", lines, err)
+	}
+	if item.URL != "https://go.dev" || item.Icon != "media/link.png" || len(item.Actions) != 4 {
+		t.Errorf("jsonl item = %+v", item)
+	}
+
+	var raycast struct {
+		Items []raycastItem `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(render("raycast")), &raycast); err != nil || len(raycast.Items) != 2 {
+		t.Fatalf("raycast render() = %+v, %v", raycast, err)
+	}
+	// The invalid cmd action is left out, alt is opt in Raycast
+	if item := raycast.Items[0]; item.URL != "https://go.dev" || len(item.Actions) != 3 || item.Actions[0].Shortcut != nil ||
+		item.Actions[1].Title != "Edit record" || fmt.Sprint(item.Actions[1].Shortcut.Modifiers) != "[opt]" || item.Actions[1].Icon != "" {
+		t.Errorf("raycast item = %+v", item)
+	}
+	if actions := raycast.Items[1].Actions; len(actions) != 0 {
+		t.Errorf("raycast actions of an invalid item = %+v, want none", actions)
+	}
+
+	rofi := render("rofi")
+	for _, want := range []string{
+		"\x00data\x1f{\"listID\":\"recL\"}\n",
+		"\x00message\x1fAlt+1 cmd  ·  Alt+2 alt  ·  Alt+4 shift\n",
+		"Go <small>https://go.dev</small>\x00info\x1f[{",
+		"\x1ficon\x1fmedia/link.png\n",
+		"No Links Found\x00info\x1f[{\"valid\":false,\"variables\":{\"listID\":\"recL\"}}]\x1fnonselectable\x1ftrue\n",
+	} {
+		if !strings.Contains(rofi, want) {
+			t.Errorf("rofi render() = %q, want it to contain %q", rofi, want)
+		}
+	}
+}
+
+func TestViewItem(t *testing.T) {
+	link := Link{ID: stringPtr("recA"), Name: stringPtr("Go"), URL: stringPtr("https://go.dev"), RecordURL: stringPtr("https://airtable.com/recA")}
+	view := link.view()
+	item := view.item()
+	if item.Arg != "[Go](https://go.dev)" || item.Action.Text == nil || *item.Action.Text != item.Arg || *item.QuickLookURL != "https://go.dev" || item.Valid != nil {
+		t.Errorf("item() = %+v", item)
+	}
+	if mod := (*item.Mods)["cmd"]; mod.Subtitle != "Mark as done 􀃲 " || *mod.Icon.Path != "media/checked.png" || mod.Valid != nil {
+		t.Errorf("cmd mod = %+v", mod)
+	}
+	// An item built for Alfred is the view it was rendered from
+	got := itemView(item)
+	if got.Title != view.Title || got.URL != view.URL || got.Match != view.Match || got.Text != view.Text || len(got.Actions) != len(view.Actions) {
+		t.Errorf("itemView() = %+v, want %+v", got, view)
+	}
+}
+
+func TestApplyRofiSelection(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args; rofiState = nil }()
+	wf := testRenderWorkflow()
+	info, _ := json.Marshal(wf.actions(wf.Views[0]))
+
+	// Alt+2 runs the alt action
+	t.Setenv("ROFI_RETV", "11")
+	t.Setenv("ROFI_INFO", string(info))
+	t.Setenv("ROFI_DATA", `{"listID":"recL","mode":"list-links"}`)
+	t.Setenv("mode", "")
+	t.Setenv("ID", "")
+	t.Setenv("exec", "")
+	os.Args = []string{"airtable", "Go"}
+	applyRofiSelection()
+	if os.Getenv("mode") != "edit-link" || os.Getenv("ID") != "recA" || os.Getenv("listID") != "recL" || os.Args[1] != "recA" {
+		t.Errorf("mode = %s, ID = %s, args = %v", os.Getenv("mode"), os.Getenv("ID"), os.Args)
+	}
+
+	// An action running a command ends the rofi session
+	info, _ = json.Marshal([]Action{{Valid: true, Variables: map[string]string{"exec": "save-link"}}})
+	t.Setenv("ROFI_RETV", "1")
+	t.Setenv("ROFI_INFO", string(info))
+	applyRofiSelection()
+	if os.Getenv("mode") != "" || os.Getenv("exec") != "save-link" {
+		t.Errorf("mode = %q, exec = %q, want the exec mode", os.Getenv("mode"), os.Getenv("exec"))
+	}
+
+	// Entered text is the query of the mode kept in ROFI_DATA
+	t.Setenv("ROFI_RETV", "2")
+	os.Args = []string{"airtable", "new list"}
+	applyRofiSelection()
+	if os.Getenv("mode") != "list-links" || os.Args[1] != "new list" {
+		t.Errorf("mode = %s, args = %v", os.Getenv("mode"), os.Args)
+	}
+}
+
+// A background job started from a rofi session must not run the selected row again
+func TestBackgroundEnv(t *testing.T) {
+	t.Setenv("ROFI_RETV", "1")
+	t.Setenv("ROFI_INFO", `[{"valid":true,"variables":{"mode":"list-lists"}}]`)
+	t.Setenv("ROFI_DATA", "{}")
+	t.Setenv("renderer", "rofi")
+	t.Setenv("BASE_ID", "app")
+	env := backgroundEnv("mode=sync")
+	for _, v := range env {
+		if strings.HasPrefix(v, "ROFI_") || strings.HasPrefix(v, "renderer=") {
+			t.Errorf("backgroundEnv() has %s", v)
+		}
+	}
+	if !slices.Contains(env, "mode=sync") || !slices.Contains(env, "BASE_ID=app") {
+		t.Errorf("backgroundEnv() = %v, want mode=sync and BASE_ID=app", env)
+	}
+}
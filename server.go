@@ -0,0 +1,343 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// A local HTTP API for other tools, such as bookmarklets, scripts and editor plugins:
+//
+//	GET    /links             search links: q, tag, category, domain, list, done, url
+//	POST   /links             add a link: {"URL": ..., "Name", "Note", "Tags", "Category", "Lists"}
+//	GET    /links/{id}        a link
+//	POST   /links/{id}/done   mark a link as done (DELETE to undo)
+//	GET    /lists             the lists
+//	GET    /lists/{id}        a list with its links in order
+//	POST   /sync              sync in the background, ?force=true to sync all records
+//
+// Configured with environment variables:
+//
+//	SERVE_ADDR      address to listen on, on the loopback interface (default 127.0.0.1:8765)
+//	SERVE_TOKEN     token expected as "Authorization: Bearer <token>" (default a generated token, kept in the cache)
+//	SERVE_ORIGINS   origins allowed to call the API from a browser, separated by commas
+//
+// Reads come from the cache, which is synced in the background once it is older than MAX_AGE,
+// so they work offline; writes go through the rate limiter of the API and fail with 503 when Airtable is unreachable
+
+const defaultServeAddr = "127.0.0.1:8765"
+
+type Server struct {
+	airtable *Airtable
+	token    string
+	origins  []string
+	// The cache is not safe for concurrent use: requests and syncs take turns
+	mu      sync.Mutex
+	syncing atomic.Bool
+}
+
+func newServer(a *Airtable) (*Server, error) {
+	token := os.Getenv("SERVE_TOKEN")
+	if token == "" {
+		if saved, err := a.cache.getData("ServeToken"); err == nil && *saved != "" {
+			token = *saved
+		} else {
+			if token, err = randomString(24); err != nil {
+				return nil, err
+			}
+			if err = a.cache.setData("ServeToken", token); err != nil {
+				return nil, err
+			}
+		}
+	}
+	origins := []string{}
+	for origin := range strings.SplitSeq(os.Getenv("SERVE_ORIGINS"), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return &Server{airtable: a, token: token, origins: origins}, nil
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /links", s.searchLinks)
+	mux.HandleFunc("POST /links", s.addLink)
+	mux.HandleFunc("GET /links/{id}", s.getLink)
+	mux.HandleFunc("POST /links/{id}/done", s.markDone)
+	mux.HandleFunc("DELETE /links/{id}/done", s.markDone)
+	mux.HandleFunc("GET /lists", s.getLists)
+	mux.HandleFunc("GET /lists/{id}", s.getList)
+	mux.HandleFunc("POST /sync", s.sync)
+	return s.cors(s.authenticate(s.serialize(mux)))
+}
+
+func (s *Server) serialize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Only the configured origins may call the API from a browser; preflight requests need no token
+func (s *Server) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !slices.Contains(s.origins, origin) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "origin not allowed: " + origin})
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(v)
+}
+
+// Write an error with the status it calls for, or the fallback status
+func writeError(w http.ResponseWriter, err error, fallback int) {
+	status := fallback
+	var urlErr *url.Error
+	switch {
+	case errors.Is(err, errNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errLinkSaved):
+		status = http.StatusConflict
+	case errors.As(err, &urlErr):
+		status = http.StatusServiceUnavailable
+		err = fmt.Errorf("Airtable is unreachable: %w", err)
+	}
+	logMessage("WARN", "Request failed: %v", err)
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// Sync in the background, unless a sync is running; returns whether a sync started
+func (s *Server) syncInBackground(force bool) bool {
+	if !s.syncing.CompareAndSwap(false, true) {
+		return false
+	}
+	go func() {
+		defer s.syncing.Store(false)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		err := s.airtable.refreshAuth()
+		if err == nil {
+			err = s.airtable.syncData(force)
+		}
+		if err != nil {
+			logMessage("ERROR", "Failed to sync: %v", err)
+		}
+	}()
+	return true
+}
+
+func (s *Server) searchLinks(w http.ResponseWriter, r *http.Request) {
+	// Once the cached links are served
+	defer s.syncInBackground(false)
+	params := r.URL.Query()
+	query := LinkQuery{
+		Tag:      params.Get("tag"),
+		Category: params.Get("category"),
+		Domain:   params.Get("domain"),
+		ListID:   params.Get("list"),
+		Query:    params.Get("q"),
+	}
+	if done := params.Get("done"); done != "" {
+		value, err := strconv.ParseBool(done)
+		if err != nil {
+			writeError(w, fmt.Errorf("invalid done: %s", done), http.StatusBadRequest)
+			return
+		}
+		query.Done = &value
+	}
+	var links []Link
+	var err error
+	if URL := params.Get("url"); URL != "" {
+		links, err = s.airtable.cache.getLinksByURL(URL)
+	} else {
+		links, err = s.airtable.cache.getLinks(nil, nil)
+	}
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	links = query.filter(links)
+	if links == nil {
+		links = []Link{}
+	}
+	writeJSON(w, http.StatusOK, links)
+}
+
+func (s *Server) link(id string) (*Link, error) {
+	links, err := s.airtable.cache.getLinksByIDs([]string{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("link %s %w", id, errNotFound)
+	}
+	return &links[0], nil
+}
+
+func (s *Server) getLink(w http.ResponseWriter, r *http.Request) {
+	link, err := s.link(r.PathValue("id"))
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, link)
+}
+
+func (s *Server) addLink(w http.ResponseWriter, r *http.Request) {
+	var body Link
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
+		writeError(w, fmt.Errorf("invalid body: %w", err), http.StatusBadRequest)
+		return
+	}
+	if body.URL == nil || !testURL(*body.URL) {
+		writeError(w, fmt.Errorf("a valid URL is required"), http.StatusBadRequest)
+		return
+	}
+	link := Link{URL: body.URL, Name: body.Name, Note: body.Note, Category: body.Category, Tags: body.Tags, ListIDs: body.ListIDs}
+	err := s.airtable.refreshAuth()
+	if err == nil {
+		err = s.airtable.addLink(&link)
+	}
+	if err != nil {
+		writeError(w, err, http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusCreated, link)
+}
+
+func (s *Server) markDone(w http.ResponseWriter, r *http.Request) {
+	link, err := s.link(r.PathValue("id"))
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	action := "done"
+	if r.Method == http.MethodDelete {
+		action = "undone"
+	}
+	err = s.airtable.refreshAuth()
+	if err == nil {
+		_, err = s.airtable.bulkUpdate([]Link{*link}, action, "")
+	}
+	if err == nil {
+		link, err = s.link(*link.ID)
+	}
+	if err != nil {
+		writeError(w, err, http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, link)
+}
+
+func (s *Server) getLists(w http.ResponseWriter, r *http.Request) {
+	defer s.syncInBackground(false)
+	lists, err := s.airtable.cache.getLists(nil)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if lists == nil {
+		lists = []List{}
+	}
+	writeJSON(w, http.StatusOK, lists)
+}
+
+func (s *Server) getList(w http.ResponseWriter, r *http.Request) {
+	list, links, err := s.airtable.listWithLinks(r.PathValue("id"))
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		List
+		Links []Link `json:"Links"`
+	}{list, links})
+}
+
+func (s *Server) sync(w http.ResponseWriter, r *http.Request) {
+	started := s.syncInBackground(r.URL.Query().Get("force") == "true")
+	writeJSON(w, http.StatusAccepted, map[string]bool{"started": started})
+}
+
+// Listen on a loopback address until interrupted
+func (a *Airtable) serve(addr string, w io.Writer) error {
+	addr = cmp.Or(addr, os.Getenv("SERVE_ADDR"), defaultServeAddr)
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("not a loopback address: %s", addr)
+	}
+	s, err := newServer(a)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Addr: addr, Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errc := make(chan error, 1)
+	go func() { errc <- server.ListenAndServe() }()
+	logMessage("INFO", "Serving on http://%s", addr)
+	fmt.Fprintf(w, "Serving on http://%s\nToken: %s\n", addr, s.token)
+	select {
+	case err = <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	fake := &fakeAirtable{}
+	fake.set("Links", "recA0000000000000", map[string]any{"Name": "A", "URL": "https://a.com", "Done": false})
+	api := fake.serve(t)
+	defer api.Close()
+	airtable := testAirtableAt(t, api.URL)
+	airtable.cache.lastSyncedAt = time.Now()
+	listID := "recL0000000000000"
+	_ = airtable.cache.saveLists([]List{{ID: &listID, Name: stringPtr("Reading"), LinkIDs: []string{"recA0000000000000"}}})
+	_ = airtable.cache.saveLinks([]Link{
+		{ID: stringPtr("recA0000000000000"), Name: stringPtr("A"), URL: stringPtr("https://a.com"), Tags: []string{"go"}, ListIDs: []string{listID}},
+		{ID: stringPtr("recB0000000000000"), Name: stringPtr("B"), URL: stringPtr("https://b.com"), Tags: []string{"rust"}},
+	})
+
+	t.Setenv("SERVE_TOKEN", "secret")
+	t.Setenv("SERVE_ORIGINS", "https://allowed.example, chrome-extension://abc/")
+	s, err := newServer(airtable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	request := func(method, path, body string, header map[string]string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	decode := func(resp *http.Response, v any) {
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if resp := request("GET", "/links", "", map[string]string{"Authorization": "Bearer wrong"}); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong token: status = %d, want 401", resp.StatusCode)
+	}
+	if resp := request("GET", "/links", "", map[string]string{"Origin": "https://evil.example"}); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unknown origin: status = %d, want 403", resp.StatusCode)
+	}
+	resp := request("OPTIONS", "/links", "", map[string]string{"Origin": "chrome-extension://abc", "Authorization": ""})
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "chrome-extension://abc" {
+		t.Errorf("preflight: status = %d, headers = %v", resp.StatusCode, resp.Header)
+	}
+
+	var links []Link
+	decode(request("GET", "/links?tag=go", "", nil), &links)
+	if len(links) != 1 || *links[0].ID != "recA0000000000000" {
+		t.Errorf("GET /links?tag=go = %v", links)
+	}
+	decode(request("GET", "/links?url=https://B.com/", "", nil), &links)
+	if len(links) != 1 || *links[0].ID != "recB0000000000000" {
+		t.Errorf("GET /links?url = %v", links)
+	}
+
+	resp = request("POST", "/links", `{"URL": "https://c.com", "Name": "C", "Tags": ["go"], "Lists": ["recL0000000000000"]}`, nil)
+	var link Link
+	decode(resp, &link)
+	if resp.StatusCode != http.StatusCreated || link.ID == nil || *link.Name != "C" {
+		t.Fatalf("POST /links: status = %d, link = %+v", resp.StatusCode, link)
+	}
+	if cached, _ := airtable.cache.getLinkByURL("https://c.com"); cached == nil {
+		t.Error("the new link is not cached")
+	}
+	if resp = request("POST", "/links", `{"URL": "https://c.com", "Name": "C"}`, nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("POST /links again: status = %d, want 409", resp.StatusCode)
+	}
+	if resp = request("POST", "/links", `{"URL": "not a url"}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /links with an invalid URL: status = %d, want 400", resp.StatusCode)
+	}
+
+	decode(request("POST", "/links/recA0000000000000/done", "", nil), &link)
+	if !link.Done {
+		t.Error("POST /links/{id}/done: link is not done")
+	}
+	if resp = request("POST", "/links/recZ0000000000000/done", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("POST /links/{id}/done for an unknown link: status = %d, want 404", resp.StatusCode)
+	}
+
+	var list struct {
+		Name  string
+		Links []Link
+	}
+	decode(request("GET", "/lists/recL0000000000000", "", nil), &list)
+	if list.Name != "Reading" || len(list.Links) != 1 {
+		t.Errorf("GET /lists/{id} = %+v", list)
+	}
+	if resp = request("GET", "/lists/recZ0000000000000", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /lists/{id} for an unknown list: status = %d, want 404", resp.StatusCode)
+	}
+
+	// Offline, reads still work and writes fail with 503
+	api.Close()
+	if resp = request("GET", "/lists", "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /lists offline: status = %d, want 200", resp.StatusCode)
+	}
+	if resp = request("POST", "/links", `{"URL": "https://d.com", "Name": "D"}`, nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("POST /links offline: status = %d, want 503", resp.StatusCode)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Export a list through a text/template
+// Templates are files in the templates directory of the workflow data, e.g. slack.tmpl
+// An extension before .tmpl is the extension of the exported file, e.g. newsletter.html.tmpl
+// A template receives the list as .List and its links, in the order of the list, as .Links
+
+// Built-in templates, which files with the same name replace
+var builtinTemplates = map[string]string{
+	"markdown.md": `# {{.List.Name}}
+{{with .List.Note}}
+{{.}}
+{{end}}
+{{range .Links}}- [{{if .Done}}x{{else}} {{end}}] [{{.Name}}]({{.URL}})
+{{end}}`,
+	"org.org": `* {{.List.Name}}
+{{range .Links}}** {{if .Done}}DONE{{else}}TODO{{end}} [[{{.URL}}][{{.Name}}]]{{with .Tags}} :{{join . ":"}}:{{end}}
+{{end}}`,
+	"slack.txt": `*{{.List.Name}}*
+{{range .Links}}• <{{.URL}}|{{.Name}}>{{if .Done}} ✓{{end}}
+{{end}}`,
+	"html.html": `<h2>{{html .List.Name}}</h2>
+<ul>
+{{range .Links}}  <li><a href="{{html .URL}}">{{html .Name}}</a>{{with .Note}} — {{html .}}{{end}}</li>
+{{end}}</ul>
+`,
+}
+
+type ExportTemplate struct {
+	Name string
+	Ext  string
+	// The template file, nil for built-in templates
+	File *string
+	Text string
+}
+
+type TemplateData struct {
+	List  List
+	Links []Link
+}
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"date": func(layout string, t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Local().Format(layout)
+	},
+}
+
+func templateDir() string {
+	return path.Join(os.Getenv("alfred_workflow_data"), "templates")
+}
+
+// Split a template file name into its name and the extension of the output
+func templateName(file string) (string, string) {
+	name := strings.TrimSuffix(path.Base(file), ".tmpl")
+	if i := strings.Index(name, "."); i > 0 {
+		return name[:i], name[i:]
+	}
+	return name, ".txt"
+}
+
+// The built-in templates and those of the templates directory, sorted by name
+func loadTemplates() ([]ExportTemplate, error) {
+	templates := map[string]ExportTemplate{}
+	for file, text := range builtinTemplates {
+		name, ext := templateName(file)
+		templates[name] = ExportTemplate{Name: name, Ext: ext, Text: text}
+	}
+	entries, err := os.ReadDir(templateDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tmpl") {
+			continue
+		}
+		file := path.Join(templateDir(), entry.Name())
+		text, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		name, ext := templateName(file)
+		templates[name] = ExportTemplate{Name: name, Ext: ext, File: &file, Text: string(text)}
+	}
+	list := []ExportTemplate{}
+	for _, t := range templates {
+		list = append(list, t)
+	}
+	slices.SortFunc(list, func(a, b ExportTemplate) int { return strings.Compare(a.Name, b.Name) })
+	return list, nil
+}
+
+func findTemplate(name string) (*ExportTemplate, error) {
+	templates, err := loadTemplates()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range templates {
+		if t.Name == name {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("template not found: %s", name)
+}
+
+func (t *ExportTemplate) render(data TemplateData) (string, error) {
+	tmpl, err := template.New(t.Name).Funcs(templateFuncs).Option("missingkey=zero").Parse(t.Text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// The list and its links in the order of the list
+func (a *Airtable) templateData(listID string) (*TemplateData, error) {
+	lists, err := a.cache.getLists(nil)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(lists, func(l List) bool { return *l.ID == listID })
+	if i < 0 {
+		return nil, fmt.Errorf("list %s not found", listID)
+	}
+	links, err := a.cache.getLinks(&List{ID: &listID}, nil)
+	if err != nil {
+		return nil, err
+	}
+	order, err := a.cache.getLinkOrder(listID)
+	if err != nil {
+		return nil, err
+	}
+	sortByOrder(links, order)
+	return &TemplateData{List: lists[i], Links: links}, nil
+}
+
+// Render a list with a template, to a file, or to stdout if file is "-"
+// Without a file, the list is written to the exports directory of the workflow data
+// Returns the file written
+func (a *Airtable) exportList(listID string, name string, file string) (string, error) {
+	t, err := findTemplate(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := a.templateData(listID)
+	if err != nil {
+		return "", err
+	}
+	text, err := t.render(*data)
+	if err != nil {
+		return "", err
+	}
+	if file == "-" {
+		_, err = fmt.Print(text)
+		return file, err
+	}
+	if file == "" {
+		dir := path.Join(os.Getenv("alfred_workflow_data"), "exports")
+		if err = os.MkdirAll(dir, 0o755); err != nil {
+			return "", err
+		}
+		file = path.Join(dir, strings.ReplaceAll(*data.List.Name, "/", "-")+t.Ext)
+	}
+	logMessage("INFO", "Exporting list %s with template %s to %s", *data.List.Name, t.Name, file)
+	return file, os.WriteFile(file, []byte(text), 0o644)
+}
+
+// Pick a template to export a list with
+// The export is copied to the clipboard, or saved to a file with cmd
+func (a *Airtable) listTemplates(listID string) {
+	wf := Workflow{}
+	templates, err := loadTemplates()
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+		wf.output()
+		return
+	}
+	data, err := a.templateData(listID)
+	if err != nil {
+		wf.warnEmpty("Error: " + err.Error())
+		wf.output()
+		return
+	}
+	for _, t := range templates {
+		subtitle := "Built-in template"
+		if t.File != nil {
+			subtitle = *t.File
+		}
+		item := Item{
+			Title:    t.Name,
+			Subtitle: subtitle,
+			Match:    stringPtr(t.Name),
+			Icon:     &Icon{Path: stringPtr("media/clip.png")},
+			Variables: map[string]string{
+				"listID":   listID,
+				"template": t.Name,
+				"file":     "-",
+				"exec":     "export-list",
+			},
+			Mods: &map[string]Mod{
+				"cmd": {
+					Subtitle: "Save to file",
+					Icon:     &Icon{Path: stringPtr("media/save.png")},
+					Variables: map[string]string{
+						"listID":   listID,
+						"template": t.Name,
+						"file":     "",
+						"exec":     "export-list",
+					},
+				},
+			},
+		}
+		if text, err := t.render(*data); err != nil {
+			item.Subtitle = "Error: " + err.Error()
+			item.Valid = boolPtr(false)
+		} else {
+			item.Text.LargeType = &text
+			item.Text.Copy = &text
+		}
+		if t.File != nil {
+			(*item.Mods)["alt"] = Mod{
+				Subtitle: "Edit template",
+				Arg:      *t.File,
+				Icon:     &Icon{Path: stringPtr("media/edit.png")},
+				Variables: map[string]string{
+					"URL": *t.File,
+				},
+			}
+		}
+		wf.addItem(item)
+	}
+	wf.output()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testTemplateCache(t *testing.T) *Airtable {
+	airtable := &Airtable{cache: &Cache{file: ":memory:"}}
+	if err := airtable.cache.init(); err != nil {
+		t.Fatalf("init() error = %v", err)
+	}
+	_ = airtable.cache.saveLists([]List{{ID: stringPtr("recL"), Name: stringPtr("Reading"), Note: stringPtr("For the weekend"), LinkIDs: []string{"recB", "recA"}}})
+	_ = airtable.cache.saveLinks([]Link{
+		{ID: stringPtr("recA"), Name: stringPtr("A & B"), URL: stringPtr("https://a.com"), Tags: []string{"go", "web"}, ListIDs: []string{"recL"}},
+		{ID: stringPtr("recB"), Name: stringPtr("Second"), URL: stringPtr("https://b.com"), Note: stringPtr("Read first"), Done: true, ListIDs: []string{"recL"}},
+	})
+	return airtable
+}
+
+func TestBuiltinTemplates(t *testing.T) {
+	t.Setenv("alfred_workflow_data", t.TempDir())
+	airtable := testTemplateCache(t)
+	data, err := airtable.templateData("recL")
+	if err != nil {
+		t.Fatalf("templateData() error = %v", err)
+	}
+	tests := map[string]string{
+		"markdown": "# Reading\n\nFor the weekend\n\n- [x] [Second](https://b.com)\n- [ ] [A & B](https://a.com)\n",
+		"org":      "* Reading\n** DONE [[https://b.com][Second]]\n** TODO [[https://a.com][A & B]] :go:web:\n",
+		"slack":    "*Reading*\n• <https://b.com|Second> ✓\n• <https://a.com|A & B>\n",
+		"html":     "<h2>Reading</h2>\n<ul>\n  <li><a href=\"https://b.com\">Second</a> — Read first</li>\n  <li><a href=\"https://a.com\">A &amp; B</a></li>\n</ul>\n",
+	}
+	for name, want := range tests {
+		tmpl, err := findTemplate(name)
+		if err != nil {
+			t.Fatalf("findTemplate(%s) error = %v", name, err)
+		}
+		got, err := tmpl.render(*data)
+		if err != nil {
+			t.Fatalf("render(%s) error = %v", name, err)
+		}
+		if got != want {
+			t.Errorf("render(%s) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestExportList(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv("alfred_workflow_data", dataDir)
+	if err := os.MkdirAll(templateDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	custom := `{{range .Links}}{{.Name}}{{with .Note}} ({{.}}){{end}}{{if .Tags}} #{{join .Tags " #"}}{{end}}
+{{end}}`
+	if err := os.WriteFile(filepath.Join(templateDir(), "plain.csv.tmpl"), []byte(custom), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A file replaces the built-in template with the same name
+	if err := os.WriteFile(filepath.Join(templateDir(), "slack.tmpl"), []byte("{{.List.Name}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("loadTemplates() error = %v", err)
+	}
+	names := []string{}
+	for _, tmpl := range templates {
+		names = append(names, tmpl.Name+tmpl.Ext)
+	}
+	if got, want := strings.Join(names, ","), "html.html,markdown.md,org.org,plain.csv,slack.txt"; got != want {
+		t.Errorf("loadTemplates() = %s, want %s", got, want)
+	}
+
+	airtable := testTemplateCache(t)
+	file, err := airtable.exportList("recL", "plain", "")
+	if err != nil {
+		t.Fatalf("exportList() error = %v", err)
+	}
+	if want := filepath.Join(dataDir, "exports", "Reading.csv"); file != want {
+		t.Errorf("exportList() file = %s, want %s", file, want)
+	}
+	text, _ := os.ReadFile(file)
+	if want := "Second (Read first)\nA & B #go #web\n"; string(text) != want {
+		t.Errorf("exported %q, want %q", text, want)
+	}
+	file, err = airtable.exportList("recL", "slack", filepath.Join(dataDir, "out.txt"))
+	if err != nil {
+		t.Fatalf("exportList() error = %v", err)
+	}
+	if text, _ = os.ReadFile(file); string(text) != "Reading" {
+		t.Errorf("exported %q with the custom slack template, want Reading", text)
+	}
+
+	if _, err = airtable.exportList("recL", "missing", "-"); err == nil {
+		t.Error("exportList() with an unknown template error = nil")
+	}
+}
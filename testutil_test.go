@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// A fake Airtable API keeping records in memory
+// Setting the Links of a list updates the Lists of the links, like Airtable does
+type fakeAirtable struct {
+	mu      sync.Mutex
+	records map[string]map[string]map[string]any
+	next    int
+}
+
+func (f *fakeAirtable) set(table string, id string, fields map[string]any) {
+	if f.records == nil {
+		f.records = map[string]map[string]map[string]any{}
+	}
+	if f.records[table] == nil {
+		f.records[table] = map[string]map[string]any{}
+	}
+	if f.records[table][id] == nil {
+		f.records[table][id] = map[string]any{}
+	}
+	for key, value := range fields {
+		f.records[table][id][key] = value
+	}
+	if table == "Lists" && fields["Links"] != nil {
+		ids := fields["Links"].([]any)
+		for linkID, link := range f.records["Links"] {
+			lists, _ := link["Lists"].([]any)
+			lists = slices.DeleteFunc(slices.Clone(lists), func(l any) bool { return l == id })
+			if slices.Contains(ids, any(linkID)) {
+				lists = append(lists, id)
+			}
+			link["Lists"] = lists
+		}
+	}
+}
+
+func (f *fakeAirtable) serve(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		table := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		response := Response{}
+		if r.Method == "GET" {
+			// Only lookups by record ID are filtered
+			formula := r.URL.Query().Get("filterByFormula")
+			for id, fields := range f.records[table] {
+				if formula == "" || formula == fmt.Sprintf("RECORD_ID()='%s'", id) {
+					response.Records = append(response.Records, Record{ID: &id, Fields: &fields})
+				}
+			}
+			_ = json.NewEncoder(w).Encode(response)
+			return
+		}
+		var body struct {
+			Records []Record `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		for _, record := range body.Records {
+			// Decode the fields the way they come from the API
+			var fields map[string]any
+			data, _ := json.Marshal(record.Fields)
+			_ = json.Unmarshal(data, &fields)
+			id := ""
+			switch r.Method {
+			case "POST":
+				f.next++
+				id = fmt.Sprintf("rec%s%011d", table[:3], f.next)
+			case "PATCH":
+				id = *record.ID
+			}
+			f.set(table, id, fields)
+			saved := f.records[table][id]
+			response.Records = append(response.Records, Record{ID: &id, Fields: &saved})
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+}
+
+// An Airtable that calls the fake, with an empty cache in memory
+func newTestAirtable(t *testing.T, fake *fakeAirtable) *Airtable {
+	t.Helper()
+	server := fake.serve(t)
+	t.Cleanup(server.Close)
+	return testAirtableAt(t, server.URL)
+}
+
+// An Airtable that calls the API at baseURL, with an empty cache in memory
+func testAirtableAt(t *testing.T, baseURL string) *Airtable {
+	t.Helper()
+	airtable := &Airtable{baseURL: baseURL, baseID: "app", auth: &Auth{Token: &oauth2.Token{AccessToken: "token"}}, cache: &Cache{file: ":memory:"}}
+	if err := airtable.cache.init(); err != nil {
+		t.Fatalf("init() error = %v", err)
+	}
+	return airtable
+}
@@ -6,9 +6,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/url"
-	"os"
 	"os/exec"
-	"regexp"
 	"strings"
 	"time"
 	"unicode"
@@ -36,11 +34,6 @@ func notify(subtitle string, m ...string) {
 	).Start()
 }
 
-func logMessage(level string, format string, a ...any) {
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-	fmt.Fprintf(os.Stderr, "%s [%s] %s\n", timestamp, level, fmt.Sprintf(format, a...))
-}
-
 var pinyinConverter = pinyin.NewArgs()
 
 func toPinyin(s *string) string {
@@ -62,11 +55,21 @@ func toPinyin(s *string) string {
 	return out.String()
 }
 
+// The host of the link without "www."
+func (l *Link) host() string {
+	if l.URL == nil {
+		return ""
+	}
+	u, err := url.Parse(*l.URL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
 func (l *Link) match() *string {
 	parts := []string{*l.Name, toPinyin(l.Name)}
-	u, err := url.Parse(*l.URL)
-	if err == nil {
-		host := strings.TrimPrefix(u.Host, "www.")
+	if host := l.host(); host != "" {
 		parts = append(parts, host)
 	}
 	if l.Note != nil {
@@ -82,6 +85,23 @@ func (l *Link) match() *string {
 	return stringPtr(strings.Join(parts, " "))
 }
 
+// The keys of the groups a link belongs to
+func (l *Link) groupKeys(by string) []string {
+	switch by {
+	case "Tags":
+		return l.Tags
+	case "Category":
+		if l.Category != nil {
+			return []string{*l.Category}
+		}
+	case "Domain":
+		if host := l.host(); host != "" {
+			return []string{host}
+		}
+	}
+	return nil
+}
+
 func (l *List) match() *string {
 	parts := []string{*l.Name, toPinyin(l.Name)}
 	if l.Note != nil {
@@ -95,9 +115,6 @@ func testURL(URL string) bool {
 	return err == nil && u.Scheme != "" && u.Host != ""
 }
 
-// func getURLTitle(URL string) string {
-// }
-
 func (l *Link) toRecord() Record {
 	fields := map[string]any{
 		"Done": l.Done,
@@ -241,14 +258,3 @@ func createCodeChallenge(codeVerifier string) string {
 	hash := sha256.Sum256([]byte(codeVerifier))
 	return base64.RawURLEncoding.EncodeToString(hash[:])
 }
-
-func parseMDLink(link string) (*string, *string) {
-	mdLinkRe := regexp.MustCompile(`^(?:- )?\[(.+)\]\((.+?)\)$`)
-	if mdLinkRe.MatchString(link) {
-		matches := mdLinkRe.FindStringSubmatch(link)
-		if len(matches) == 3 && testURL(matches[2]) {
-			return &matches[1], &matches[2]
-		}
-	}
-	return nil, nil
-}